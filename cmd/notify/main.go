@@ -0,0 +1,360 @@
+// 命令行发送通知，用于 shell 脚本和定时任务
+//
+//	notify webhook --type dingding --key xxx --secret SECxxx --markdown -   < report.md
+//	notify webhook --config notify.yml --name ops_wecom "服务已重启"
+//	notify mail --config notify.yml --name ops_mail --subject "日报" --to a@example.com,b@example.com -   < report.txt
+//	notify image --type weixin_work --key xxx --font InconsolataYahei.ttf -   < table.txt
+//
+// 内容为 "-" 或未指定时从标准输入读取；--config 未指定时读取环境变量 NOTIFY_CONFIG
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/SimoLin/go-utils/config"
+	"github.com/SimoLin/go-utils/text_drawer"
+	"github.com/SimoLin/go-utils/webhook"
+)
+
+const usage = `用法: notify <command> [options] [content | -]
+
+命令:
+  webhook   发送 webhook 机器人消息
+  mail      发送邮件
+  image     将文本渲染为图片后发送 webhook 机器人消息
+
+使用 notify <command> -h 查看命令参数
+`
+
+// 退出码：0 成功，1 发送失败，2 参数错误
+const (
+	EXIT_CODE_OK    = 0
+	EXIT_CODE_ERROR = 1
+	EXIT_CODE_USAGE = 2
+)
+
+var errUsage = errors.New("参数错误")
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	os.Exit(run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return EXIT_CODE_USAGE
+	}
+	var err error
+	switch args[0] {
+	case "webhook":
+		err = runWebhook(ctx, args[1:], stdin, stderr)
+	case "mail":
+		err = runMail(ctx, args[1:], stdin, stderr)
+	case "image":
+		err = runImage(ctx, args[1:], stdin, stderr)
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(stdout, usage)
+		return EXIT_CODE_OK
+	default:
+		fmt.Fprintf(stderr, "未知命令: %s\n\n%s", args[0], usage)
+		return EXIT_CODE_USAGE
+	}
+	switch {
+	case err == nil:
+		return EXIT_CODE_OK
+	case errors.Is(err, flag.ErrHelp):
+		return EXIT_CODE_OK
+	case errors.Is(err, errUsage):
+		fmt.Fprintln(stderr, err)
+		return EXIT_CODE_USAGE
+	case webhook.IsWarning(err):
+		// 消息已发送，仅@提醒未生效
+		fmt.Fprintln(stderr, "warning:", err)
+		return EXIT_CODE_OK
+	default:
+		fmt.Fprintln(stderr, err)
+		return EXIT_CODE_ERROR
+	}
+}
+
+// 读取消息内容，参数为空或为 "-" 时从标准输入读取
+func readContent(args []string, stdin io.Reader) (content string, err error) {
+	if len(args) == 0 || (len(args) == 1 && args[0] == "-") {
+		data, err := io.ReadAll(stdin)
+		if err != nil {
+			return "", err
+		}
+		content = string(data)
+	} else {
+		content = strings.Join(args, " ")
+	}
+	content = strings.TrimRight(content, "\r\n")
+	if strings.TrimSpace(content) == "" {
+		return "", fmt.Errorf("%w: 消息内容为空", errUsage)
+	}
+	return
+}
+
+func splitList(s string) (list []string) {
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return
+}
+
+func loadConfig(config_path string) (*config.Config, error) {
+	if config_path == "" {
+		config_path = os.Getenv("NOTIFY_CONFIG")
+	}
+	if config_path == "" {
+		return nil, nil
+	}
+	return config.Load(config_path)
+}
+
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// webhook 和 image 命令共用的参数，命令行参数覆盖配置文件
+type webhookFlags struct {
+	config_path  string
+	name         string
+	webhook_type string
+	key          string
+	secret       string
+	proxy        string
+	server       string
+	title        string
+	at           string
+	at_mobile    string
+	at_all       bool
+	timeout      time.Duration
+}
+
+func addWebhookFlags(flag_set *flag.FlagSet) *webhookFlags {
+	f := &webhookFlags{}
+	flag_set.StringVar(&f.config_path, "config", "", "配置文件路径，默认读取环境变量 NOTIFY_CONFIG")
+	flag_set.StringVar(&f.name, "name", "", "配置文件中的机器人名称")
+	flag_set.StringVar(&f.webhook_type, "type", "", "机器人类型: weixin_work | dingding | feishu | slack | discord | telegram | teams | generic")
+	flag_set.StringVar(&f.key, "key", "", "机器人 key / access_token，默认读取环境变量 NOTIFY_WEBHOOK_KEY")
+	flag_set.StringVar(&f.secret, "secret", "", "加签密钥，默认读取环境变量 NOTIFY_WEBHOOK_SECRET")
+	flag_set.StringVar(&f.proxy, "proxy", "", "代理地址")
+	flag_set.StringVar(&f.server, "server", "", "服务端地址，为空时使用机器人类型的默认地址")
+	flag_set.StringVar(&f.title, "title", "", "消息标题")
+	flag_set.StringVar(&f.at, "at", "", "@提醒的 userid，多个使用逗号分隔")
+	flag_set.StringVar(&f.at_mobile, "at-mobile", "", "@提醒的手机号，多个使用逗号分隔")
+	flag_set.BoolVar(&f.at_all, "at-all", false, "@所有人")
+	flag_set.DurationVar(&f.timeout, "timeout", 30*time.Second, "发送超时时间")
+	return f
+}
+
+func (f *webhookFlags) sender() (webhook_sender *webhook.WebhookSender, err error) {
+	webhook_config := config.WebhookConfig{}
+	c, err := loadConfig(f.config_path)
+	if err != nil {
+		return
+	}
+	if f.name != "" {
+		if c == nil {
+			return nil, fmt.Errorf("%w: 使用 --name 时需要指定 --config", errUsage)
+		}
+		if webhook_config, err = c.WebhookConfig(f.name); err != nil {
+			return
+		}
+	}
+	for _, item := range []struct {
+		target *string
+		value  string
+	}{
+		{&webhook_config.Type, f.webhook_type},
+		{&webhook_config.Key, f.key},
+		{&webhook_config.Secret, f.secret},
+		{&webhook_config.Proxy, f.proxy},
+		{&webhook_config.Server, f.server},
+		{&webhook_config.Title, f.title},
+	} {
+		if item.value != "" {
+			*item.target = item.value
+		}
+	}
+	// 命令行和配置文件均未指定时，读取环境变量
+	if webhook_config.Key == "" {
+		webhook_config.Key = os.Getenv("NOTIFY_WEBHOOK_KEY")
+	}
+	if webhook_config.Secret == "" {
+		webhook_config.Secret = os.Getenv("NOTIFY_WEBHOOK_SECRET")
+	}
+	if webhook_config.Key == "" && webhook_config.Server == "" {
+		return nil, fmt.Errorf("%w: 需要指定 --key 或 --name", errUsage)
+	}
+	// 命令行指定的@提醒覆盖配置文件，作为 WebhookSender 的默认@提醒
+	mention := &config.MentionConfig{UserIDs: splitList(f.at), Mobiles: splitList(f.at_mobile), AtAll: f.at_all}
+	if len(mention.UserIDs) > 0 || len(mention.Mobiles) > 0 || mention.AtAll {
+		webhook_config.Mention = mention
+	}
+	return config.NewWebhookSender(webhook_config)
+}
+
+func runWebhook(ctx context.Context, args []string, stdin io.Reader, stderr io.Writer) (err error) {
+	flag_set := flag.NewFlagSet("notify webhook", flag.ContinueOnError)
+	flag_set.SetOutput(stderr)
+	f := addWebhookFlags(flag_set)
+	markdown := flag_set.Bool("markdown", false, "以 markdown 类型发送")
+	if err = flag_set.Parse(args); err != nil {
+		return parseError(err)
+	}
+	webhook_sender, err := f.sender()
+	if err != nil {
+		return
+	}
+	content, err := readContent(flag_set.Args(), stdin)
+	if err != nil {
+		return
+	}
+	message := &webhook.Message{
+		MessageType: webhook.MESSAGE_TYPE_TEXT,
+		Title:       f.title,
+		Content:     content,
+	}
+	if *markdown {
+		message.MessageType = webhook.MESSAGE_TYPE_MARKDOWN
+	}
+	ctx, cancel := withTimeout(ctx, f.timeout)
+	defer cancel()
+	return webhook_sender.SendContext(ctx, message)
+}
+
+func runImage(ctx context.Context, args []string, stdin io.Reader, stderr io.Writer) (err error) {
+	flag_set := flag.NewFlagSet("notify image", flag.ContinueOnError)
+	flag_set.SetOutput(stderr)
+	f := addWebhookFlags(flag_set)
+	font_file := flag_set.String("font", "", "字体文件路径，为空时使用 text_drawer 的默认字体")
+	font_size := flag_set.Float64("font-size", 0, "字体大小，为 0 时使用默认值")
+	output := flag_set.String("output", "", "保存图片的路径，指定时只保存不发送")
+	if err = flag_set.Parse(args); err != nil {
+		return parseError(err)
+	}
+	content, err := readContent(flag_set.Args(), stdin)
+	if err != nil {
+		return
+	}
+	options := []text_drawer.OptionFunc{}
+	if *font_file != "" {
+		options = append(options, text_drawer.WithFontFile(*font_file))
+	}
+	if *font_size > 0 {
+		options = append(options, text_drawer.WithFontSize(*font_size))
+	}
+	rgba, err := text_drawer.New(options...).TextToImage(strings.Split(content, "\n"))
+	if err != nil {
+		return
+	}
+	if *output != "" {
+		text_drawer.SaveImageToFile(rgba, *output)
+		return
+	}
+	webhook_sender, err := f.sender()
+	if err != nil {
+		return
+	}
+	ctx, cancel := withTimeout(ctx, f.timeout)
+	defer cancel()
+	return webhook_sender.SendMessageImageBytesContext(ctx, text_drawer.ImageToByte(rgba))
+}
+
+func runMail(ctx context.Context, args []string, stdin io.Reader, stderr io.Writer) (err error) {
+	flag_set := flag.NewFlagSet("notify mail", flag.ContinueOnError)
+	flag_set.SetOutput(stderr)
+	config_path := flag_set.String("config", "", "配置文件路径，默认读取环境变量 NOTIFY_CONFIG")
+	name := flag_set.String("name", "", "配置文件中的邮件发送者名称")
+	server := flag_set.String("server", "", "SMTP 服务端地址，支持带端口格式(smtp.qq.com:465)")
+	user := flag_set.String("user", "", "SMTP 用户名")
+	password := flag_set.String("password", "", "SMTP 密码，默认读取环境变量 NOTIFY_MAIL_PASSWORD")
+	from := flag_set.String("from", "", "发件人")
+	from_name := flag_set.String("from-name", "", "发件人名称")
+	to := flag_set.String("to", "", "收件人，多个使用逗号分隔")
+	subject := flag_set.String("subject", "", "邮件标题")
+	html := flag_set.Bool("html", false, "以 text/html 格式发送")
+	insecure := flag_set.Bool("insecure", false, "不校验 SMTP 服务端证书")
+	timeout := flag_set.Duration("timeout", 30*time.Second, "发送超时时间")
+	if err = flag_set.Parse(args); err != nil {
+		return parseError(err)
+	}
+	if *subject == "" {
+		return fmt.Errorf("%w: 需要指定 --subject", errUsage)
+	}
+
+	mail_config := config.MailConfig{}
+	c, err := loadConfig(*config_path)
+	if err != nil {
+		return
+	}
+	if *name != "" {
+		if c == nil {
+			return fmt.Errorf("%w: 使用 --name 时需要指定 --config", errUsage)
+		}
+		if mail_config, err = c.MailConfig(*name); err != nil {
+			return
+		}
+	}
+	for _, item := range []struct {
+		target *string
+		value  string
+	}{
+		{&mail_config.Server, *server},
+		{&mail_config.User, *user},
+		{&mail_config.Password, *password},
+		{&mail_config.Sender, *from},
+		{&mail_config.SenderUsername, *from_name},
+	} {
+		if item.value != "" {
+			*item.target = item.value
+		}
+	}
+	if receivers := splitList(*to); len(receivers) > 0 {
+		mail_config.Receivers = receivers
+	}
+	if mail_config.Password == "" {
+		mail_config.Password = os.Getenv("NOTIFY_MAIL_PASSWORD")
+	}
+	if *html {
+		mail_config.ContentType = "text/html; charset=UTF-8"
+	}
+	if *insecure {
+		mail_config.Insecure = true
+	}
+	if mail_config.Server == "" || mail_config.User == "" {
+		return fmt.Errorf("%w: 需要指定 --server 和 --user 或 --name", errUsage)
+	}
+	content, err := readContent(flag_set.Args(), stdin)
+	if err != nil {
+		return
+	}
+	ctx, cancel := withTimeout(ctx, *timeout)
+	defer cancel()
+	return config.NewMailSender(mail_config).SendMailContext(ctx, *subject, content)
+}
+
+// flag 解析失败时已输出错误信息和用法
+func parseError(err error) error {
+	if errors.Is(err, flag.ErrHelp) {
+		return err
+	}
+	return fmt.Errorf("%w: %v", errUsage, err)
+}
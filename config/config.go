@@ -0,0 +1,389 @@
+// 从 YAML 配置文件加载邮件发送者、webhook 机器人和通知路由，支持 ${ENV} 和 ${ENV:默认值} 环境变量替换
+//
+//	mail:
+//	  ops:
+//	    server: smtp.qq.com:465
+//	    user: 777777777@qq.com
+//	    password: ${SMTP_PASSWORD}
+//	    receivers: [777777777@qq.com]
+//	webhook:
+//	  ops_wecom:
+//	    type: weixin_work
+//	    key: ${WECOM_KEY}
+//	  ops_dingding:
+//	    type: dingding
+//	    key: ${DINGDING_KEY}
+//	    secret: ${DINGDING_SECRET}
+//	    proxy: http://127.0.0.1:7890
+//	routes:
+//	  - channel: ops_dingding
+//	    min_severity: error
+//	    tags: [db]
+package config
+
+import (
+	"crypto/tls"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/SimoLin/go-utils/mail"
+	"github.com/SimoLin/go-utils/notify"
+	"github.com/SimoLin/go-utils/webhook"
+	"github.com/elastic/go-ucfg"
+	"github.com/elastic/go-ucfg/yaml"
+)
+
+// 配置文件中 type 字段的简写，也可以直接使用 webhook.WEBHOOK_TYPE_XXX 的值
+var DICT_CONFIG_TYPE_TO_WEBHOOK_TYPE = map[string]string{
+	"weixin_work": webhook.WEBHOOK_TYPE_WEIXIN_WORK,
+	"wecom":       webhook.WEBHOOK_TYPE_WEIXIN_WORK,
+	"dingding":    webhook.WEBHOOK_TYPE_DINGDING,
+	"dingtalk":    webhook.WEBHOOK_TYPE_DINGDING,
+	"feishu":      webhook.WEBHOOK_TYPE_FEISHU,
+	"lark":        webhook.WEBHOOK_TYPE_FEISHU,
+	"slack":       webhook.WEBHOOK_TYPE_SLACK,
+	"discord":     webhook.WEBHOOK_TYPE_DISCORD,
+	"telegram":    webhook.WEBHOOK_TYPE_TELEGRAM,
+	"teams":       webhook.WEBHOOK_TYPE_TEAMS,
+	"generic":     webhook.WEBHOOK_TYPE_GENERIC,
+}
+
+// 解析配置使用的 ucfg 选项
+//
+//	不使用 ucfg.PathSep，发送者名称和 headers 中带 "." 的键（如 ops.prod、X-Trace.Id）按原样解析，不拆分为嵌套路径
+var UCFG_OPTIONS = []ucfg.Option{
+	ucfg.VarExp,
+	ucfg.ResolveEnv,
+}
+
+// 邮件发送者配置
+type MailConfig struct {
+	Server         string        `config:"server" validate:"required"` // 支持带端口格式(smtp.qq.com:465)
+	Port           uint          `config:"port"`
+	User           string        `config:"user" validate:"required"`
+	Password       string        `config:"password"`
+	Sender         string        `config:"sender"`
+	SenderUsername string        `config:"sender_username"`
+	ContentType    string        `config:"content_type"`
+	Receivers      []string      `config:"receivers"`
+	Timeout        time.Duration `config:"timeout"`
+	Insecure       bool          `config:"insecure"` // 不校验服务端证书，用于自签名证书的内部 SMTP 服务
+}
+
+// webhook 机器人配置
+type WebhookConfig struct {
+	Type            string            `config:"type"` // 为空时默认为企微机器人
+	Key             string            `config:"key"`
+	Secret          string            `config:"secret"`
+	Proxy           string            `config:"proxy"`
+	Server          string            `config:"server"`
+	Title           string            `config:"title"`
+	Headers         map[string]string `config:"headers"`
+	ChatID          string            `config:"chat_id"`          // Telegram 机器人的 chat_id
+	PayloadTemplate string            `config:"payload_template"` // 通用 Webhook 的请求体模板
+	FeiShuAppID     string            `config:"feishu_app_id"`
+	FeiShuAppSecret string            `config:"feishu_app_secret"`
+	FeiShuOpenAPI   string            `config:"feishu_open_api"` // 飞书开放平台地址，为空时使用 webhook.FEISHU_OPEN_API_ADDRESS
+	Mention         *MentionConfig    `config:"mention"`
+	RateLimit       *RateLimitConfig  `config:"rate_limit"`
+	Retry           *RetryConfig      `config:"retry"`
+	Timeout         time.Duration     `config:"timeout"`
+}
+
+type MentionConfig struct {
+	UserIDs []string `config:"user_ids"`
+	Mobiles []string `config:"mobiles"`
+	AtAll   bool     `config:"at_all"`
+}
+
+type RateLimitConfig struct {
+	Count  int           `config:"count" validate:"min=1"`
+	Period time.Duration `config:"period"`
+}
+
+type RetryConfig struct {
+	MaxRetries int           `config:"max_retries"`
+	BaseDelay  time.Duration `config:"base_delay"`
+	MaxDelay   time.Duration `config:"max_delay"`
+}
+
+// 通知路由配置，channel 为 mail 或 webhook 中声明的名称
+type RouteConfig struct {
+	Channel     string   `config:"channel" validate:"required"`
+	MinSeverity string   `config:"min_severity"`
+	Tags        []string `config:"tags"`
+}
+
+type fileConfig struct {
+	Mail    map[string]MailConfig    `config:"mail"`
+	Webhook map[string]WebhookConfig `config:"webhook"`
+	Routes  []RouteConfig            `config:"routes"`
+}
+
+// 加载后的配置，发送者在加载时创建，同名多次获取返回同一个对象
+type Config struct {
+	mail_configs    map[string]MailConfig
+	webhook_configs map[string]WebhookConfig
+	mail_senders    map[string]*mail.MailSender
+	webhook_senders map[string]*webhook.WebhookSender
+	routes          []RouteConfig
+}
+
+// 从文件加载配置
+func Load(path string) (config *Config, err error) {
+	raw_config, err := yaml.NewConfigWithFile(path, UCFG_OPTIONS...)
+	if err != nil {
+		return nil, fmt.Errorf("读取配置文件失败: %w", err)
+	}
+	return parse(raw_config)
+}
+
+// 从 YAML 内容加载配置
+func LoadBytes(data []byte) (config *Config, err error) {
+	raw_config, err := yaml.NewConfig(data, UCFG_OPTIONS...)
+	if err != nil {
+		return nil, fmt.Errorf("解析配置失败: %w", err)
+	}
+	return parse(raw_config)
+}
+
+func parse(raw_config *ucfg.Config) (config *Config, err error) {
+	file_config := fileConfig{}
+	if err = raw_config.Unpack(&file_config, UCFG_OPTIONS...); err != nil {
+		return nil, fmt.Errorf("解析配置失败: %w", err)
+	}
+	config = &Config{
+		mail_configs:    file_config.Mail,
+		webhook_configs: file_config.Webhook,
+		mail_senders:    map[string]*mail.MailSender{},
+		webhook_senders: map[string]*webhook.WebhookSender{},
+		routes:          file_config.Routes,
+	}
+	for name, mail_config := range file_config.Mail {
+		config.mail_senders[name] = NewMailSender(mail_config)
+	}
+	for name, webhook_config := range file_config.Webhook {
+		if _, ok := config.mail_senders[name]; ok {
+			return nil, fmt.Errorf("名称重复: %s 同时声明于 mail 和 webhook", name)
+		}
+		webhook_sender, err := NewWebhookSender(webhook_config)
+		if err != nil {
+			return nil, fmt.Errorf("webhook %s 配置错误: %w", name, err)
+		}
+		config.webhook_senders[name] = webhook_sender
+	}
+	for _, route := range config.routes {
+		if config.channel(route.Channel) == nil {
+			return nil, fmt.Errorf("路由的渠道不存在: %s", route.Channel)
+		}
+		if route.MinSeverity != "" {
+			if _, err = notify.ParseSeverity(route.MinSeverity); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return
+}
+
+// 根据配置创建邮件发送者
+func NewMailSender(mail_config MailConfig) *mail.MailSender {
+	options := []mail.OptionFunc{}
+	if mail_config.Port != 0 {
+		options = append(options, mail.WithServerPort(mail_config.Port))
+	}
+	if mail_config.Sender != "" {
+		options = append(options, mail.WithSender(mail_config.Sender))
+	}
+	if mail_config.SenderUsername != "" {
+		options = append(options, mail.WithSenderUsername(mail_config.SenderUsername))
+	}
+	if mail_config.ContentType != "" {
+		options = append(options, mail.WithContentType(mail_config.ContentType))
+	}
+	if len(mail_config.Receivers) > 0 {
+		options = append(options, mail.WithReceiver(mail_config.Receivers))
+	}
+	if mail_config.Timeout > 0 {
+		options = append(options, mail.WithTimeout(mail_config.Timeout))
+	}
+	if mail_config.Insecure {
+		options = append(options, mail.WithTLSConfig(&tls.Config{InsecureSkipVerify: true}))
+	}
+	return mail.New(mail_config.Server, mail_config.User, mail_config.Password, options...)
+}
+
+// 根据配置创建 webhook 发送者
+func NewWebhookSender(webhook_config WebhookConfig) (webhook_sender *webhook.WebhookSender, err error) {
+	webhook_type := webhook.WEBHOOK_TYPE_WEIXIN_WORK
+	if webhook_config.Type != "" {
+		webhook_type = webhook_config.Type
+		if s, ok := DICT_CONFIG_TYPE_TO_WEBHOOK_TYPE[webhook_type]; ok {
+			webhook_type = s
+		}
+	}
+	options := []webhook.OptionFunc{webhook.WithWebhookType(webhook_type)}
+	switch {
+	case webhook_type == webhook.WEBHOOK_TYPE_TELEGRAM && webhook_config.ChatID != "":
+		options = append(options, webhook.WithProvider(&webhook.TelegramProvider{ChatID: webhook_config.ChatID}))
+	case webhook_type == webhook.WEBHOOK_TYPE_GENERIC && webhook_config.PayloadTemplate != "":
+		provider, err := webhook.NewGenericProvider(webhook_type, webhook_config.Server, webhook_config.PayloadTemplate)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, webhook.WithProvider(provider))
+	default:
+		if _, ok := webhook.GetProvider(webhook_type); !ok {
+			return nil, fmt.Errorf("不支持的机器人类型: %s", webhook_config.Type)
+		}
+	}
+	if webhook_config.Server != "" {
+		options = append(options, webhook.WithServerAddress(webhook_config.Server))
+	}
+	if webhook_config.Secret != "" {
+		options = append(options, webhook.WithSecret(webhook_config.Secret))
+	}
+	if webhook_config.Proxy != "" {
+		options = append(options, webhook.WithProxyAddress(webhook_config.Proxy))
+	}
+	if webhook_config.Title != "" {
+		options = append(options, webhook.WithMessageTitle(webhook_config.Title))
+	}
+	if len(webhook_config.Headers) > 0 {
+		options = append(options, webhook.WithRequestHeaders(webhook_config.Headers))
+	}
+	if webhook_config.FeiShuAppID != "" {
+		options = append(options, webhook.WithFeiShuApp(webhook_config.FeiShuAppID, webhook_config.FeiShuAppSecret))
+	}
+	if webhook_config.FeiShuOpenAPI != "" {
+		options = append(options, webhook.WithFeiShuOpenAPIAddress(webhook_config.FeiShuOpenAPI))
+	}
+	if mention := webhook_config.Mention; mention != nil {
+		options = append(options, webhook.WithMention(webhook.Mention{
+			UserIDs: mention.UserIDs,
+			Mobiles: mention.Mobiles,
+			AtAll:   mention.AtAll,
+		}))
+	}
+	if rate_limit := webhook_config.RateLimit; rate_limit != nil {
+		period := rate_limit.Period
+		if period == 0 {
+			period = time.Minute
+		}
+		options = append(options, webhook.WithRateLimit(rate_limit.Count, period))
+	}
+	if retry := webhook_config.Retry; retry != nil {
+		options = append(options, webhook.WithRetry(retry.MaxRetries, retry.BaseDelay, retry.MaxDelay))
+	}
+	if webhook_config.Timeout > 0 {
+		options = append(options, webhook.WithTimeout(webhook_config.Timeout))
+	}
+	return webhook.New(webhook_config.Key, options...), nil
+}
+
+// 按名称获取邮件发送者
+func (config *Config) MailSender(name string) (mail_sender *mail.MailSender, err error) {
+	mail_sender, ok := config.mail_senders[name]
+	if !ok {
+		return nil, fmt.Errorf("邮件配置不存在: %s", name)
+	}
+	return
+}
+
+// 按名称获取 webhook 发送者
+func (config *Config) WebhookSender(name string) (webhook_sender *webhook.WebhookSender, err error) {
+	webhook_sender, ok := config.webhook_senders[name]
+	if !ok {
+		return nil, fmt.Errorf("webhook 配置不存在: %s", name)
+	}
+	return
+}
+
+// 按名称获取邮件配置（已完成环境变量替换），可修改后使用 NewMailSender 创建新的发送者
+func (config *Config) MailConfig(name string) (mail_config MailConfig, err error) {
+	mail_config, ok := config.mail_configs[name]
+	if !ok {
+		return mail_config, fmt.Errorf("邮件配置不存在: %s", name)
+	}
+	return
+}
+
+// 按名称获取 webhook 配置（已完成环境变量替换），可修改后使用 NewWebhookSender 创建新的发送者
+func (config *Config) WebhookConfig(name string) (webhook_config WebhookConfig, err error) {
+	webhook_config, ok := config.webhook_configs[name]
+	if !ok {
+		return webhook_config, fmt.Errorf("webhook 配置不存在: %s", name)
+	}
+	return
+}
+
+// 获取所有邮件配置的名称，按字母排序
+func (config *Config) MailNames() []string {
+	return sortedKeys(config.mail_senders)
+}
+
+// 获取所有 webhook 配置的名称，按字母排序
+func (config *Config) WebhookNames() []string {
+	return sortedKeys(config.webhook_senders)
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (config *Config) channel(name string) notify.Channel {
+	if mail_sender, ok := config.mail_senders[name]; ok {
+		return mail_sender
+	}
+	if webhook_sender, ok := config.webhook_senders[name]; ok {
+		return webhook_sender
+	}
+	return nil
+}
+
+// 按 routes 创建 Notifier，未配置 routes 时所有发送者接收全部消息
+//
+//	options 中 WithChannel 添加的渠道与配置中的发送者名称重复时返回 notify.ErrDuplicateChannel
+func (config *Config) Notifier(options ...notify.OptionFunc) (notifier *notify.Notifier, err error) {
+	notifier, err = notify.New(options...)
+	if err != nil {
+		return
+	}
+	if len(config.routes) == 0 {
+		for _, name := range config.MailNames() {
+			if err = notifier.AddChannel(name, config.mail_senders[name]); err != nil {
+				return nil, err
+			}
+		}
+		for _, name := range config.WebhookNames() {
+			if err = notifier.AddChannel(name, config.webhook_senders[name]); err != nil {
+				return nil, err
+			}
+		}
+		return
+	}
+	// 同一渠道的多条路由合并，任一匹配即发送
+	names := []string{}
+	dict_name_to_routes := map[string][]notify.Route{}
+	for _, route_config := range config.routes {
+		severity, _ := notify.ParseSeverity(route_config.MinSeverity)
+		if _, ok := dict_name_to_routes[route_config.Channel]; !ok {
+			names = append(names, route_config.Channel)
+		}
+		dict_name_to_routes[route_config.Channel] = append(dict_name_to_routes[route_config.Channel], notify.Route{
+			MinSeverity: severity,
+			Tags:        route_config.Tags,
+		})
+	}
+	for _, name := range names {
+		if err = notifier.AddChannel(name, config.channel(name), dict_name_to_routes[name]...); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
@@ -25,12 +25,86 @@ func AESEncryptCBC(origData []byte, key []byte) (encrypted []byte) {
 	return encrypted
 }
 
+// 使用 key 的前 blockSize 字节作为 IV，与 AESEncryptCBC 对应
+func AESDecryptCBC(encrypted []byte, key []byte) (decrypted []byte, err error) {
+	if len(key) < aes.BlockSize {
+		return nil, fmt.Errorf("密钥长度错误: %d", len(key))
+	}
+	return AESDecryptCBCWithIV(encrypted, key, key[:aes.BlockSize])
+}
+
+// 指定 IV 加密，填充方式为 PKCS7
+func AESEncryptCBCWithIV(origData []byte, key []byte, iv []byte) (encrypted []byte, err error) {
+	return AESEncryptCBCNoPadding(PKCS7Padding(origData, aes.BlockSize), key, iv)
+}
+
+// 指定 IV 解密，并去除 PKCS7 填充
+func AESDecryptCBCWithIV(encrypted []byte, key []byte, iv []byte) (decrypted []byte, err error) {
+	decrypted, err = AESDecryptCBCNoPadding(encrypted, key, iv)
+	if err != nil {
+		return
+	}
+	return PKCS7UnPadding(decrypted, aes.BlockSize)
+}
+
+// 指定 IV 加密，不做填充，origData 长度需为 16 的倍数
+func AESEncryptCBCNoPadding(origData []byte, key []byte, iv []byte) (encrypted []byte, err error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return
+	}
+	if len(iv) != block.BlockSize() {
+		return nil, fmt.Errorf("IV 长度错误: %d", len(iv))
+	}
+	if len(origData)%block.BlockSize() != 0 {
+		return nil, fmt.Errorf("明文长度错误: %d", len(origData))
+	}
+	encrypted = make([]byte, len(origData))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, origData)
+	return
+}
+
+// 指定 IV 解密，不去除填充
+func AESDecryptCBCNoPadding(encrypted []byte, key []byte, iv []byte) (decrypted []byte, err error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return
+	}
+	if len(iv) != block.BlockSize() {
+		return nil, fmt.Errorf("IV 长度错误: %d", len(iv))
+	}
+	if len(encrypted) == 0 || len(encrypted)%block.BlockSize() != 0 {
+		return nil, fmt.Errorf("密文长度错误: %d", len(encrypted))
+	}
+	decrypted = make([]byte, len(encrypted))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(decrypted, encrypted)
+	return
+}
+
 func PKCS7Padding(originByte []byte, blockSize int) []byte {
 	padding := blockSize - len(originByte)%blockSize
 	padText := bytes.Repeat([]byte{byte(padding)}, padding)
 	return append(originByte, padText...)
 }
 
+// 去除 PKCS7 填充，填充格式错误时返回 err
+func PKCS7UnPadding(originByte []byte, blockSize int) ([]byte, error) {
+	length := len(originByte)
+	if length == 0 || length%blockSize != 0 {
+		return nil, fmt.Errorf("填充长度错误: %d", length)
+	}
+	padding := int(originByte[length-1])
+	if padding == 0 || padding > blockSize || padding > length {
+		return nil, fmt.Errorf("填充格式错误: %d", padding)
+	}
+	for _, b := range originByte[length-padding:] {
+		if int(b) != padding {
+			return nil, fmt.Errorf("填充格式错误: %d", padding)
+		}
+	}
+	return originByte[:length-padding], nil
+}
+
 // 解析 string 为 rsa.PublicKey 类型
 func RSAReadPublicKey(pub_key_string string) (pub_key *rsa.PublicKey, err error) {
 	pemBlock, _ := pem.Decode([]byte(pub_key_string))
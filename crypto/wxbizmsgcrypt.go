@@ -0,0 +1,163 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/SimoLin/go-utils/hash"
+)
+
+// 企业微信回调消息加解密，对应官方 WXBizMsgCrypt
+//
+//	AES 密钥为 base64_decode(EncodingAESKey + "=")，共 32 字节，IV 为密钥前 16 字节
+//	明文格式为 random(16B) + msg_len(4B, 网络字节序) + msg + receiveid，按 32 字节做 PKCS7 填充
+//	签名为 sha1(sort(token, timestamp, nonce, encrypt))
+var (
+	ErrWXBizValidateSignature = errors.New("企业微信回调签名校验失败")
+	ErrWXBizParseXML          = errors.New("企业微信回调 XML 解析失败")
+	ErrWXBizIllegalAESKey     = errors.New("企业微信 EncodingAESKey 非法")
+	ErrWXBizDecrypt           = errors.New("企业微信回调消息解密失败")
+	ErrWXBizIllegalBuffer     = errors.New("企业微信回调消息明文格式错误")
+	ErrWXBizValidateReceiveID = errors.New("企业微信回调 receiveid 校验失败")
+)
+
+// 企业微信加解密使用 32 字节的 PKCS7 填充
+const WXBIZ_BLOCK_SIZE = 32
+
+type WXBizMsgCrypt struct {
+	token      string
+	aes_key    []byte
+	receive_id string // 企业应用回调为 corpid，第三方事件回调为 suiteid，为空时不校验
+}
+
+// 加密后的回调消息，被动回复时需要返回此格式的 XML
+type WXBizEncryptedMessage struct {
+	XMLName      xml.Name `xml:"xml"`
+	ToUserName   string   `xml:"ToUserName,omitempty"`
+	AgentID      string   `xml:"AgentID,omitempty"`
+	Encrypt      cdata    `xml:"Encrypt"`
+	MsgSignature cdata    `xml:"MsgSignature,omitempty"`
+	TimeStamp    string   `xml:"TimeStamp,omitempty"`
+	Nonce        cdata    `xml:"Nonce,omitempty"`
+}
+
+type cdata struct {
+	Value string `xml:",cdata"`
+}
+
+func NewWXBizMsgCrypt(token string, encoding_aes_key string, receive_id string) (wxbiz_msg_crypt *WXBizMsgCrypt, err error) {
+	if len(encoding_aes_key) != 43 {
+		return nil, ErrWXBizIllegalAESKey
+	}
+	aes_key, err := base64.StdEncoding.DecodeString(encoding_aes_key + "=")
+	if err != nil || len(aes_key) != 32 {
+		return nil, ErrWXBizIllegalAESKey
+	}
+	return &WXBizMsgCrypt{token: token, aes_key: aes_key, receive_id: receive_id}, nil
+}
+
+// 计算签名：sha1(sort(token, timestamp, nonce, encrypt))
+func WXBizSignature(token string, timestamp string, nonce string, encrypt string) string {
+	list := []string{token, timestamp, nonce, encrypt}
+	sort.Strings(list)
+	return hash.SHA1Encode(strings.Join(list, ""))
+}
+
+func (wxbiz_msg_crypt *WXBizMsgCrypt) Signature(timestamp string, nonce string, encrypt string) string {
+	return WXBizSignature(wxbiz_msg_crypt.token, timestamp, nonce, encrypt)
+}
+
+// 加密消息，返回 base64 编码的密文
+func (wxbiz_msg_crypt *WXBizMsgCrypt) Encrypt(msg []byte) (encrypt string, err error) {
+	buffer := make([]byte, 20, 20+len(msg)+len(wxbiz_msg_crypt.receive_id))
+	if _, err = rand.Read(buffer[:16]); err != nil {
+		return
+	}
+	binary.BigEndian.PutUint32(buffer[16:20], uint32(len(msg)))
+	buffer = append(buffer, msg...)
+	buffer = append(buffer, wxbiz_msg_crypt.receive_id...)
+	encrypted, err := AESEncryptCBCNoPadding(
+		PKCS7Padding(buffer, WXBIZ_BLOCK_SIZE),
+		wxbiz_msg_crypt.aes_key,
+		wxbiz_msg_crypt.aes_key[:16],
+	)
+	if err != nil {
+		return
+	}
+	return base64.StdEncoding.EncodeToString(encrypted), nil
+}
+
+// 解密 base64 编码的密文，校验 receiveid 后返回消息内容
+func (wxbiz_msg_crypt *WXBizMsgCrypt) Decrypt(encrypt string) (msg []byte, err error) {
+	encrypted, err := base64.StdEncoding.DecodeString(encrypt)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWXBizDecrypt, err)
+	}
+	decrypted, err := AESDecryptCBCNoPadding(encrypted, wxbiz_msg_crypt.aes_key, wxbiz_msg_crypt.aes_key[:16])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWXBizDecrypt, err)
+	}
+	decrypted, err = PKCS7UnPadding(decrypted, WXBIZ_BLOCK_SIZE)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWXBizIllegalBuffer, err)
+	}
+	if len(decrypted) < 20 {
+		return nil, ErrWXBizIllegalBuffer
+	}
+	msg_len := int(binary.BigEndian.Uint32(decrypted[16:20]))
+	if msg_len > len(decrypted)-20 {
+		return nil, ErrWXBizIllegalBuffer
+	}
+	msg = decrypted[20 : 20+msg_len]
+	receive_id := string(decrypted[20+msg_len:])
+	if wxbiz_msg_crypt.receive_id != "" && receive_id != wxbiz_msg_crypt.receive_id {
+		return nil, ErrWXBizValidateReceiveID
+	}
+	return msg, nil
+}
+
+// 使用常量时间比较签名，避免通过响应时间猜测签名
+func (wxbiz_msg_crypt *WXBizMsgCrypt) verifySignature(msg_signature string, timestamp string, nonce string, encrypt string) bool {
+	return subtle.ConstantTimeCompare([]byte(wxbiz_msg_crypt.Signature(timestamp, nonce, encrypt)), []byte(msg_signature)) == 1
+}
+
+// 验证回调 URL，校验签名并返回解密后的 echostr，需原样响应给企业微信
+func (wxbiz_msg_crypt *WXBizMsgCrypt) VerifyURL(msg_signature string, timestamp string, nonce string, echostr string) (reply_echostr []byte, err error) {
+	if !wxbiz_msg_crypt.verifySignature(msg_signature, timestamp, nonce, echostr) {
+		return nil, ErrWXBizValidateSignature
+	}
+	return wxbiz_msg_crypt.Decrypt(echostr)
+}
+
+// 解密回调消息，post_data 为 POST 请求的 XML 请求体，返回明文 XML
+func (wxbiz_msg_crypt *WXBizMsgCrypt) DecryptMsg(msg_signature string, timestamp string, nonce string, post_data []byte) (msg []byte, err error) {
+	encrypted_message := WXBizEncryptedMessage{}
+	if err = xml.Unmarshal(post_data, &encrypted_message); err != nil || encrypted_message.Encrypt.Value == "" {
+		return nil, ErrWXBizParseXML
+	}
+	if !wxbiz_msg_crypt.verifySignature(msg_signature, timestamp, nonce, encrypted_message.Encrypt.Value) {
+		return nil, ErrWXBizValidateSignature
+	}
+	return wxbiz_msg_crypt.Decrypt(encrypted_message.Encrypt.Value)
+}
+
+// 加密被动回复消息，返回包含 Encrypt、MsgSignature、TimeStamp、Nonce 的 XML
+func (wxbiz_msg_crypt *WXBizMsgCrypt) EncryptMsg(reply_msg []byte, timestamp string, nonce string) (encrypted_xml []byte, err error) {
+	encrypt, err := wxbiz_msg_crypt.Encrypt(reply_msg)
+	if err != nil {
+		return
+	}
+	return xml.Marshal(WXBizEncryptedMessage{
+		Encrypt:      cdata{encrypt},
+		MsgSignature: cdata{wxbiz_msg_crypt.Signature(timestamp, nonce, encrypt)},
+		TimeStamp:    timestamp,
+		Nonce:        cdata{nonce},
+	})
+}
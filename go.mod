@@ -15,7 +15,7 @@ require (
 )
 
 require (
-	github.com/elastic/go-ucfg v0.8.5 // indirect
+	github.com/elastic/go-ucfg v0.8.5
 	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0
 	go.uber.org/multierr v1.11.0 // indirect
 	go.uber.org/zap v1.27.0 // indirect
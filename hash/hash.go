@@ -42,6 +42,19 @@ func SHA256Encode(S1 string) string {
 	return hex.EncodeToString(o.Sum(nil))
 }
 
+func HMACSHA256Encode(s string, key string) string {
+	o := hmac.New(sha256.New, []byte(key))
+	o.Write([]byte(s))
+	return hex.EncodeToString(o.Sum(nil))
+}
+
+// HMAC-SHA256 签名结果使用 Base64 编码，钉钉、飞书机器人加签使用
+func HMACSHA256EncodeToBase64(s string, key string) string {
+	o := hmac.New(sha256.New, []byte(key))
+	o.Write([]byte(s))
+	return base64.StdEncoding.EncodeToString(o.Sum(nil))
+}
+
 func HMACSHA512Encode(s string, key string) string {
 	o := hmac.New(sha512.New, []byte(key))
 	o.Write([]byte(s))
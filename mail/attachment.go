@@ -0,0 +1,123 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// base64 编码后每行的最大长度，RFC 2045 要求不超过 76 个字符
+const BASE64_LINE_LENGTH = 76
+
+// 常用附件扩展名的内容类型，优先于系统 MIME 表，避免不同系统识别结果不一致
+var DICT_EXTENSION_TO_CONTENT_TYPE = map[string]string{
+	".csv":  "text/csv; charset=UTF-8",
+	".txt":  "text/plain; charset=UTF-8",
+	".log":  "text/plain; charset=UTF-8",
+	".json": "application/json",
+	".zip":  "application/zip",
+	".gz":   "application/gzip",
+	".pdf":  "application/pdf",
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+}
+
+// 邮件附件
+type Attachment struct {
+	Filename    string // 文件名，支持中文，按 RFC 2231 编码
+	ContentType string // 内容类型，为空时按文件扩展名和内容识别
+	Data        []byte // 文件内容
+	ContentID   string // 内嵌图片的 Content-ID，HTML 中使用 cid:ContentID 引用，附件为空
+}
+
+// 使用字节创建附件，content_type 为空时按文件扩展名和内容识别
+func NewAttachment(filename string, data []byte, content_type string) *Attachment {
+	return &Attachment{
+		Filename:    filename,
+		ContentType: content_type,
+		Data:        data,
+	}
+}
+
+// 读取 io.Reader 的全部内容创建附件
+func NewAttachmentFromReader(filename string, reader io.Reader, content_type string) (attachment *Attachment, err error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("读取附件 %s 失败: %w", filename, err)
+	}
+	return NewAttachment(filename, data, content_type), nil
+}
+
+// 读取文件创建附件，文件名使用路径的最后一部分
+func NewAttachmentFromFile(file_path string) (attachment *Attachment, err error) {
+	data, err := os.ReadFile(file_path)
+	if err != nil {
+		return nil, fmt.Errorf("读取附件 %s 失败: %w", file_path, err)
+	}
+	return NewAttachment(filepath.Base(file_path), data, ""), nil
+}
+
+// 获取附件的内容类型
+func (attachment *Attachment) GetContentType() string {
+	if attachment.ContentType != "" {
+		return attachment.ContentType
+	}
+	extension := strings.ToLower(filepath.Ext(attachment.Filename))
+	if content_type, ok := DICT_EXTENSION_TO_CONTENT_TYPE[extension]; ok {
+		return content_type
+	}
+	if content_type := mime.TypeByExtension(extension); content_type != "" {
+		return content_type
+	}
+	return http.DetectContentType(attachment.Data)
+}
+
+// 发送带附件的邮件
+func (mail_sender *MailSender) SendMailWithAttachments(mail_title string, mail_content string, attachments ...*Attachment) (err error) {
+	return mail_sender.SendMailWithAttachmentsContext(context.Background(), mail_title, mail_content, attachments...)
+}
+
+// 发送带附件的邮件，正文和附件组成 multipart/mixed 消息，均使用 base64 传输编码
+//
+//	需要同时发送 HTML 正文或内嵌图片时使用 SendMessage
+func (mail_sender *MailSender) SendMailWithAttachmentsContext(ctx context.Context, mail_title string, mail_content string, attachments ...*Attachment) (err error) {
+	event := mail_sender.newSendEvent(mail_title, mail_content)
+	event.Attachments = attachments
+	return mail_sender.send(ctx, event)
+}
+
+// 生成附件节点，disposition 为 attachment 或 inline
+//
+//	非 ASCII 文件名在 Content-Disposition 中按 RFC 2231 编码，Content-Type 的 name 参数兼容旧客户端
+func newAttachmentNode(attachment *Attachment, disposition string) (node *mimeNode, err error) {
+	media_type, params, err := mime.ParseMediaType(attachment.GetContentType())
+	if err != nil {
+		return nil, fmt.Errorf("附件 %s 的内容类型无效: %w", attachment.Filename, err)
+	}
+	params["name"] = attachment.Filename
+	return newMIMELeaf(textproto.MIMEHeader{
+		"Content-Type":        {mime.FormatMediaType(media_type, params)},
+		"Content-Disposition": {mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Filename})},
+	}, attachment.Data), nil
+}
+
+// 写入 base64 编码的内容，每行不超过 BASE64_LINE_LENGTH 个字符
+func writeBase64(buffer *bytes.Buffer, data []byte) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > BASE64_LINE_LENGTH {
+		buffer.WriteString(encoded[:BASE64_LINE_LENGTH] + "\r\n")
+		encoded = encoded[BASE64_LINE_LENGTH:]
+	}
+	buffer.WriteString(encoded + "\r\n")
+}
@@ -0,0 +1,82 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// 发送结果状态
+const (
+	SEND_STATUS_SUCCESS = "success" // 发送成功
+	SEND_STATUS_FAILURE = "failure" // 发送失败
+	SEND_STATUS_VETOED  = "vetoed"  // 被 before-send 钩子拦截，未发送
+)
+
+var ErrSendVetoed = errors.New("邮件已被 before-send 钩子拦截")
+
+// 一次发送邮件的事件
+type SendEvent struct {
+	ServerAddress string        // 服务端地址，带端口格式
+	Title         string        // 邮件标题，before-send 钩子可修改
+	Content       string        // 邮件内容，指定 HTML 时为纯文本备选，before-send 钩子可修改
+	HTML          string        // HTML 正文，使用 SendMessage 发送时指定，before-send 钩子可修改
+	Receivers     []string      // 收件人，before-send 钩子可修改
+	Inlines       []*Attachment // 内嵌图片，before-send 钩子可修改
+	Attachments   []*Attachment // 附件，before-send 钩子可修改
+	Duration      time.Duration // 发送耗时
+	Status        string        // 发送结果状态，SEND_STATUS_SUCCESS | SEND_STATUS_FAILURE | SEND_STATUS_VETOED
+	Err           error         // 发送失败或被拦截时的错误
+}
+
+// 发送前调用，可修改标题、内容、收件人和附件，返回错误时拦截本次发送
+type BeforeSendHook func(ctx context.Context, event *SendEvent) error
+
+// 发送后调用，被拦截时同样会调用
+type AfterSendHook func(ctx context.Context, event *SendEvent)
+
+// 可添加 before-send 钩子，按添加顺序调用，任一钩子返回错误时停止调用后续钩子
+func WithBeforeSend(hooks ...BeforeSendHook) OptionFunc {
+	return func(mail_sender *MailSender) {
+		mail_sender.before_send_hooks = append(mail_sender.before_send_hooks, hooks...)
+	}
+}
+
+// 可添加 after-send 钩子，按添加顺序调用
+func WithAfterSend(hooks ...AfterSendHook) OptionFunc {
+	return func(mail_sender *MailSender) {
+		mail_sender.after_send_hooks = append(mail_sender.after_send_hooks, hooks...)
+	}
+}
+
+// 调用 before-send 钩子，返回的错误包装了 ErrSendVetoed
+func (mail_sender *MailSender) runBeforeSendHooks(ctx context.Context, event *SendEvent) (err error) {
+	for _, hook := range mail_sender.before_send_hooks {
+		if err = hook(ctx, event); err != nil {
+			return fmt.Errorf("%w: %w", ErrSendVetoed, err)
+		}
+	}
+	return
+}
+
+func (mail_sender *MailSender) runAfterSendHooks(ctx context.Context, event *SendEvent) {
+	for _, hook := range mail_sender.after_send_hooks {
+		hook(ctx, event)
+	}
+}
+
+func (mail_sender *MailSender) newSendEvent(mail_title string, mail_content string) *SendEvent {
+	return &SendEvent{
+		ServerAddress: fmt.Sprintf("%s:%d", mail_sender.server_address, mail_sender.server_port),
+		Title:         mail_title,
+		Content:       mail_content,
+		Receivers:     slices.Clone(mail_sender.receiver),
+	}
+}
+
+// 是否为被 before-send 钩子拦截的错误
+func IsVetoed(err error) bool {
+	return errors.Is(err, ErrSendVetoed)
+}
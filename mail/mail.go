@@ -1,23 +1,34 @@
 package mail
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
+	"mime"
 	"net"
+	net_mail "net/mail"
 	"net/smtp"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/SimoLin/go-utils/message_template"
 )
 
 type MailSender struct {
-	server_address  string   // 服务端地址，支持带端口格式(smtp.qq.com:465)
-	server_port     uint     // 服务端口，默认为465
-	auth_user       string   // 用户名
-	auth_password   string   // 密码
-	sender          string   // 发件人，默认为 auth_user
-	sender_username string   // 发件人名称，默认为 auth_user 按 @ 字符切片的前半部分
-	content_type    string   // 内容类型格式，"text/plain; charset=UTF-8" | "text/html; charset=UTF-8"
-	receiver        []string // 收件人
+	server_address    string                     // 服务端地址，支持带端口格式(smtp.qq.com:465)
+	server_port       uint                       // 服务端口，默认为465
+	auth_user         string                     // 用户名
+	auth_password     string                     // 密码
+	sender            string                     // 发件人，默认为 auth_user
+	sender_username   string                     // 发件人名称，默认为 auth_user 按 @ 字符切片的前半部分
+	content_type      string                     // 内容类型格式，"text/plain; charset=UTF-8" | "text/html; charset=UTF-8"
+	receiver          []string                   // 收件人
+	tls_config        *tls.Config                // TLS 配置，为空时使用系统默认配置
+	timeout           time.Duration              // 单次发送的超时时间，包括连接、TLS 握手和数据传输，默认为 30 秒
+	template_registry *message_template.Registry // SendTemplate 使用的模板注册表，默认为 message_template.DefaultRegistry
+	before_send_hooks []BeforeSendHook           // 发送前钩子
+	after_send_hooks  []AfterSendHook            // 发送后钩子
 }
 
 type OptionFunc func(*MailSender)
@@ -32,6 +43,8 @@ func initOptions(options ...OptionFunc) *MailSender {
 		sender_username: "",
 		content_type:    "text/plain; charset=UTF-8",
 		receiver:        []string{},
+		tls_config:      nil,
+		timeout:         30 * time.Second,
 	}
 	for _, option_func := range options {
 		option_func(mail_sender)
@@ -80,6 +93,27 @@ func WithContentType(s string) OptionFunc {
 	}
 }
 
+// 指定 TLS 配置，例如自签名证书的 RootCAs
+func WithTLSConfig(tls_config *tls.Config) OptionFunc {
+	return func(mail_sender *MailSender) {
+		mail_sender.tls_config = tls_config
+	}
+}
+
+// 指定单次发送的超时时间，为 0 时不限制（仍受 ctx 控制）
+func WithTimeout(d time.Duration) OptionFunc {
+	return func(mail_sender *MailSender) {
+		mail_sender.timeout = d
+	}
+}
+
+// 可指定 SendTemplate 使用的模板注册表
+func WithTemplateRegistry(registry *message_template.Registry) OptionFunc {
+	return func(mail_sender *MailSender) {
+		mail_sender.template_registry = registry
+	}
+}
+
 func New(server_address string, auth_user string, auth_password string, options ...OptionFunc) *MailSender {
 	mail_sender := initOptions(options...)
 	mail_sender.server_address = server_address
@@ -112,27 +146,79 @@ func New(server_address string, auth_user string, auth_password string, options
 }
 
 func (mail_sender *MailSender) SendMail(mail_title string, mail_content string) (err error) {
+	return mail_sender.SendMailContext(context.Background(), mail_title, mail_content)
+}
+
+// 发送邮件，ctx 取消或超时时中断连接、握手和数据传输，返回 ctx.Err()
+//
+//	发送前后调用 WithBeforeSend、WithAfterSend 添加的钩子，被拦截时返回包装了 ErrSendVetoed 的错误
+func (mail_sender *MailSender) SendMailContext(ctx context.Context, mail_title string, mail_content string) (err error) {
+	return mail_sender.send(ctx, mail_sender.newSendEvent(mail_title, mail_content))
+}
+
+// 调用钩子并发送邮件
+func (mail_sender *MailSender) send(ctx context.Context, event *SendEvent) (err error) {
+	if len(mail_sender.before_send_hooks) == 0 && len(mail_sender.after_send_hooks) == 0 {
+		return mail_sender.sendMail(ctx, event)
+	}
+	start_time := time.Now()
+	defer func() {
+		event.Duration = time.Since(start_time)
+		event.Err = err
+		switch {
+		case IsVetoed(err):
+			event.Status = SEND_STATUS_VETOED
+		case err != nil:
+			event.Status = SEND_STATUS_FAILURE
+		default:
+			event.Status = SEND_STATUS_SUCCESS
+		}
+		mail_sender.runAfterSendHooks(ctx, event)
+	}()
+	if err = mail_sender.runBeforeSendHooks(ctx, event); err != nil {
+		return
+	}
+	return mail_sender.sendMail(ctx, event)
+}
+
+func (mail_sender *MailSender) sendMail(ctx context.Context, event *SendEvent) (err error) {
+	// 发件人名称和标题含非 ASCII 字符时按 RFC 2047 编码，纯文本和 MIME 格式共用
 	header := make(map[string]string)
-	header["From"] = mail_sender.sender_username + "<" + mail_sender.sender + ">"
-	header["To"] = strings.Join(mail_sender.receiver, ",")
-	header["Subject"] = mail_title
+	header["From"] = (&net_mail.Address{Name: mail_sender.sender_username, Address: mail_sender.sender}).String()
+	header["To"] = strings.Join(event.Receivers, ",")
+	header["Subject"] = mime.BEncoding.Encode("UTF-8", event.Title)
 	header["Content-Type"] = mail_sender.content_type
 	message := ""
-	for k, v := range header {
-		message += fmt.Sprintf("%s: %s\r\n", k, v)
+	if event.HTML != "" || len(event.Inlines) > 0 || len(event.Attachments) > 0 {
+		message_bytes, err := mail_sender.buildMIMEMessage(header, event)
+		if err != nil {
+			return err
+		}
+		message = string(message_bytes)
+	} else {
+		for k, v := range header {
+			message += fmt.Sprintf("%s: %s\r\n", k, v)
+		}
+		message += "\r\n" + event.Content
 	}
-	message += "\r\n" + mail_content
 	auth := smtp.PlainAuth(
 		"",
 		mail_sender.auth_user,
 		mail_sender.auth_password,
 		mail_sender.server_address,
 	)
+	if mail_sender.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, mail_sender.timeout)
+		defer cancel()
+	}
 	err = send_mail_using_tls(
-		fmt.Sprintf("%s:%d", mail_sender.server_address, mail_sender.server_port),
+		ctx,
+		event.ServerAddress,
+		mail_sender.tls_config,
 		auth,
 		mail_sender.sender,
-		mail_sender.receiver,
+		event.Receivers,
 		[]byte(message),
 	)
 	if err != nil {
@@ -141,12 +227,50 @@ func (mail_sender *MailSender) SendMail(mail_title string, mail_content string)
 	return
 }
 
+// 渲染模板后发送邮件，模板需要使用 {{define "title"}}...{{end}} 定义邮件标题
+func (mail_sender *MailSender) SendTemplate(name string, data any) (err error) {
+	registry := mail_sender.template_registry
+	if registry == nil {
+		registry = message_template.DefaultRegistry
+	}
+	mail_title, mail_content, err := registry.RenderMessage(name, data)
+	if err != nil {
+		return
+	}
+	if mail_title == "" {
+		return fmt.Errorf("模板 %s 未定义 %s", name, message_template.TEMPLATE_BLOCK_TITLE)
+	}
+	return mail_sender.SendMail(mail_title, mail_content)
+}
+
+// 实现 notify.Channel 接口
+func (mail_sender *MailSender) Notify(title string, content string) error {
+	return mail_sender.SendMail(title, content)
+}
+
 // 参考 net/smtp 的func SendMail()
 // 使用 net.Dial 连接 tls（SSL） 端口时，smtp.NewClient()会卡住且不提示err
 // len(to)>1时，to[1]开始提示是密送
-func send_mail_using_tls(addr string, auth smtp.Auth, from string, to []string, msg []byte) (err error) {
-	c, err := smtp_dial(addr)
+func send_mail_using_tls(ctx context.Context, addr string, tls_config *tls.Config, auth smtp.Auth, from string, to []string, msg []byte) (err error) {
+	conn, err := smtp_dial_context(ctx, addr, tls_config)
+	if err != nil {
+		return err
+	}
+	// ctx 取消时关闭连接，中断阻塞中的读写
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	defer func() {
+		if err != nil && ctx.Err() != nil {
+			err = ctx.Err()
+		}
+	}()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	host, _, _ := net.SplitHostPort(addr)
+	c, err := smtp.NewClient(conn, host)
 	if err != nil {
+		conn.Close()
 		return err
 	}
 	defer c.Close()
@@ -180,13 +304,10 @@ func send_mail_using_tls(addr string, auth smtp.Auth, from string, to []string,
 	return c.Quit()
 }
 
-func smtp_dial(addr string) (*smtp.Client, error) {
-	conn, err := tls.Dial("tcp", addr, nil)
-	if err != nil {
-		return nil, err
-	}
-	host, _, _ := net.SplitHostPort(addr)
-	return smtp.NewClient(conn, host)
+// 建立 TLS 连接，ctx 控制连接和握手的超时
+func smtp_dial_context(ctx context.Context, addr string, tls_config *tls.Config) (net.Conn, error) {
+	dialer := &tls.Dialer{Config: tls_config}
+	return dialer.DialContext(ctx, "tcp", addr)
 }
 
 // 单次调用，发送邮件
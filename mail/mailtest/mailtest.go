@@ -0,0 +1,307 @@
+// 模拟 SMTP 服务端（隐式 TLS，即 465 端口的 SSL 方式），用于离线测试
+//
+//	server := mailtest.NewServer(mailtest.WithAuth("user@example.com", "password"))
+//	defer server.Close()
+//	mail_sender := mail.New(server.Addr(), "user@example.com", "password", mail.WithTLSConfig(server.ClientTLSConfig()))
+package mailtest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"io"
+	"math/big"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 服务端收到的邮件
+type Mail struct {
+	AuthUser string   // 认证用户名，未认证时为空
+	From     string   // MAIL FROM 地址
+	To       []string // RCPT TO 地址
+	Data     []byte   // 邮件原文，包含邮件头
+}
+
+// 模拟服务端
+type Server struct {
+	listener      net.Listener
+	certificate   *x509.Certificate
+	auth_user     string
+	auth_password string
+	reject        map[string]bool
+	delay         time.Duration
+	done          chan struct{}
+	mutex         sync.Mutex
+	mails         []Mail
+	wait_group    sync.WaitGroup
+}
+
+type OptionFunc func(*Server)
+
+func initOptions(options ...OptionFunc) *Server {
+	server := &Server{
+		reject: map[string]bool{},
+		mails:  []Mail{},
+		done:   make(chan struct{}),
+	}
+	for _, option_func := range options {
+		option_func(server)
+	}
+	return server
+}
+
+// 要求客户端使用 AUTH PLAIN / LOGIN 认证，未指定时不校验
+func WithAuth(auth_user string, auth_password string) OptionFunc {
+	return func(server *Server) {
+		server.auth_user = auth_user
+		server.auth_password = auth_password
+	}
+}
+
+// 拒绝指定的收件人，RCPT TO 返回 550
+func WithRejectReceiver(receiver ...string) OptionFunc {
+	return func(server *Server) {
+		for _, s := range receiver {
+			server.reject[strings.ToLower(s)] = true
+		}
+	}
+}
+
+// 每条响应延迟 d 后发送，用于模拟响应缓慢或卡住的服务端
+func WithResponseDelay(d time.Duration) OptionFunc {
+	return func(server *Server) {
+		server.delay = d
+	}
+}
+
+// 启动服务端，监听 127.0.0.1 的随机端口，证书在运行时自签名生成
+func NewServer(options ...OptionFunc) *Server {
+	server := initOptions(options...)
+	certificate, err := generateCertificate()
+	if err != nil {
+		panic("mailtest: 生成证书失败: " + err.Error())
+	}
+	server.certificate = certificate.Leaf
+	server.listener, err = tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{certificate}})
+	if err != nil {
+		panic("mailtest: 监听端口失败: " + err.Error())
+	}
+	server.wait_group.Add(1)
+	go server.serve()
+	return server
+}
+
+// 服务端地址，格式为 127.0.0.1:port，可直接传给 mail.New
+func (server *Server) Addr() string {
+	return server.listener.Addr().String()
+}
+
+// 信任自签名证书的客户端 TLS 配置，用于 mail.WithTLSConfig
+func (server *Server) ClientTLSConfig() *tls.Config {
+	pool := x509.NewCertPool()
+	pool.AddCert(server.certificate)
+	return &tls.Config{RootCAs: pool}
+}
+
+// 获取收到的所有邮件
+func (server *Server) Mails() []Mail {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return append([]Mail{}, server.mails...)
+}
+
+// 清空已记录的邮件
+func (server *Server) Reset() {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.mails = []Mail{}
+}
+
+// 关闭服务端并等待所有连接处理结束
+func (server *Server) Close() {
+	close(server.done)
+	server.listener.Close()
+	server.wait_group.Wait()
+}
+
+func (server *Server) serve() {
+	defer server.wait_group.Done()
+	for {
+		conn, err := server.listener.Accept()
+		if err != nil {
+			return
+		}
+		server.wait_group.Add(1)
+		go func() {
+			defer server.wait_group.Done()
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(30 * time.Second))
+			server.handle(textproto.NewConn(&delayConn{Conn: conn, server: server}))
+		}()
+	}
+}
+
+// 写入前按 WithResponseDelay 延迟，服务端关闭时立即返回
+type delayConn struct {
+	net.Conn
+	server *Server
+}
+
+func (delay_conn *delayConn) Write(b []byte) (int, error) {
+	if delay_conn.server.delay > 0 {
+		select {
+		case <-time.After(delay_conn.server.delay):
+		case <-delay_conn.server.done:
+			return 0, net.ErrClosed
+		}
+	}
+	return delay_conn.Conn.Write(b)
+}
+
+// 处理单个 SMTP 会话，仅实现客户端发信所需的命令
+func (server *Server) handle(conn *textproto.Conn) {
+	var auth_user string
+	var mail *Mail
+	conn.PrintfLine("220 mailtest ESMTP ready")
+	for {
+		line, err := conn.ReadLine()
+		if err != nil {
+			return
+		}
+		command, argument, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(command) {
+		case "EHLO", "HELO":
+			conn.PrintfLine("250-mailtest\r\n250-AUTH PLAIN LOGIN\r\n250-8BITMIME\r\n250 SIZE 10485760")
+		case "AUTH":
+			auth_user = server.auth(conn, argument)
+		case "MAIL":
+			if server.auth_user != "" && auth_user == "" {
+				conn.PrintfLine("530 5.7.0 Authentication required")
+				continue
+			}
+			mail = &Mail{AuthUser: auth_user, From: parseAddress(argument), To: []string{}}
+			conn.PrintfLine("250 2.1.0 OK")
+		case "RCPT":
+			if mail == nil {
+				conn.PrintfLine("503 5.5.1 Need MAIL command")
+				continue
+			}
+			address := parseAddress(argument)
+			if server.reject[strings.ToLower(address)] {
+				conn.PrintfLine("550 5.1.1 Mailbox unavailable")
+				continue
+			}
+			mail.To = append(mail.To, address)
+			conn.PrintfLine("250 2.1.5 OK")
+		case "DATA":
+			if mail == nil || len(mail.To) == 0 {
+				conn.PrintfLine("503 5.5.1 Need RCPT command")
+				continue
+			}
+			conn.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			data, err := io.ReadAll(conn.DotReader())
+			if err != nil {
+				return
+			}
+			mail.Data = data
+			server.mutex.Lock()
+			server.mails = append(server.mails, *mail)
+			server.mutex.Unlock()
+			mail = nil
+			conn.PrintfLine("250 2.0.0 OK queued")
+		case "RSET":
+			mail = nil
+			conn.PrintfLine("250 2.0.0 OK")
+		case "NOOP":
+			conn.PrintfLine("250 2.0.0 OK")
+		case "QUIT":
+			conn.PrintfLine("221 2.0.0 Bye")
+			return
+		default:
+			conn.PrintfLine("502 5.5.2 Command not recognized")
+		}
+	}
+}
+
+// 处理 AUTH 命令，认证成功时返回用户名
+func (server *Server) auth(conn *textproto.Conn, argument string) (auth_user string) {
+	mechanism, initial_response, _ := strings.Cut(argument, " ")
+	var user, password string
+	switch strings.ToUpper(mechanism) {
+	case "PLAIN":
+		if initial_response == "" {
+			conn.PrintfLine("334 ")
+			initial_response, _ = conn.ReadLine()
+		}
+		decoded, _ := base64.StdEncoding.DecodeString(initial_response)
+		// 格式为 authzid\x00authcid\x00password
+		if parts := strings.Split(string(decoded), "\x00"); len(parts) == 3 {
+			user, password = parts[1], parts[2]
+		}
+	case "LOGIN":
+		conn.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte("Username:")))
+		line, _ := conn.ReadLine()
+		decoded, _ := base64.StdEncoding.DecodeString(line)
+		user = string(decoded)
+		conn.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte("Password:")))
+		line, _ = conn.ReadLine()
+		decoded, _ = base64.StdEncoding.DecodeString(line)
+		password = string(decoded)
+	default:
+		conn.PrintfLine("504 5.5.4 Unrecognized authentication type")
+		return
+	}
+	if user == "" || (server.auth_user != "" && (user != server.auth_user || password != server.auth_password)) {
+		conn.PrintfLine("535 5.7.8 Authentication credentials invalid")
+		return ""
+	}
+	conn.PrintfLine("235 2.7.0 Authentication successful")
+	return user
+}
+
+// 解析 "FROM:<a@b.com> SIZE=100" 格式的参数
+func parseAddress(argument string) string {
+	_, address, _ := strings.Cut(argument, ":")
+	address = strings.TrimSpace(address)
+	if i := strings.Index(address, ">"); i >= 0 {
+		address = address[:i]
+	}
+	return strings.TrimPrefix(address, "<")
+}
+
+// 生成 127.0.0.1 和 localhost 的自签名证书
+func generateCertificate() (certificate tls.Certificate, err error) {
+	private_key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{Organization: []string{"mailtest"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &private_key.PublicKey, private_key)
+	if err != nil {
+		return
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: private_key, Leaf: leaf}, nil
+}
@@ -0,0 +1,220 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+
+	"github.com/SimoLin/go-utils/text_drawer"
+)
+
+// 邮件消息，支持同时发送纯文本和 HTML 正文、HTML 内嵌图片和附件
+//
+//	message := mail.NewMessage("每日报表").
+//		SetText("CPU 使用率见附图").
+//		SetHTML(`<p>CPU 使用率</p><img src="cid:chart">`).
+//		Embed(chart).
+//		Attach(report)
+//	mail_sender.SendMessage(message)
+//
+//	邮件结构为 multipart/mixed(multipart/related(multipart/alternative(text/plain, text/html), 内嵌图片), 附件)
+//	仅有一种正文、没有内嵌图片或附件时省略对应的层级
+type Message struct {
+	Title       string        // 邮件标题
+	Text        string        // 纯文本正文，同时指定 HTML 时作为纯文本备选
+	HTML        string        // HTML 正文，使用 <img src="cid:content_id"> 引用内嵌图片
+	Inlines     []*Attachment // 内嵌图片，需要指定 ContentID
+	Attachments []*Attachment // 附件
+}
+
+func NewMessage(title string) *Message {
+	return &Message{Title: title}
+}
+
+// 设置纯文本正文
+func (message *Message) SetText(s string) *Message {
+	message.Text = s
+	return message
+}
+
+// 设置 HTML 正文
+func (message *Message) SetHTML(s string) *Message {
+	message.HTML = s
+	return message
+}
+
+// 添加内嵌图片，attachment.ContentID 对应 HTML 中的 cid:content_id
+func (message *Message) Embed(attachments ...*Attachment) *Message {
+	message.Inlines = append(message.Inlines, attachments...)
+	return message
+}
+
+// 添加附件
+func (message *Message) Attach(attachments ...*Attachment) *Message {
+	message.Attachments = append(message.Attachments, attachments...)
+	return message
+}
+
+// 将 text_drawer 等生成的图片转换为 jpg 格式的内嵌图片，文件名为 content_id.jpg
+func NewInlineImage(content_id string, rgba image.Image) (attachment *Attachment, err error) {
+	image_bytes := text_drawer.ImageToByte(rgba)
+	if len(image_bytes) == 0 {
+		return nil, fmt.Errorf("内嵌图片 %s 编码失败", content_id)
+	}
+	return NewInlineAttachment(content_id, content_id+".jpg", image_bytes, "image/jpeg"), nil
+}
+
+// 使用字节创建内嵌图片，content_type 为空时按文件扩展名和内容识别
+func NewInlineAttachment(content_id string, filename string, data []byte, content_type string) *Attachment {
+	attachment := NewAttachment(filename, data, content_type)
+	attachment.ContentID = content_id
+	return attachment
+}
+
+// 发送邮件消息
+func (mail_sender *MailSender) SendMessage(message *Message) (err error) {
+	return mail_sender.SendMessageContext(context.Background(), message)
+}
+
+// 发送邮件消息，ctx 取消或超时时中断发送
+func (mail_sender *MailSender) SendMessageContext(ctx context.Context, message *Message) (err error) {
+	if message.Text == "" && message.HTML == "" {
+		return errors.New("邮件正文为空")
+	}
+	for _, attachment := range message.Inlines {
+		if attachment.ContentID == "" {
+			return fmt.Errorf("内嵌图片 %s 未指定 ContentID", attachment.Filename)
+		}
+	}
+	event := mail_sender.newSendEvent(message.Title, message.Text)
+	event.HTML = message.HTML
+	event.Inlines = message.Inlines
+	event.Attachments = message.Attachments
+	return mail_sender.send(ctx, event)
+}
+
+// MIME 节点，叶子节点使用 base64 传输编码，非叶子节点为 multipart 类型
+type mimeNode struct {
+	header         textproto.MIMEHeader
+	data           []byte
+	multipart_type string
+	children       []*mimeNode
+}
+
+func newMIMELeaf(header textproto.MIMEHeader, data []byte) *mimeNode {
+	return &mimeNode{header: header, data: data}
+}
+
+// 子节点只有一个时不需要 multipart 层级
+func newMIMEMultipart(multipart_type string, children ...*mimeNode) *mimeNode {
+	if len(children) == 1 {
+		return children[0]
+	}
+	return &mimeNode{
+		header:         textproto.MIMEHeader{},
+		multipart_type: multipart_type,
+		children:       children,
+	}
+}
+
+// 生成节点的头部和内容
+func (node *mimeNode) build() (header textproto.MIMEHeader, body []byte, err error) {
+	buffer := new(bytes.Buffer)
+	if node.multipart_type == "" {
+		node.header.Set("Content-Transfer-Encoding", "base64")
+		writeBase64(buffer, node.data)
+		return node.header, buffer.Bytes(), nil
+	}
+	writer := multipart.NewWriter(buffer)
+	for _, child := range node.children {
+		child_header, child_body, err := child.build()
+		if err != nil {
+			return nil, nil, err
+		}
+		part, err := writer.CreatePart(child_header)
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, err = part.Write(child_body); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err = writer.Close(); err != nil {
+		return
+	}
+	node.header.Set("Content-Type", mime.FormatMediaType(node.multipart_type, map[string]string{"boundary": writer.Boundary()}))
+	return node.header, buffer.Bytes(), nil
+}
+
+// 按正文、内嵌图片和附件生成 MIME 结构
+func (mail_sender *MailSender) buildMIMETree(event *SendEvent) (root *mimeNode, err error) {
+	bodies := []*mimeNode{}
+	if event.Content != "" || event.HTML == "" {
+		// 指定 HTML 时 Content 作为纯文本备选，否则使用 WithContentType 指定的类型
+		content_type := mail_sender.content_type
+		if event.HTML != "" {
+			content_type = "text/plain; charset=UTF-8"
+		}
+		bodies = append(bodies, newMIMELeaf(textproto.MIMEHeader{"Content-Type": {content_type}}, []byte(event.Content)))
+	}
+	if event.HTML != "" {
+		bodies = append(bodies, newMIMELeaf(textproto.MIMEHeader{"Content-Type": {"text/html; charset=UTF-8"}}, []byte(event.HTML)))
+	}
+	root = newMIMEMultipart("multipart/alternative", bodies...)
+
+	if len(event.Inlines) > 0 {
+		related := []*mimeNode{root}
+		for _, attachment := range event.Inlines {
+			node, err := newAttachmentNode(attachment, "inline")
+			if err != nil {
+				return nil, err
+			}
+			node.header.Set("Content-ID", "<"+attachment.ContentID+">")
+			related = append(related, node)
+		}
+		root = newMIMEMultipart("multipart/related", related...)
+	}
+
+	if len(event.Attachments) > 0 {
+		mixed := []*mimeNode{root}
+		for _, attachment := range event.Attachments {
+			node, err := newAttachmentNode(attachment, "attachment")
+			if err != nil {
+				return nil, err
+			}
+			mixed = append(mixed, node)
+		}
+		root = newMIMEMultipart("multipart/mixed", mixed...)
+	}
+	return
+}
+
+// 生成 MIME 格式的邮件内容，header 中的发件人和标题已按 RFC 2047 编码
+func (mail_sender *MailSender) buildMIMEMessage(header map[string]string, event *SendEvent) (message []byte, err error) {
+	root, err := mail_sender.buildMIMETree(event)
+	if err != nil {
+		return
+	}
+	root_header, body, err := root.build()
+	if err != nil {
+		return
+	}
+	buffer := new(bytes.Buffer)
+	for _, k := range []string{"From", "To", "Subject"} {
+		fmt.Fprintf(buffer, "%s: %s\r\n", k, header[k])
+	}
+	buffer.WriteString("MIME-Version: 1.0\r\n")
+	for _, k := range []string{"Content-Type", "Content-Transfer-Encoding"} {
+		if v := root_header.Get(k); v != "" {
+			fmt.Fprintf(buffer, "%s: %s\r\n", k, v)
+		}
+	}
+	buffer.WriteString("\r\n")
+	buffer.Write(body)
+	return buffer.Bytes(), nil
+}
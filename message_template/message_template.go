@@ -0,0 +1,315 @@
+// 消息模板，使用 text/template 按名称注册和渲染 webhook、邮件的消息内容
+//
+//	模板中可使用 {{define "title"}}...{{end}} 定义标题，RenderMessage 同时返回标题和内容
+//
+//	message_template.MustRegister("alert", `{{define "title"}}[{{.level | upper}}] {{.host}}{{end}}`+
+//		"主机: {{.host}}\n指标: {{get \"metric.name\" .}} = {{get \"metric.value\" .}}\n时间: {{datetime \"\" .time}}\n"+
+//		"详情: {{.message | truncate 200}}\n[Runbook]({{.runbook}})")
+//	webhook_sender.SendTemplate(webhook.MESSAGE_TYPE_MARKDOWN, "alert", data)
+package message_template
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/SimoLin/go-utils/common"
+)
+
+// 模板中定义标题的名称
+const TEMPLATE_BLOCK_TITLE = "title"
+
+// 默认的时间格式
+const DEFAULT_DATETIME_LAYOUT = "2006-01-02 15:04:05"
+
+// 模板注册表
+type Registry struct {
+	mutex     sync.RWMutex
+	templates map[string]*template.Template
+	funcs     template.FuncMap
+	options   []string
+}
+
+type OptionFunc func(*Registry)
+
+func initOptions(options ...OptionFunc) *Registry {
+	registry := &Registry{
+		templates: map[string]*template.Template{},
+		funcs:     FuncMap(),
+		options:   []string{},
+	}
+	for _, option_func := range options {
+		option_func(registry)
+	}
+	return registry
+}
+
+// 添加或覆盖模板函数
+func WithFuncs(funcs template.FuncMap) OptionFunc {
+	return func(registry *Registry) {
+		for k, v := range funcs {
+			registry.funcs[k] = v
+		}
+	}
+}
+
+// 指定 text/template 的 Option，例如 "missingkey=error"
+func WithTemplateOption(s ...string) OptionFunc {
+	return func(registry *Registry) {
+		registry.options = append(registry.options, s...)
+	}
+}
+
+func New(options ...OptionFunc) *Registry {
+	return initOptions(options...)
+}
+
+// 默认注册表，包级别的 Register、Render 使用此注册表
+var DefaultRegistry = New()
+
+// 注册模板，同名模板会被覆盖
+func (registry *Registry) Register(name string, text string) (err error) {
+	registry.mutex.RLock()
+	parsed_template, err := template.New(name).Funcs(registry.funcs).Option(registry.options...).Parse(text)
+	registry.mutex.RUnlock()
+	if err != nil {
+		return fmt.Errorf("解析模板 %s 失败: %w", name, err)
+	}
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	registry.templates[name] = parsed_template
+	return
+}
+
+// 注册模板，解析失败时 panic，用于包初始化
+func (registry *Registry) MustRegister(name string, text string) {
+	if err := registry.Register(name, text); err != nil {
+		panic(err)
+	}
+}
+
+// 是否已注册模板
+func (registry *Registry) Has(name string) bool {
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+	_, ok := registry.templates[name]
+	return ok
+}
+
+// 获取已注册的模板名称，按字母排序
+func (registry *Registry) Names() (names []string) {
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+	for name := range registry.templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+func (registry *Registry) get(name string) (parsed_template *template.Template, err error) {
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+	parsed_template, ok := registry.templates[name]
+	if !ok {
+		return nil, fmt.Errorf("模板不存在: %s", name)
+	}
+	return
+}
+
+// 渲染模板内容，data 可以是 map[string]any 或结构体
+func (registry *Registry) Render(name string, data any) (content string, err error) {
+	parsed_template, err := registry.get(name)
+	if err != nil {
+		return
+	}
+	return execute(parsed_template, data)
+}
+
+// 渲染模板的标题和内容，模板未定义 title 时标题为空字符串
+func (registry *Registry) RenderMessage(name string, data any) (title string, content string, err error) {
+	parsed_template, err := registry.get(name)
+	if err != nil {
+		return
+	}
+	if title_template := parsed_template.Lookup(TEMPLATE_BLOCK_TITLE); title_template != nil {
+		if title, err = execute(title_template, data); err != nil {
+			return
+		}
+		title = strings.TrimSpace(title)
+	}
+	content, err = execute(parsed_template, data)
+	return
+}
+
+func execute(parsed_template *template.Template, data any) (string, error) {
+	buffer := new(bytes.Buffer)
+	if err := parsed_template.Execute(buffer, data); err != nil {
+		return "", fmt.Errorf("渲染模板 %s 失败: %w", parsed_template.Name(), err)
+	}
+	return buffer.String(), nil
+}
+
+// 使用默认注册表注册模板
+func Register(name string, text string) error {
+	return DefaultRegistry.Register(name, text)
+}
+
+// 使用默认注册表注册模板，解析失败时 panic
+func MustRegister(name string, text string) {
+	DefaultRegistry.MustRegister(name, text)
+}
+
+// 使用默认注册表渲染模板
+func Render(name string, data any) (string, error) {
+	return DefaultRegistry.Render(name, data)
+}
+
+// 使用默认注册表渲染模板的标题和内容
+func RenderMessage(name string, data any) (title string, content string, err error) {
+	return DefaultRegistry.RenderMessage(name, data)
+}
+
+// 模板函数
+//
+//	datetime "layout" v : 格式化时间，v 可以是 time.Time、秒/毫秒时间戳或时间字符串，layout 为空时使用 2006-01-02 15:04:05
+//	now                 : 当前时间
+//	truncate n s        : 按字符截断，超出时以 ... 结尾
+//	get "a.b.c" data    : 按路径读取 map 或结构体的值，返回字符串，不存在时为空字符串
+//	default d v         : v 为空值时返回 d
+//	join sep list       : 连接切片
+//	json v              : 转换为 JSON 字符串
+//	upper/lower/trim    : 字符串处理
+func FuncMap() template.FuncMap {
+	return template.FuncMap{
+		"datetime": FormatDatetime,
+		"now":      time.Now,
+		"truncate": Truncate,
+		"get":      GetValue,
+		"default":  defaultValue,
+		"join":     join,
+		"json":     toJSON,
+		"upper":    strings.ToUpper,
+		"lower":    strings.ToLower,
+		"trim":     strings.TrimSpace,
+	}
+}
+
+// 格式化时间，无法识别的值原样返回
+func FormatDatetime(layout string, v any) string {
+	if layout == "" {
+		layout = DEFAULT_DATETIME_LAYOUT
+	}
+	var t time.Time
+	switch value := v.(type) {
+	case time.Time:
+		t = value
+	case *time.Time:
+		if value == nil {
+			return ""
+		}
+		t = *value
+	case int:
+		t = unixTime(int64(value))
+	case int64:
+		t = unixTime(value)
+	case float64:
+		t = unixTime(int64(value))
+	case json.Number:
+		i, err := value.Int64()
+		if err != nil {
+			return value.String()
+		}
+		t = unixTime(i)
+	case string:
+		parsed := false
+		for _, parse_layout := range []string{time.RFC3339Nano, DEFAULT_DATETIME_LAYOUT, "2006-01-02"} {
+			if parsed_time, err := time.ParseInLocation(parse_layout, value, time.Local); err == nil {
+				t, parsed = parsed_time, true
+				break
+			}
+		}
+		if !parsed {
+			return value
+		}
+	case nil:
+		return ""
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+	return t.Format(layout)
+}
+
+// 大于 1e12 视为毫秒时间戳
+func unixTime(i int64) time.Time {
+	if i > 1e12 {
+		return time.UnixMilli(i)
+	}
+	return time.Unix(i, 0)
+}
+
+// 按字符截断，超出 n 个字符时保留前 n 个字符并以 ... 结尾
+func Truncate(n int, v any) string {
+	s, ok := v.(string)
+	if !ok {
+		s = fmt.Sprintf("%v", v)
+	}
+	if n <= 0 || utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n]) + "..."
+}
+
+// 按路径读取值，data 为结构体时先转换为 map
+func GetValue(path string, data any) string {
+	m, ok := data.(map[string]any)
+	if !ok {
+		m = map[string]any{}
+		data_bytes, err := json.Marshal(data)
+		if err != nil || json.Unmarshal(data_bytes, &m) != nil {
+			return ""
+		}
+	}
+	return common.MapGetValueToString(m, path)
+}
+
+func defaultValue(d any, v any) any {
+	switch value := v.(type) {
+	case nil:
+		return d
+	case string:
+		if value == "" {
+			return d
+		}
+	case int:
+		if value == 0 {
+			return d
+		}
+	case bool:
+		if !value {
+			return d
+		}
+	}
+	return v
+}
+
+func join(sep string, v any) string {
+	switch value := v.(type) {
+	case []string:
+		return strings.Join(value, sep)
+	case []any:
+		return common.SliceToJoinString(value, sep)
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+func toJSON(v any) (string, error) {
+	data, err := json.Marshal(v)
+	return string(data), err
+}
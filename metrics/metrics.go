@@ -0,0 +1,334 @@
+// 计数器和直方图指标，以 Prometheus 文本格式通过 http.Handler 暴露
+//
+//	registry := metrics.NewRegistry()
+//	send_metrics := metrics.MustNewSendMetrics(registry)
+//	webhook_sender := webhook.New(key, webhook.WithAfterSend(send_metrics.WebhookHook()))
+//	http.Handle("/metrics", registry.Handler())
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Prometheus 文本格式的 Content-Type
+const CONTENT_TYPE_PROMETHEUS = "text/plain; version=0.0.4; charset=utf-8"
+
+// 直方图默认的桶上限，单位为秒
+var DEFAULT_BUCKETS = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+var (
+	regexp_metric_name = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	regexp_label_name  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// 标签值之间的分隔符，用于生成序列的 key
+const label_separator = "\xff"
+
+type collector interface {
+	write(buffer *bytes.Buffer)
+}
+
+// 指标注册表
+type Registry struct {
+	mutex      sync.RWMutex
+	names      []string
+	collectors map[string]collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		names:      []string{},
+		collectors: map[string]collector{},
+	}
+}
+
+// 默认注册表
+var DefaultRegistry = NewRegistry()
+
+func (registry *Registry) register(name string, label_names []string, c collector) (err error) {
+	if !regexp_metric_name.MatchString(name) {
+		return fmt.Errorf("指标名称无效: %s", name)
+	}
+	for _, label_name := range label_names {
+		if !regexp_label_name.MatchString(label_name) || strings.HasPrefix(label_name, "__") || label_name == "le" {
+			return fmt.Errorf("指标 %s 的标签名称无效: %s", name, label_name)
+		}
+	}
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	if _, ok := registry.collectors[name]; ok {
+		return fmt.Errorf("指标已注册: %s", name)
+	}
+	registry.names = append(registry.names, name)
+	registry.collectors[name] = c
+	return
+}
+
+// 注册计数器，label_names 为标签名称
+func (registry *Registry) NewCounter(name string, help string, label_names ...string) (counter *Counter, err error) {
+	counter = &Counter{
+		name:        name,
+		help:        help,
+		label_names: label_names,
+		values:      map[string]*counterValue{},
+	}
+	if err = registry.register(name, label_names, counter); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// 注册计数器，失败时 panic
+func (registry *Registry) MustNewCounter(name string, help string, label_names ...string) *Counter {
+	counter, err := registry.NewCounter(name, help, label_names...)
+	if err != nil {
+		panic(err)
+	}
+	return counter
+}
+
+// 注册直方图，buckets 为空时使用 DEFAULT_BUCKETS
+func (registry *Registry) NewHistogram(name string, help string, buckets []float64, label_names ...string) (histogram *Histogram, err error) {
+	if len(buckets) == 0 {
+		buckets = DEFAULT_BUCKETS
+	}
+	buckets = append([]float64{}, buckets...)
+	sort.Float64s(buckets)
+	// +Inf 桶在输出时自动添加
+	if math.IsInf(buckets[len(buckets)-1], 1) {
+		buckets = buckets[:len(buckets)-1]
+	}
+	histogram = &Histogram{
+		name:        name,
+		help:        help,
+		label_names: label_names,
+		buckets:     buckets,
+		values:      map[string]*histogramValue{},
+	}
+	if err = registry.register(name, label_names, histogram); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// 注册直方图，失败时 panic
+func (registry *Registry) MustNewHistogram(name string, help string, buckets []float64, label_names ...string) *Histogram {
+	histogram, err := registry.NewHistogram(name, help, buckets, label_names...)
+	if err != nil {
+		panic(err)
+	}
+	return histogram
+}
+
+// 以 Prometheus 文本格式输出全部指标，按注册顺序输出
+func (registry *Registry) WriteText(w io.Writer) (err error) {
+	buffer := new(bytes.Buffer)
+	registry.mutex.RLock()
+	for _, name := range registry.names {
+		registry.collectors[name].write(buffer)
+	}
+	registry.mutex.RUnlock()
+	_, err = w.Write(buffer.Bytes())
+	return
+}
+
+// 以 Prometheus 文本格式暴露指标的 http.Handler
+func (registry *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", CONTENT_TYPE_PROMETHEUS)
+		registry.WriteText(w)
+	})
+}
+
+// 使用默认注册表暴露指标的 http.Handler
+func Handler() http.Handler {
+	return DefaultRegistry.Handler()
+}
+
+// 计数器
+type Counter struct {
+	name        string
+	help        string
+	label_names []string
+	mutex       sync.RWMutex
+	values      map[string]*counterValue
+}
+
+type counterValue struct {
+	label_values []string
+	value        float64
+}
+
+// 增加计数，v 不能为负数，label_values 的数量需要与注册时的标签名称一致
+func (counter *Counter) Add(v float64, label_values ...string) {
+	if v < 0 {
+		panic(fmt.Sprintf("计数器 %s 不能减少", counter.name))
+	}
+	key := labelKey(counter.name, counter.label_names, label_values)
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+	value, ok := counter.values[key]
+	if !ok {
+		value = &counterValue{label_values: append([]string{}, label_values...)}
+		counter.values[key] = value
+	}
+	value.value += v
+}
+
+// 计数加 1
+func (counter *Counter) Inc(label_values ...string) {
+	counter.Add(1, label_values...)
+}
+
+// 获取计数，序列不存在时为 0
+func (counter *Counter) Value(label_values ...string) float64 {
+	key := labelKey(counter.name, counter.label_names, label_values)
+	counter.mutex.RLock()
+	defer counter.mutex.RUnlock()
+	if value, ok := counter.values[key]; ok {
+		return value.value
+	}
+	return 0
+}
+
+func (counter *Counter) write(buffer *bytes.Buffer) {
+	writeHeader(buffer, counter.name, counter.help, "counter")
+	counter.mutex.RLock()
+	defer counter.mutex.RUnlock()
+	for _, key := range sortedKeys(counter.values) {
+		value := counter.values[key]
+		writeSample(buffer, counter.name, counter.label_names, value.label_values, "", "", value.value)
+	}
+}
+
+// 直方图
+type Histogram struct {
+	name        string
+	help        string
+	label_names []string
+	buckets     []float64
+	mutex       sync.RWMutex
+	values      map[string]*histogramValue
+}
+
+type histogramValue struct {
+	label_values  []string
+	bucket_counts []uint64 // 各桶的计数，不累加
+	count         uint64
+	sum           float64
+}
+
+// 记录观测值，label_values 的数量需要与注册时的标签名称一致
+func (histogram *Histogram) Observe(v float64, label_values ...string) {
+	key := labelKey(histogram.name, histogram.label_names, label_values)
+	histogram.mutex.Lock()
+	defer histogram.mutex.Unlock()
+	value, ok := histogram.values[key]
+	if !ok {
+		value = &histogramValue{
+			label_values:  append([]string{}, label_values...),
+			bucket_counts: make([]uint64, len(histogram.buckets)),
+		}
+		histogram.values[key] = value
+	}
+	if i := sort.SearchFloat64s(histogram.buckets, v); i < len(histogram.buckets) {
+		value.bucket_counts[i]++
+	}
+	value.count++
+	value.sum += v
+}
+
+// 获取观测次数和观测值之和，序列不存在时为 0
+func (histogram *Histogram) Snapshot(label_values ...string) (count uint64, sum float64) {
+	key := labelKey(histogram.name, histogram.label_names, label_values)
+	histogram.mutex.RLock()
+	defer histogram.mutex.RUnlock()
+	if value, ok := histogram.values[key]; ok {
+		return value.count, value.sum
+	}
+	return
+}
+
+func (histogram *Histogram) write(buffer *bytes.Buffer) {
+	writeHeader(buffer, histogram.name, histogram.help, "histogram")
+	histogram.mutex.RLock()
+	defer histogram.mutex.RUnlock()
+	for _, key := range sortedKeys(histogram.values) {
+		value := histogram.values[key]
+		cumulative := uint64(0)
+		for i, upper_bound := range histogram.buckets {
+			cumulative += value.bucket_counts[i]
+			writeSample(buffer, histogram.name+"_bucket", histogram.label_names, value.label_values, "le", formatFloat(upper_bound), float64(cumulative))
+		}
+		writeSample(buffer, histogram.name+"_bucket", histogram.label_names, value.label_values, "le", "+Inf", float64(value.count))
+		writeSample(buffer, histogram.name+"_sum", histogram.label_names, value.label_values, "", "", value.sum)
+		writeSample(buffer, histogram.name+"_count", histogram.label_names, value.label_values, "", "", float64(value.count))
+	}
+}
+
+func labelKey(name string, label_names []string, label_values []string) string {
+	if len(label_values) != len(label_names) {
+		panic(fmt.Sprintf("指标 %s 需要 %d 个标签值，实际为 %d 个", name, len(label_names), len(label_values)))
+	}
+	return strings.Join(label_values, label_separator)
+}
+
+func sortedKeys[V any](m map[string]V) (keys []string) {
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return
+}
+
+func writeHeader(buffer *bytes.Buffer, name string, help string, metric_type string) {
+	if help != "" {
+		fmt.Fprintf(buffer, "# HELP %s %s\n", name, escapeHelp(help))
+	}
+	fmt.Fprintf(buffer, "# TYPE %s %s\n", name, metric_type)
+}
+
+// 输出一行样本，extra_name 不为空时追加到标签末尾，用于直方图的 le 标签
+func writeSample(buffer *bytes.Buffer, name string, label_names []string, label_values []string, extra_name string, extra_value string, v float64) {
+	buffer.WriteString(name)
+	if len(label_names) > 0 || extra_name != "" {
+		labels := []string{}
+		for i, label_name := range label_names {
+			labels = append(labels, fmt.Sprintf(`%s="%s"`, label_name, escapeLabelValue(label_values[i])))
+		}
+		if extra_name != "" {
+			labels = append(labels, fmt.Sprintf(`%s="%s"`, extra_name, extra_value))
+		}
+		buffer.WriteString("{" + strings.Join(labels, ",") + "}")
+	}
+	buffer.WriteString(" " + formatFloat(v) + "\n")
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(s)
+}
@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"context"
+
+	"github.com/SimoLin/go-utils/mail"
+	"github.com/SimoLin/go-utils/webhook"
+)
+
+// 发送指标的渠道标签
+const (
+	CHANNEL_WEBHOOK = "webhook"
+	CHANNEL_MAIL    = "mail"
+)
+
+// webhook、邮件发送的计数和耗时指标
+//
+//	notify_send_total{channel, type, status}        发送次数，status 为 success | failure | vetoed
+//	notify_send_duration_seconds{channel, type}     发送耗时，不包括被拦截的发送
+//	notify_send_attempts_total{channel, type}       请求次数，包括重试
+//
+//	type 为 webhook 类型，邮件为 smtp
+type SendMetrics struct {
+	SendTotal    *Counter
+	SendDuration *Histogram
+	SendAttempts *Counter
+}
+
+// 在注册表中注册发送指标，buckets 为空时使用 DEFAULT_BUCKETS
+func NewSendMetrics(registry *Registry, buckets ...float64) (send_metrics *SendMetrics, err error) {
+	send_metrics = &SendMetrics{}
+	if send_metrics.SendTotal, err = registry.NewCounter(
+		"notify_send_total", "Total number of notification sends.", "channel", "type", "status",
+	); err != nil {
+		return nil, err
+	}
+	if send_metrics.SendDuration, err = registry.NewHistogram(
+		"notify_send_duration_seconds", "Notification send duration in seconds.", buckets, "channel", "type",
+	); err != nil {
+		return nil, err
+	}
+	if send_metrics.SendAttempts, err = registry.NewCounter(
+		"notify_send_attempts_total", "Total number of notification requests including retries.", "channel", "type",
+	); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// 在注册表中注册发送指标，失败时 panic
+func MustNewSendMetrics(registry *Registry, buckets ...float64) *SendMetrics {
+	send_metrics, err := NewSendMetrics(registry, buckets...)
+	if err != nil {
+		panic(err)
+	}
+	return send_metrics
+}
+
+func (send_metrics *SendMetrics) observe(channel string, send_type string, status string, seconds float64, attempts int) {
+	send_metrics.SendTotal.Inc(channel, send_type, status)
+	// webhook、mail 的状态取值相同
+	if status == webhook.SEND_STATUS_VETOED {
+		return
+	}
+	send_metrics.SendDuration.Observe(seconds, channel, send_type)
+	send_metrics.SendAttempts.Add(float64(attempts), channel, send_type)
+}
+
+// webhook.WithAfterSend 使用的钩子
+func (send_metrics *SendMetrics) WebhookHook() webhook.AfterSendHook {
+	return func(ctx context.Context, event *webhook.SendEvent) {
+		send_metrics.observe(CHANNEL_WEBHOOK, event.WebhookType, event.Status, event.Duration.Seconds(), event.Attempts)
+	}
+}
+
+// mail.WithAfterSend 使用的钩子
+func (send_metrics *SendMetrics) MailHook() mail.AfterSendHook {
+	return func(ctx context.Context, event *mail.SendEvent) {
+		send_metrics.observe(CHANNEL_MAIL, "smtp", event.Status, event.Duration.Seconds(), 1)
+	}
+}
@@ -0,0 +1,245 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var ErrDuplicateChannel = errors.New("通知渠道名称重复")
+
+// 告警级别
+type Severity int
+
+const (
+	SEVERITY_INFO Severity = iota
+	SEVERITY_WARNING
+	SEVERITY_ERROR
+	SEVERITY_CRITICAL
+)
+
+var DICT_SEVERITY_TO_STRING = map[Severity]string{
+	SEVERITY_INFO:     "INFO",
+	SEVERITY_WARNING:  "WARNING",
+	SEVERITY_ERROR:    "ERROR",
+	SEVERITY_CRITICAL: "CRITICAL",
+}
+
+func (severity Severity) String() string {
+	if s, ok := DICT_SEVERITY_TO_STRING[severity]; ok {
+		return s
+	}
+	return fmt.Sprintf("Severity(%d)", int(severity))
+}
+
+// 解析告警级别，不区分大小写，例如 "warning"
+func ParseSeverity(s string) (severity Severity, err error) {
+	for severity, severity_string := range DICT_SEVERITY_TO_STRING {
+		if strings.EqualFold(s, severity_string) {
+			return severity, nil
+		}
+	}
+	return SEVERITY_INFO, fmt.Errorf("告警级别格式错误: %s", s)
+}
+
+// 通知渠道，mail.MailSender 和 webhook.WebhookSender 均已实现
+type Channel interface {
+	Notify(title string, content string) error
+}
+
+// 通知消息
+type Message struct {
+	Title    string
+	Body     string
+	Severity Severity
+	Tags     []string
+}
+
+// 路由规则，告警级别不低于 MinSeverity 且包含任一 Tags 时匹配，Tags 为空时不限制标签
+type Route struct {
+	MinSeverity Severity
+	Tags        []string
+}
+
+func (route Route) Match(message *Message) bool {
+	if message.Severity < route.MinSeverity {
+		return false
+	}
+	if len(route.Tags) == 0 {
+		return true
+	}
+	for _, tag := range message.Tags {
+		if slices.Contains(route.Tags, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// 多个渠道发送失败时的错误，按渠道名称记录
+type NotifyError struct {
+	Errors map[string]error
+}
+
+func (notify_error *NotifyError) Error() string {
+	names := make([]string, 0, len(notify_error.Errors))
+	for name := range notify_error.Errors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	messages := make([]string, 0, len(names))
+	for _, name := range names {
+		messages = append(messages, fmt.Sprintf("%s: %v", name, notify_error.Errors[name]))
+	}
+	return "通知发送失败: " + strings.Join(messages, "; ")
+}
+
+func (notify_error *NotifyError) Unwrap() []error {
+	errs := make([]error, 0, len(notify_error.Errors))
+	for _, err := range notify_error.Errors {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+type namedChannel struct {
+	name    string
+	channel Channel
+	routes  []Route
+}
+
+// 将一条消息按路由规则发送到多个渠道
+type Notifier struct {
+	mutex     sync.RWMutex
+	channels  []namedChannel
+	formatter func(message *Message) (title string, content string)
+	err       error // WithChannel 添加渠道失败的错误，由 New 返回
+}
+
+type OptionFunc func(*Notifier)
+
+func initOptions(options ...OptionFunc) *Notifier {
+	notifier := &Notifier{
+		channels:  []namedChannel{},
+		formatter: DefaultFormatter,
+	}
+	for _, option_func := range options {
+		option_func(notifier)
+	}
+	return notifier
+}
+
+// 可指定消息格式化函数，为空时使用 DefaultFormatter
+func WithFormatter(f func(message *Message) (title string, content string)) OptionFunc {
+	return func(notifier *Notifier) {
+		notifier.formatter = f
+	}
+}
+
+// 可在创建时添加渠道，routes 为空时接收所有消息，名称重复时 New 返回 ErrDuplicateChannel
+func WithChannel(name string, channel Channel, routes ...Route) OptionFunc {
+	return func(notifier *Notifier) {
+		if err := notifier.AddChannel(name, channel, routes...); err != nil && notifier.err == nil {
+			notifier.err = err
+		}
+	}
+}
+
+func New(options ...OptionFunc) (notifier *Notifier, err error) {
+	notifier = initOptions(options...)
+	if notifier.err != nil {
+		return nil, notifier.err
+	}
+	return
+}
+
+// 默认格式化：标题前加告警级别，正文末尾附加标签
+func DefaultFormatter(message *Message) (title string, content string) {
+	title = fmt.Sprintf("[%s] %s", message.Severity, message.Title)
+	content = message.Body
+	if len(message.Tags) > 0 {
+		content += "\n\n标签: " + strings.Join(message.Tags, ", ")
+	}
+	return
+}
+
+// 添加渠道，routes 为空时接收所有消息，任一路由规则匹配即发送
+//
+//	发送失败的错误按渠道名称记录，名称已存在时返回 ErrDuplicateChannel
+func (notifier *Notifier) AddChannel(name string, channel Channel, routes ...Route) (err error) {
+	notifier.mutex.Lock()
+	defer notifier.mutex.Unlock()
+	for _, named_channel := range notifier.channels {
+		if named_channel.name == name {
+			return fmt.Errorf("%w: %s", ErrDuplicateChannel, name)
+		}
+	}
+	notifier.channels = append(notifier.channels, namedChannel{name: name, channel: channel, routes: routes})
+	return
+}
+
+// 获取消息匹配的渠道名称
+func (notifier *Notifier) Match(message *Message) (names []string) {
+	for _, named_channel := range notifier.match(message) {
+		names = append(names, named_channel.name)
+	}
+	return
+}
+
+func (notifier *Notifier) match(message *Message) (matched []namedChannel) {
+	notifier.mutex.RLock()
+	defer notifier.mutex.RUnlock()
+	for _, named_channel := range notifier.channels {
+		if len(named_channel.routes) == 0 {
+			matched = append(matched, named_channel)
+			continue
+		}
+		for _, route := range named_channel.routes {
+			if route.Match(message) {
+				matched = append(matched, named_channel)
+				break
+			}
+		}
+	}
+	return
+}
+
+// 并发发送到所有匹配的渠道，部分渠道失败时返回 *NotifyError
+func (notifier *Notifier) Notify(message *Message) (err error) {
+	title, content := notifier.formatter(message)
+	matched := notifier.match(message)
+
+	var mutex sync.Mutex
+	var wait_group sync.WaitGroup
+	errs := map[string]error{}
+	for _, named_channel := range matched {
+		wait_group.Add(1)
+		go func(named_channel namedChannel) {
+			defer wait_group.Done()
+			if err := named_channel.channel.Notify(title, content); err != nil {
+				mutex.Lock()
+				errs[named_channel.name] = err
+				mutex.Unlock()
+			}
+		}(named_channel)
+	}
+	wait_group.Wait()
+	if len(errs) > 0 {
+		return &NotifyError{Errors: errs}
+	}
+	return
+}
+
+// 发送消息，Notify 的简化调用
+func (notifier *Notifier) Send(title string, body string, severity Severity, tags ...string) error {
+	return notifier.Notify(&Message{Title: title, Body: body, Severity: severity, Tags: tags})
+}
+
+// 是否为渠道发送失败的错误
+func IsNotifyError(err error) bool {
+	var notify_error *NotifyError
+	return errors.As(err, &notify_error)
+}
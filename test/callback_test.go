@@ -0,0 +1,255 @@
+package test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SimoLin/go-utils/crypto"
+	"github.com/SimoLin/go-utils/hash"
+	"github.com/SimoLin/go-utils/webhook"
+	"github.com/SimoLin/go-utils/webhook/webhooktest"
+)
+
+func TestCallbackDingDing(t *testing.T) {
+	secret := "your_app_secret"
+	server := webhooktest.NewServer()
+	defer server.Close()
+
+	var received *webhook.CallbackMessage
+	callback_handler := webhook.NewCallbackHandler(webhook.WithCallbackDingDingSecret(secret))
+	callback_handler.Handle("/deploy", func(message *webhook.CallbackMessage) error {
+		received = message
+		return message.Reply("deploying " + strings.Join(message.Args, ","))
+	})
+	callback_server := httptest.NewServer(callback_handler)
+	defer callback_server.Close()
+
+	body, _ := json.Marshal(map[string]any{
+		"msgtype":        "text",
+		"text":           map[string]string{"content": " /deploy web api "},
+		"msgId":          "msg_id",
+		"senderNick":     "张三",
+		"senderStaffId":  "staff_id",
+		"conversationId": "cid",
+		"sessionWebhook": server.DingDingSessionWebhook("session_1"),
+	})
+	post := func(timestamp string, sign string) int {
+		r, _ := http.NewRequest(http.MethodPost, callback_server.URL, bytes.NewReader(body))
+		r.Header.Set("timestamp", timestamp)
+		r.Header.Set("sign", sign)
+		response, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		return response.StatusCode
+	}
+
+	timestamp := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	if status_code := post(timestamp, hash.HMACSHA256EncodeToBase64(timestamp+"\n"+secret, secret)); status_code != http.StatusOK {
+		t.Fatalf("status_code = %d", status_code)
+	}
+	if received == nil || received.Command != "/deploy" || received.SenderName != "张三" || len(received.Args) != 2 {
+		t.Fatalf("received = %+v", received)
+	}
+	request, _ := server.LastRequest()
+	if request.Key != "session_1" || request.Payload["text"].(map[string]any)["content"] != "deploying web,api" {
+		t.Error(request)
+	}
+
+	// 签名错误或时间戳过期
+	if status_code := post(timestamp, "wrong_sign"); status_code != http.StatusForbidden {
+		t.Errorf("status_code = %d, want 403", status_code)
+	}
+	expired := strconv.FormatInt(time.Now().Add(-2*time.Hour).UnixMilli(), 10)
+	if status_code := post(expired, hash.HMACSHA256EncodeToBase64(expired+"\n"+secret, secret)); status_code != http.StatusForbidden {
+		t.Errorf("status_code = %d, want 403", status_code)
+	}
+}
+
+// 按飞书的方式加密：base64(iv + AES-256-CBC(sha256(encrypt_key), iv, plain))
+func encryptFeiShuEvent(t *testing.T, plain []byte, encrypt_key string) string {
+	iv := make([]byte, 16)
+	rand.Read(iv)
+	key := sha256.Sum256([]byte(encrypt_key))
+	encrypted, err := crypto.AESEncryptCBCWithIV(plain, key[:], iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(append(iv, encrypted...))
+}
+
+func TestCallbackFeiShu(t *testing.T) {
+	token := "verification_token"
+	encrypt_key := "encrypt_key"
+	server := webhooktest.NewServer()
+	defer server.Close()
+	feishu_open_api_address := webhook.FEISHU_OPEN_API_ADDRESS
+	webhook.FEISHU_OPEN_API_ADDRESS = server.FeiShuOpenAPIAddress()
+	defer func() { webhook.FEISHU_OPEN_API_ADDRESS = feishu_open_api_address }()
+
+	count := 0
+	callback_handler := webhook.NewCallbackHandler(
+		webhook.WithCallbackFeiShu(token, encrypt_key),
+		webhook.WithCallbackFeiShuApp("app_id", "app_secret"),
+	)
+	callback_handler.HandleDefault(func(message *webhook.CallbackMessage) error {
+		count++
+		if message.Command != "/status" || message.SenderID != "ou_sender" || message.ConversationID != "oc_chat" {
+			t.Errorf("message = %+v", message)
+		}
+		return message.Reply("ok")
+	})
+	callback_server := httptest.NewServer(callback_handler)
+	defer callback_server.Close()
+
+	post_at := func(data any, signed bool, signed_at time.Time) (status_code int, response_data map[string]any) {
+		plain, _ := json.Marshal(data)
+		body, _ := json.Marshal(map[string]string{"encrypt": encryptFeiShuEvent(t, plain, encrypt_key)})
+		r, _ := http.NewRequest(http.MethodPost, callback_server.URL, bytes.NewReader(body))
+		if signed {
+			timestamp, nonce := strconv.FormatInt(signed_at.Unix(), 10), "nonce"
+			sum := sha256.Sum256([]byte(timestamp + nonce + encrypt_key + string(body)))
+			r.Header.Set("X-Lark-Request-Timestamp", timestamp)
+			r.Header.Set("X-Lark-Request-Nonce", nonce)
+			r.Header.Set("X-Lark-Signature", hex.EncodeToString(sum[:]))
+		}
+		response, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		json.NewDecoder(response.Body).Decode(&response_data)
+		return response.StatusCode, response_data
+	}
+	post := func(data any, signed bool) (status_code int, response_data map[string]any) {
+		return post_at(data, signed, time.Now())
+	}
+
+	// url_verification
+	status_code, response_data := post(map[string]string{"type": "url_verification", "challenge": "challenge_code", "token": token}, false)
+	if status_code != http.StatusOK || response_data["challenge"] != "challenge_code" {
+		t.Fatalf("status_code = %d, response = %v", status_code, response_data)
+	}
+	if status_code, _ = post(map[string]string{"type": "url_verification", "challenge": "c", "token": "wrong"}, false); status_code != http.StatusForbidden {
+		t.Errorf("status_code = %d, want 403", status_code)
+	}
+
+	// 消息事件，重推的 event_id 只处理一次
+	content, _ := json.Marshal(map[string]string{"text": "@_user_1 /status web"})
+	event := map[string]any{
+		"schema": "2.0",
+		"header": map[string]any{"event_id": "event_1", "event_type": "im.message.receive_v1", "token": token},
+		"event": map[string]any{
+			"sender": map[string]any{"sender_id": map[string]any{"open_id": "ou_sender"}},
+			"message": map[string]any{
+				"message_id":   "om_message",
+				"chat_id":      "oc_chat",
+				"message_type": "text",
+				"content":      string(content),
+			},
+		},
+	}
+	for i := 0; i < 2; i++ {
+		if status_code, _ = post(event, true); status_code != http.StatusOK {
+			t.Fatalf("status_code = %d", status_code)
+		}
+	}
+	if count != 1 {
+		t.Errorf("count = %d, want 1", count)
+	}
+	request, _ := server.LastRequest()
+	if request.Key != "om_message" || request.Payload["content"] != `{"text":"ok"}` {
+		t.Error(request)
+	}
+
+	// 签名时间戳超出 CALLBACK_TIMESTAMP_TOLERANCE 的重放请求
+	replayed_event := map[string]any{"schema": "2.0", "header": map[string]any{"event_id": "event_2", "event_type": "im.message.receive_v1", "token": token}, "event": event["event"]}
+	for _, signed_at := range []time.Time{time.Now().Add(-2 * webhook.CALLBACK_TIMESTAMP_TOLERANCE), time.Now().Add(2 * webhook.CALLBACK_TIMESTAMP_TOLERANCE)} {
+		if status_code, _ = post_at(replayed_event, true, signed_at); status_code != http.StatusForbidden {
+			t.Errorf("replayed event status_code = %d, want 403", status_code)
+		}
+	}
+	if count != 1 {
+		t.Errorf("count = %d, want 1", count)
+	}
+
+	// 加密事件缺少签名
+	if status_code, _ = post(event, false); status_code != http.StatusForbidden {
+		t.Errorf("unsigned event status_code = %d, want 403", status_code)
+	}
+
+	// 指定 encrypt_key 后不接受明文事件
+	plain_body, _ := json.Marshal(event)
+	plain_response, err := http.Post(callback_server.URL, "application/json", bytes.NewReader(plain_body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain_response.Body.Close()
+	if plain_response.StatusCode != http.StatusForbidden || count != 1 {
+		t.Errorf("plain event status_code = %d, count = %d", plain_response.StatusCode, count)
+	}
+
+	// 明文请求体签名错误
+	body, _ := json.Marshal(map[string]string{"encrypt": encryptFeiShuEvent(t, []byte("{}"), encrypt_key)})
+	r, _ := http.NewRequest(http.MethodPost, callback_server.URL, bytes.NewReader(body))
+	r.Header.Set("X-Lark-Signature", "wrong")
+	response, _ := http.DefaultClient.Do(r)
+	response.Body.Close()
+	if response.StatusCode != http.StatusForbidden {
+		t.Errorf("status_code = %d, want 403", response.StatusCode)
+	}
+}
+
+// 请求体超出 CALLBACK_MAX_BODY_SIZE 时返回 413，不缓存完整的请求体
+func TestCallbackBodyLimit(t *testing.T) {
+	callback_handler := webhook.NewCallbackHandler(webhook.WithCallbackFeiShu("token", ""))
+	executed := false
+	callback_handler.HandleDefault(func(message *webhook.CallbackMessage) error {
+		executed = true
+		return nil
+	})
+	body := `{"type":"url_verification","token":"token","challenge":"` + strings.Repeat("a", int(webhook.CALLBACK_MAX_BODY_SIZE)) + `"}`
+	recorder := httptest.NewRecorder()
+	callback_handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+	if recorder.Code != http.StatusRequestEntityTooLarge || executed {
+		t.Errorf("status_code = %d, executed = %v, want 413", recorder.Code, executed)
+	}
+}
+
+// 只处理已配置凭证的平台，其余请求返回 403
+func TestCallbackUnconfiguredPlatform(t *testing.T) {
+	content, _ := json.Marshal(map[string]string{"text": "/deploy"})
+	body, _ := json.Marshal(map[string]any{
+		"schema": "2.0",
+		"header": map[string]any{"event_id": "event_1", "event_type": "im.message.receive_v1"},
+		"event": map[string]any{
+			"message": map[string]any{"message_id": "om_message", "chat_id": "oc_chat", "message_type": "text", "content": string(content)},
+		},
+	})
+	for name, callback_handler := range map[string]*webhook.CallbackHandler{
+		"dingding": webhook.NewCallbackHandler(webhook.WithCallbackDingDingSecret("SECxxx")),
+		"empty":    webhook.NewCallbackHandler(),
+	} {
+		executed := false
+		callback_handler.Handle("/deploy", func(message *webhook.CallbackMessage) error {
+			executed = true
+			return nil
+		})
+		recorder := httptest.NewRecorder()
+		callback_handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body)))
+		if recorder.Code != http.StatusForbidden || executed {
+			t.Errorf("%s: status_code = %d, executed = %v", name, recorder.Code, executed)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/SimoLin/go-utils/mail/mailtest"
+	"github.com/SimoLin/go-utils/webhook/webhooktest"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// 编译 cmd/notify 后运行，返回退出码
+func runNotify(t *testing.T, binary string, stdin string, args ...string) (exit_code int, stderr string) {
+	cmd := exec.Command(binary, args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	cmd.Env = append(os.Environ(), "NOTIFY_CONFIG=")
+	var stderr_buffer bytes.Buffer
+	cmd.Stderr = &stderr_buffer
+	err := cmd.Run()
+	var exit_error *exec.ExitError
+	if errors.As(err, &exit_error) {
+		return exit_error.ExitCode(), stderr_buffer.String()
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	return 0, stderr_buffer.String()
+}
+
+func TestCmdNotify(t *testing.T) {
+	binary := filepath.Join(t.TempDir(), "notify")
+	if output, err := exec.Command("go", "build", "-o", binary, "../cmd/notify").CombinedOutput(); err != nil {
+		t.Skipf("go build failed: %v\n%s", err, output)
+	}
+	webhook_server := webhooktest.NewServer(webhooktest.WithKey("dingding_key", "dingding_secret"), webhooktest.WithKey("feishu_key", ""))
+	defer webhook_server.Close()
+	mail_server := mailtest.NewServer(mailtest.WithAuth("user@example.com", "password"))
+	defer mail_server.Close()
+
+	// webhook：从标准输入读取 markdown
+	exit_code, stderr := runNotify(t, binary, "# 日报\n- 正常\n",
+		"webhook", "--type", "dingding", "--key", "dingding_key", "--secret", "dingding_secret",
+		"--server", webhook_server.DingDingAddress(), "--title", "日报", "--at-mobile", "13800000000", "--markdown", "-")
+	if exit_code != 0 {
+		t.Fatalf("exit_code = %d, stderr = %s", exit_code, stderr)
+	}
+	request, _ := webhook_server.LastRequest()
+	markdown := request.Payload["markdown"].(map[string]any)
+	if markdown["title"] != "日报" || !strings.Contains(markdown["text"].(string), "正常") || request.Payload["at"] == nil {
+		t.Error(request.Payload)
+	}
+
+	// 配置文件 + 命令行参数内容
+	config_path := filepath.Join(t.TempDir(), "notify.yml")
+	os.WriteFile(config_path, []byte(`
+webhook:
+  ops:
+    type: dingding
+    key: dingding_key
+    secret: dingding_secret
+    server: `+webhook_server.DingDingAddress()+`
+  ops_feishu:
+    type: feishu
+    key: feishu_key
+    server: `+webhook_server.FeiShuAddress()+`
+    feishu_app_id: cli_app_id
+    feishu_app_secret: cli_app_secret
+    feishu_open_api: `+webhook_server.FeiShuOpenAPIAddress()+`
+mail:
+  ops_mail:
+    server: `+mail_server.Addr()+`
+    user: user@example.com
+    password: ${TEST_NOTIFY_MAIL_PASSWORD:password}
+    insecure: true
+`), 0o644)
+	if exit_code, stderr = runNotify(t, binary, "", "webhook", "--config", config_path, "--name", "ops", "服务已重启"); exit_code != 0 {
+		t.Fatalf("exit_code = %d, stderr = %s", exit_code, stderr)
+	}
+	request, _ = webhook_server.LastRequest()
+	if request.Payload["text"].(map[string]any)["content"] != "服务已重启" {
+		t.Error(request.Payload)
+	}
+
+	// image：飞书机器人先使用应用上传图片获取 image_key
+	font_path := filepath.Join(t.TempDir(), "goregular.ttf")
+	os.WriteFile(font_path, goregular.TTF, 0o644)
+	if exit_code, stderr = runNotify(t, binary, "CPU 95%\nMEM 80%\n", "image", "--config", config_path, "--name", "ops_feishu", "--font", font_path, "-"); exit_code != 0 {
+		t.Fatalf("exit_code = %d, stderr = %s", exit_code, stderr)
+	}
+	request, _ = webhook_server.LastRequest()
+	if request.Payload["msg_type"] != "image" || !strings.HasPrefix(request.Payload["content"].(map[string]any)["image_key"].(string), "img_v2_") {
+		t.Error(request.Payload)
+	}
+
+	// 发送失败返回 1，参数错误返回 2
+	if exit_code, _ = runNotify(t, binary, "", "webhook", "--type", "dingding", "--key", "wrong_key", "--server", webhook_server.DingDingAddress(), "test"); exit_code != 1 {
+		t.Errorf("exit_code = %d, want 1", exit_code)
+	}
+	if exit_code, _ = runNotify(t, binary, "", "webhook", "--key", "k", "--server", webhook_server.WeiXinWorkAddress(), "-"); exit_code != 2 {
+		t.Errorf("exit_code = %d, want 2 for empty content", exit_code)
+	}
+	if exit_code, _ = runNotify(t, binary, "", "unknown"); exit_code != 2 {
+		t.Errorf("exit_code = %d, want 2", exit_code)
+	}
+
+	// mail：配置文件 + 命令行覆盖收件人
+	exit_code, stderr = runNotify(t, binary, "mail body\n",
+		"mail", "--config", config_path, "--name", "ops_mail", "--subject", "日报", "--to", "a@example.com,b@example.com")
+	if exit_code != 0 {
+		t.Fatalf("exit_code = %d, stderr = %s", exit_code, stderr)
+	}
+	mails := mail_server.Mails()
+	if len(mails) != 1 || strings.Join(mails[0].To, ",") != "a@example.com,b@example.com" || !strings.Contains(string(mails[0].Data), "mail body") {
+		t.Errorf("mails = %+v", mails)
+	}
+}
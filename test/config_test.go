@@ -0,0 +1,145 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/SimoLin/go-utils/config"
+	"github.com/SimoLin/go-utils/mail/mailtest"
+	"github.com/SimoLin/go-utils/notify"
+	"github.com/SimoLin/go-utils/webhook/webhooktest"
+)
+
+func TestConfigLoad(t *testing.T) {
+	webhook_server := webhooktest.NewServer(webhooktest.WithKey("dingding_key", "dingding_secret"), webhooktest.WithKey("wecom_key", ""))
+	defer webhook_server.Close()
+	t.Setenv("TEST_DINGDING_SECRET", "dingding_secret")
+	t.Setenv("TEST_SMTP_PASSWORD", "smtp_password")
+
+	content := `
+mail:
+  ops_mail:
+    server: smtp.qq.com:465
+    user: 777777777@qq.com
+    password: ${TEST_SMTP_PASSWORD}
+    receivers: [888888888@qq.com]
+webhook:
+  ops_wecom:
+    type: weixin_work
+    key: wecom_key
+    server: ` + webhook_server.WeiXinWorkAddress() + `
+  ops_dingding:
+    type: dingding
+    key: ${TEST_DINGDING_KEY:dingding_key}
+    secret: ${TEST_DINGDING_SECRET}
+    server: ` + webhook_server.DingDingAddress() + `
+    retry:
+      max_retries: 2
+      base_delay: 10ms
+routes:
+  - channel: ops_wecom
+  - channel: ops_dingding
+    min_severity: error
+`
+	path := filepath.Join(t.TempDir(), "config.yml")
+	os.WriteFile(path, []byte(content), 0o644)
+	c, err := config.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := c.WebhookNames(); strings.Join(names, ",") != "ops_dingding,ops_wecom" {
+		t.Errorf("WebhookNames() = %v", names)
+	}
+	if _, err := c.MailSender("ops_mail"); err != nil {
+		t.Error(err)
+	}
+	if _, err := c.MailSender("not_exist"); err == nil {
+		t.Error("expect error for unknown mail sender")
+	}
+
+	// 签名和默认值替换均生效
+	webhook_sender, err := c.WebhookSender("ops_dingding")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = webhook_sender.SendMessageText("test"); err != nil {
+		t.Fatal(err)
+	}
+	if request, _ := webhook_server.LastRequest(); request.Key != "dingding_key" || request.Query.Get("sign") == "" {
+		t.Error(request)
+	}
+
+	// 路由：warning 只发送到企微
+	webhook_server.Reset()
+	notifier, err := c.Notifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = notifier.Send("title", "body", notify.SEVERITY_WARNING); err != nil {
+		t.Fatal(err)
+	}
+	if requests := webhook_server.Requests(); len(requests) != 1 || requests[0].Key != "wecom_key" {
+		t.Errorf("requests = %+v", requests)
+	}
+}
+
+func TestConfigLoadBytes(t *testing.T) {
+	mail_server := mailtest.NewServer()
+	defer mail_server.Close()
+
+	c, err := config.LoadBytes([]byte(`
+mail:
+  ops_mail:
+    server: ` + mail_server.Addr() + `
+    user: user@example.com
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := c.MailNames(); len(names) != 1 || names[0] != "ops_mail" {
+		t.Errorf("MailNames() = %v", names)
+	}
+
+	// 名称和 headers 中带 "." 的键不拆分为嵌套路径
+	webhook_server := webhooktest.NewServer()
+	defer webhook_server.Close()
+	c, err = config.LoadBytes([]byte(`
+webhook:
+  ops.prod:
+    key: wecom_key
+    server: ` + webhook_server.WeiXinWorkAddress() + `
+    headers:
+      X-Trace.Id: trace
+routes:
+  - channel: ops.prod
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := c.WebhookNames(); len(names) != 1 || names[0] != "ops.prod" {
+		t.Errorf("WebhookNames() = %v", names)
+	}
+	webhook_sender, err := c.WebhookSender("ops.prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = webhook_sender.SendMessageText("test"); err != nil {
+		t.Fatal(err)
+	}
+	if request, _ := webhook_server.LastRequest(); request.Header.Get("X-Trace.Id") != "trace" {
+		t.Errorf("header = %v", request.Header)
+	}
+
+	for _, content := range []string{
+		"webhook:\n  bad:\n    type: unknown\n",
+		"webhook:\n  bad:\n    key: ${TEST_NOT_EXIST_ENV}\n",
+		"webhook:\n  ok:\n    key: k\nroutes:\n  - channel: not_exist\n",
+		"webhook:\n  ok:\n    key: k\nroutes:\n  - channel: ok\n    min_severity: fatal\n",
+	} {
+		if _, err := config.LoadBytes([]byte(content)); err == nil {
+			t.Errorf("expect error for %q", content)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package test
 
 import (
+	"encoding/xml"
+	"errors"
 	"fmt"
 	"testing"
 
@@ -78,3 +80,74 @@ jXv37e+WoXSBWcRfi+MJx9uVabKcycf/Q2cmGoyN1c4=
 	fmt.Println(plain_text)
 
 }
+
+func TestAESDecryptCBC(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	for _, plain_text := range []string{"", "a", "0123456789abcdef", "中文内容测试"} {
+		decrypted, err := crypto.AESDecryptCBC(crypto.AESEncryptCBC([]byte(plain_text), key), key)
+		if err != nil || string(decrypted) != plain_text {
+			t.Errorf("AESDecryptCBC() = %q, %v, want %q", decrypted, err, plain_text)
+		}
+	}
+	if _, err := crypto.AESDecryptCBC([]byte("0123456789abcdef"), key); err == nil {
+		t.Error("expect padding error")
+	}
+	if _, err := crypto.PKCS7UnPadding([]byte{1, 2, 3, 4}, 4); err == nil {
+		t.Error("expect padding error")
+	}
+}
+
+func TestWXBizMsgCrypt(t *testing.T) {
+	// 企业微信官方示例
+	token := "QDG6eK"
+	receive_id := "wx5823bf96d3bd56c7"
+	encoding_aes_key := "jWmYm7qr5nMoAUwZRjGtBxmz3KA1tkAj3ykkR6q2B2C"
+	wxbiz_msg_crypt, err := crypto.NewWXBizMsgCrypt(token, encoding_aes_key, receive_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	echostr, err := wxbiz_msg_crypt.VerifyURL(
+		"5c45ff5e21c57e6ad56bac8758b79b1d9ac89fd3",
+		"1409659589",
+		"263014780",
+		"P9nAzCzyDtyTWESHep1vC5X9xho/qYX3Zpb4yKa9SKld1DsH3Iyt3tP3zNdtp+4RPcs8TgAE7OaBO+FZXvnaqQ==",
+	)
+	if err != nil || string(echostr) != "1616140317555161061" {
+		t.Fatalf("VerifyURL() = %q, %v", echostr, err)
+	}
+	if _, err = wxbiz_msg_crypt.VerifyURL(
+		"5c45ff5e21c57e6ad56bac8758b79b1d9ac89fd4",
+		"1409659589",
+		"263014780",
+		"P9nAzCzyDtyTWESHep1vC5X9xho/qYX3Zpb4yKa9SKld1DsH3Iyt3tP3zNdtp+4RPcs8TgAE7OaBO+FZXvnaqQ==",
+	); !errors.Is(err, crypto.ErrWXBizValidateSignature) {
+		t.Errorf("err = %v, want ErrWXBizValidateSignature", err)
+	}
+
+	// 被动回复加密后可以按回调消息解密
+	reply_msg := "<xml><ToUserName><![CDATA[mycreate]]></ToUserName><Content><![CDATA[你好]]></Content></xml>"
+	encrypted_xml, err := wxbiz_msg_crypt.EncryptMsg([]byte(reply_msg), "1409659813", "1372623149")
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted_message := crypto.WXBizEncryptedMessage{}
+	if err = xml.Unmarshal(encrypted_xml, &encrypted_message); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := wxbiz_msg_crypt.DecryptMsg(encrypted_message.MsgSignature.Value, "1409659813", "1372623149", encrypted_xml)
+	if err != nil || string(msg) != reply_msg {
+		t.Fatalf("DecryptMsg() = %q, %v", msg, err)
+	}
+
+	if _, err = wxbiz_msg_crypt.DecryptMsg("wrong_signature", "1409659813", "1372623149", encrypted_xml); !errors.Is(err, crypto.ErrWXBizValidateSignature) {
+		t.Errorf("err = %v, want ErrWXBizValidateSignature", err)
+	}
+	other, _ := crypto.NewWXBizMsgCrypt(token, encoding_aes_key, "other_corp_id")
+	if _, err = other.Decrypt(encrypted_message.Encrypt.Value); !errors.Is(err, crypto.ErrWXBizValidateReceiveID) {
+		t.Errorf("err = %v, want ErrWXBizValidateReceiveID", err)
+	}
+	if _, err = crypto.NewWXBizMsgCrypt(token, "short", receive_id); !errors.Is(err, crypto.ErrWXBizIllegalAESKey) {
+		t.Errorf("err = %v, want ErrWXBizIllegalAESKey", err)
+	}
+}
@@ -1 +1,21 @@
 package test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/SimoLin/go-utils/hash"
+)
+
+func TestHMACSHA256Encode(t *testing.T) {
+	result := hash.HMACSHA256Encode("The quick brown fox jumps over the lazy dog", "key")
+	fmt.Println(result)
+	if result != "f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8" {
+		t.Error(result)
+	}
+	result = hash.HMACSHA256EncodeToBase64("The quick brown fox jumps over the lazy dog", "key")
+	fmt.Println(result)
+	if result != "97yD9DBThCSxMpjmqm+xQ+9NWaFJRhdZl0edvC0aPNg=" {
+		t.Error(result)
+	}
+}
@@ -1,16 +1,34 @@
 package test
 
 import (
-	"fmt"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"image"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	net_mail "net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/SimoLin/go-utils/mail"
+	"github.com/SimoLin/go-utils/mail/mailtest"
 )
 
 func TestMainServer(t *testing.T) {
-	server_address := "smtp.qq.com:465"
 	auth_user := "777777777@qq.com"
 	auth_password := "your_smtp_auth_code"
+	server := mailtest.NewServer(mailtest.WithAuth(auth_user, auth_password))
+	defer server.Close()
+
+	server_address := server.Addr()
 	sender := "777777777@qq.com"
 	sender_username := "your_name"
 	reveiver := []string{"777777777@qq.com", "777777777@qq.com", "777777777@qq.com"}
@@ -22,18 +40,68 @@ func TestMainServer(t *testing.T) {
 		mail.WithSender(sender),
 		mail.WithSenderUsername(sender_username),
 		mail.WithReceiver(reveiver),
+		mail.WithTLSConfig(server.ClientTLSConfig()),
 	)
 	err := mail_sender.SendMail(mail_title, mail_content)
 	if err != nil {
-		fmt.Println(err)
-		t.Failed()
+		t.Fatal(err)
+	}
+	mails := server.Mails()
+	if len(mails) != 1 {
+		t.Fatalf("len(mails) = %d, want 1", len(mails))
+	}
+	data := string(mails[0].Data)
+	if mails[0].AuthUser != auth_user || mails[0].From != sender || len(mails[0].To) != len(reveiver) {
+		t.Errorf("mail = %+v", mails[0])
+	}
+	if !strings.Contains(data, "Subject: "+mail_title) || !strings.Contains(data, mail_content) {
+		t.Errorf("mail data = %q", data)
+	}
+}
+
+func TestSendMailEncodedHeader(t *testing.T) {
+	server := mailtest.NewServer()
+	defer server.Close()
+
+	mail_title := "每日报表"
+	mail_sender := mail.New(
+		server.Addr(), "user@example.com", "password",
+		mail.WithSenderUsername("监控中心"),
+		mail.WithReceiver([]string{"ops@example.com"}),
+		mail.WithTLSConfig(server.ClientTLSConfig()),
+	)
+	if err := mail_sender.SendMail(mail_title, "CPU 使用率正常"); err != nil {
+		t.Fatal(err)
+	}
+	mails := server.Mails()
+	if len(mails) != 1 {
+		t.Fatalf("len(mails) = %d, want 1", len(mails))
+	}
+	net_message, err := net_mail.ReadMessage(bytes.NewReader(mails[0].Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 纯文本邮件的标题和发件人名称同样按 RFC 2047 编码
+	for _, k := range []string{"Subject", "From"} {
+		if v := net_message.Header.Get(k); !strings.Contains(strings.ToUpper(v), "=?UTF-8?") {
+			t.Errorf("%s = %s, want RFC 2047 encoded", k, v)
+		}
+	}
+	if subject, err := new(mime.WordDecoder).DecodeHeader(net_message.Header.Get("Subject")); err != nil || subject != mail_title {
+		t.Errorf("Subject = %q, %v, want %q", subject, err, mail_title)
+	}
+	if from, err := net_message.Header.AddressList("From"); err != nil || len(from) != 1 || from[0].Name != "监控中心" || from[0].Address != "user@example.com" {
+		t.Errorf("From = %v, %v", from, err)
 	}
 }
 
 func TestDoSendMail(t *testing.T) {
-	server_address := "smtp.qq.com:465"
 	auth_user := "777777777@qq.com"
 	auth_password := "your_smtp_auth_code"
+	server := mailtest.NewServer(mailtest.WithAuth(auth_user, auth_password))
+	defer server.Close()
+
+	server_address := server.Addr()
 	sender := "777777777@qq.com"
 	sender_username := "your_name"
 	reveiver := []string{"777777777@qq.com", "777777777@qq.com", "777777777@qq.com"}
@@ -45,9 +113,297 @@ func TestDoSendMail(t *testing.T) {
 		mail.WithSender(sender),
 		mail.WithSenderUsername(sender_username),
 		mail.WithReceiver(reveiver),
+		mail.WithTLSConfig(server.ClientTLSConfig()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(server.Mails()) != 1 {
+		t.Errorf("mails = %+v", server.Mails())
+	}
+
+	// 密码错误时返回认证失败
+	err = mail.DoSendMail(
+		server_address, auth_user, "wrong_password", mail_title, mail_content,
+		mail.WithTLSConfig(server.ClientTLSConfig()),
+	)
+	if err == nil || !strings.Contains(err.Error(), "535") {
+		t.Errorf("err = %v, want 535", err)
+	}
+
+	// 未信任自签名证书时握手失败
+	err = mail.DoSendMail(server_address, auth_user, auth_password, mail_title, mail_content)
+	if err == nil {
+		t.Error("expect certificate error")
+	}
+}
+
+func TestMailRejectReceiver(t *testing.T) {
+	server := mailtest.NewServer(mailtest.WithRejectReceiver("nobody@example.com"))
+	defer server.Close()
+
+	err := mail.DoSendMail(
+		server.Addr(), "user@example.com", "password", "title", "content",
+		mail.WithReceiver([]string{"user@example.com", "nobody@example.com"}),
+		mail.WithTLSConfig(server.ClientTLSConfig()),
+	)
+	if err == nil || !strings.Contains(err.Error(), "550") {
+		t.Errorf("err = %v, want 550", err)
+	}
+	if len(server.Mails()) != 0 {
+		t.Errorf("mails = %+v", server.Mails())
+	}
+}
+
+func TestSendMailContext(t *testing.T) {
+	// 只接受连接不响应，TLS 握手卡住
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = mail.New(listener.Addr().String(), "user@example.com", "password").SendMailContext(ctx, "title", "content")
+	if !errors.Is(err, context.DeadlineExceeded) || time.Since(start) > 2*time.Second {
+		t.Errorf("err = %v after %v, want context.DeadlineExceeded", err, time.Since(start))
+	}
+
+	// 服务端响应缓慢，使用 WithTimeout 的默认超时
+	server := mailtest.NewServer(mailtest.WithResponseDelay(5 * time.Second))
+	defer server.Close()
+	start = time.Now()
+	err = mail.New(
+		server.Addr(), "user@example.com", "password",
+		mail.WithTLSConfig(server.ClientTLSConfig()),
+		mail.WithTimeout(200*time.Millisecond),
+	).SendMail("title", "content")
+	if !errors.Is(err, context.DeadlineExceeded) || time.Since(start) > 2*time.Second {
+		t.Errorf("err = %v after %v, want context.DeadlineExceeded", err, time.Since(start))
+	}
+}
+
+func TestSendMailWithAttachments(t *testing.T) {
+	server := mailtest.NewServer()
+	defer server.Close()
+
+	file_path := filepath.Join(t.TempDir(), "report.csv")
+	if err := os.WriteFile(file_path, []byte("host,cpu\nweb-01,95\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	file_attachment, err := mail.NewAttachmentFromFile(file_path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader_attachment, err := mail.NewAttachmentFromReader("运行日志.log", strings.NewReader("line 1\nline 2\n"), "text/plain; charset=UTF-8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	image_data := bytes.Repeat([]byte{0x89, 'P', 'N', 'G', 0x00, 0xff}, 100)
+	attachments := []*mail.Attachment{
+		file_attachment,
+		reader_attachment,
+		mail.NewAttachment("图表.png", image_data, ""),
+	}
+	if _, err = mail.NewAttachmentFromFile(filepath.Join(t.TempDir(), "not_exist.csv")); err == nil {
+		t.Error("expect error for missing file")
+	}
+
+	mail_sender := mail.New(
+		server.Addr(), "user@example.com", "password",
+		mail.WithTLSConfig(server.ClientTLSConfig()),
 	)
+	if err = mail_sender.SendMailWithAttachments("每日报表", "报表见附件", attachments...); err != nil {
+		t.Fatal(err)
+	}
+	mails := server.Mails()
+	if len(mails) != 1 {
+		t.Fatalf("len(mails) = %d, want 1", len(mails))
+	}
+
+	message, err := net_mail.ReadMessage(bytes.NewReader(mails[0].Data))
 	if err != nil {
-		fmt.Println(err)
-		t.Failed()
+		t.Fatal(err)
+	}
+	media_type, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	if err != nil || media_type != "multipart/mixed" || message.Header.Get("MIME-Version") != "1.0" {
+		t.Fatalf("Content-Type = %s, %v", message.Header.Get("Content-Type"), err)
+	}
+	if !strings.Contains(string(mails[0].Data), `filename*=utf-8''%E8%BF%90%E8%A1%8C%E6%97%A5%E5%BF%97.log`) {
+		t.Error("filename should be encoded by RFC 2231")
+	}
+
+	type part struct {
+		filename     string
+		content_type string
+		data         []byte
+	}
+	want := []part{
+		{"", "text/plain; charset=UTF-8", []byte("报表见附件")},
+		{"report.csv", "text/csv", []byte("host,cpu\nweb-01,95\n")},
+		{"运行日志.log", "text/plain", []byte("line 1\nline 2\n")},
+		{"图表.png", "image/png", image_data},
+	}
+	reader := multipart.NewReader(message.Body, params["boundary"])
+	for i := 0; ; i++ {
+		mime_part, err := reader.NextRawPart()
+		if err == io.EOF {
+			if i != len(want) {
+				t.Errorf("parts = %d, want %d", i, len(want))
+			}
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i >= len(want) {
+			t.Fatalf("unexpected part %d", i)
+		}
+		raw, _ := io.ReadAll(mime_part)
+		for _, line := range strings.Split(strings.TrimSpace(string(raw)), "\n") {
+			if len(strings.TrimSuffix(line, "\r")) > mail.BASE64_LINE_LENGTH {
+				t.Errorf("part %d line length = %d", i, len(line))
+			}
+		}
+		data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(raw)), ""))
+		if err != nil {
+			t.Fatal(err)
+		}
+		content_type, _, _ := mime.ParseMediaType(mime_part.Header.Get("Content-Type"))
+		if mime_part.Header.Get("Content-Transfer-Encoding") != "base64" ||
+			mime_part.FileName() != want[i].filename ||
+			!strings.HasPrefix(want[i].content_type, content_type) ||
+			!bytes.Equal(data, want[i].data) {
+			t.Errorf("part %d = %v %q, want %+v", i, mime_part.Header, data, want[i])
+		}
+	}
+}
+
+type mimeLeaf struct {
+	part *multipart.Part
+	data []byte
+}
+
+// 递归解析 MIME 结构，返回形如 multipart/mixed(multipart/related(...), text/csv) 的结构描述，叶子节点按类型保存到 leaves
+func parseMIMEStructure(t *testing.T, header textproto.MIMEHeader, body io.Reader, leaves map[string]mimeLeaf) string {
+	media_type, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(media_type, "multipart/") {
+		return media_type
+	}
+	children := []string{}
+	reader := multipart.NewReader(body, params["boundary"])
+	for {
+		part, err := reader.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, _ := io.ReadAll(part)
+		child := parseMIMEStructure(t, part.Header, bytes.NewReader(raw), leaves)
+		if !strings.HasPrefix(child, "multipart/") {
+			data, _ := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(raw)), ""))
+			leaves[child] = mimeLeaf{part: part, data: data}
+		}
+		children = append(children, child)
+	}
+	return media_type + "(" + strings.Join(children, ", ") + ")"
+}
+
+func TestSendMessage(t *testing.T) {
+	server := mailtest.NewServer()
+	defer server.Close()
+	mail_sender := mail.New(
+		server.Addr(), "user@example.com", "password",
+		mail.WithTLSConfig(server.ClientTLSConfig()),
+		mail.WithSenderUsername("监控中心"),
+	)
+
+	chart, err := mail.NewInlineImage("chart", image.NewRGBA(image.Rect(0, 0, 16, 16)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := mail.NewMessage("每日报表").
+		SetText("CPU 使用率见附图").
+		SetHTML(`<p>CPU 使用率</p><img src="cid:chart">`).
+		Embed(chart).
+		Attach(mail.NewAttachment("报表.csv", []byte("host,cpu\n"), ""))
+
+	testcases := []struct {
+		message   *mail.Message
+		structure string
+	}{
+		{message, "multipart/mixed(multipart/related(multipart/alternative(text/plain, text/html), image/jpeg), text/csv)"},
+		{mail.NewMessage("html").SetHTML("<b>html</b>"), "text/html"},
+		{mail.NewMessage("alternative").SetText("text").SetHTML("<b>html</b>"), "multipart/alternative(text/plain, text/html)"},
+		{mail.NewMessage("related").SetHTML(`<img src="cid:chart">`).Embed(chart), "multipart/related(text/html, image/jpeg)"},
+	}
+	for _, testcase := range testcases {
+		server.Reset()
+		if err = mail_sender.SendMessage(testcase.message); err != nil {
+			t.Fatal(err)
+		}
+		mails := server.Mails()
+		if len(mails) != 1 {
+			t.Fatalf("len(mails) = %d, want 1", len(mails))
+		}
+		net_message, err := net_mail.ReadMessage(bytes.NewReader(mails[0].Data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		leaves := map[string]mimeLeaf{}
+		structure := parseMIMEStructure(t, textproto.MIMEHeader(net_message.Header), net_message.Body, leaves)
+		if structure != testcase.structure {
+			t.Errorf("structure = %s, want %s", structure, testcase.structure)
+		}
+		if testcase.message != message {
+			continue
+		}
+		// 非 ASCII 的标题和发件人名称按 RFC 2047 编码
+		for _, k := range []string{"Subject", "From"} {
+			if v := net_message.Header.Get(k); !strings.Contains(strings.ToUpper(v), "=?UTF-8?") {
+				t.Errorf("%s = %s, want RFC 2047 encoded", k, v)
+			}
+		}
+		if subject, err := new(mime.WordDecoder).DecodeHeader(net_message.Header.Get("Subject")); err != nil || subject != message.Title {
+			t.Errorf("Subject = %q, %v, want %q", subject, err, message.Title)
+		}
+		if from, err := net_message.Header.AddressList("From"); err != nil || len(from) != 1 || from[0].Name != "监控中心" || from[0].Address != "user@example.com" {
+			t.Errorf("From = %v, %v", from, err)
+		}
+		if string(leaves["text/plain"].data) != message.Text || string(leaves["text/html"].data) != message.HTML {
+			t.Error("body mismatch")
+		}
+		image_leaf := leaves["image/jpeg"]
+		if image_leaf.part.Header.Get("Content-ID") != "<chart>" || !strings.HasPrefix(image_leaf.part.Header.Get("Content-Disposition"), "inline") {
+			t.Errorf("inline header = %v", image_leaf.part.Header)
+		}
+		if !bytes.Equal(image_leaf.data, chart.Data) {
+			t.Error("inline image mismatch")
+		}
+		if leaves["text/csv"].part.FileName() != "报表.csv" {
+			t.Errorf("attachment filename = %s", leaves["text/csv"].part.FileName())
+		}
+	}
+
+	if err = mail_sender.SendMessage(mail.NewMessage("empty")); err == nil {
+		t.Error("expect error for empty body")
+	}
+	if err = mail_sender.SendMessage(mail.NewMessage("no_cid").SetHTML("<b>html</b>").Embed(mail.NewAttachment("a.png", []byte{}, ""))); err == nil {
+		t.Error("expect error for inline image without ContentID")
 	}
 }
@@ -0,0 +1,108 @@
+package test
+
+import (
+	"mime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SimoLin/go-utils/mail"
+	"github.com/SimoLin/go-utils/mail/mailtest"
+	"github.com/SimoLin/go-utils/message_template"
+	"github.com/SimoLin/go-utils/webhook"
+	"github.com/SimoLin/go-utils/webhook/webhooktest"
+)
+
+type templateAlert struct {
+	Host    string            `json:"host"`
+	Level   string            `json:"level"`
+	Labels  map[string]string `json:"labels"`
+	Message string            `json:"message"`
+	Time    time.Time         `json:"time"`
+}
+
+func TestMessageTemplate(t *testing.T) {
+	registry := message_template.New()
+	err := registry.Register("alert", `{{define "title"}}[{{.level | upper}}] {{.host}}{{end}}`+
+		"主机: {{.host}}\n"+
+		"指标: {{get \"metric.name\" .}} = {{get \"metric.value\" .}}\n"+
+		"时间: {{datetime \"\" .time}}\n"+
+		"详情: {{.message | truncate 5}}\n"+
+		"负责人: {{default \"无\" .owner}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := map[string]any{
+		"host":    "web-01",
+		"level":   "critical",
+		"metric":  map[string]any{"name": "cpu", "value": 95.5},
+		"time":    time.Date(2024, 1, 2, 3, 4, 5, 0, time.Local).Unix(),
+		"message": "CPU 使用率过高，请检查",
+	}
+	title, content, err := registry.RenderMessage("alert", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "主机: web-01\n指标: cpu = 95.5\n时间: 2024-01-02 03:04:05\n详情: CPU 使...\n负责人: 无"
+	if title != "[CRITICAL] web-01" || content != want {
+		t.Errorf("RenderMessage() = %q, %q, want %q", title, content, want)
+	}
+
+	// 结构体和路径读取
+	registry.MustRegister("struct", `{{.Host}} {{get "labels.env" .}} {{datetime "2006-01-02" .Time}}`)
+	content, err = registry.Render("struct", templateAlert{Host: "db-01", Labels: map[string]string{"env": "prod"}, Time: time.Date(2024, 5, 6, 0, 0, 0, 0, time.Local)})
+	if err != nil || content != "db-01 prod 2024-05-06" {
+		t.Errorf("Render() = %q, %v", content, err)
+	}
+
+	if _, err = registry.Render("not_exist", data); err == nil {
+		t.Error("expect error for unknown template")
+	}
+	if err = registry.Register("bad", "{{.host"); err == nil {
+		t.Error("expect parse error")
+	}
+	if names := registry.Names(); strings.Join(names, ",") != "alert,struct" {
+		t.Errorf("Names() = %v", names)
+	}
+}
+
+func TestSendTemplate(t *testing.T) {
+	registry := message_template.New()
+	registry.MustRegister("alert", `{{define "title"}}{{.host}} 告警{{end}}**{{.host}}** {{.message}}`)
+	registry.MustRegister("no_title", `{{.message}}`)
+	data := map[string]any{"host": "web-01", "message": "磁盘已满"}
+
+	webhook_server := webhooktest.NewServer()
+	defer webhook_server.Close()
+	err := webhook.New(
+		"your_api_key",
+		webhook.WithWebhookType(webhook.WEBHOOK_TYPE_DINGDING),
+		webhook.WithServerAddress(webhook_server.DingDingAddress()),
+		webhook.WithTemplateRegistry(registry),
+	).SendTemplate(webhook.MESSAGE_TYPE_MARKDOWN, "alert", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request, _ := webhook_server.LastRequest()
+	markdown := request.Payload["markdown"].(map[string]any)
+	if markdown["title"] != "web-01 告警" || markdown["text"] != "**web-01** 磁盘已满" {
+		t.Error(markdown)
+	}
+
+	mail_server := mailtest.NewServer()
+	defer mail_server.Close()
+	mail_sender := mail.New(
+		mail_server.Addr(), "user@example.com", "password",
+		mail.WithTLSConfig(mail_server.ClientTLSConfig()),
+		mail.WithTemplateRegistry(registry),
+	)
+	if err = mail_sender.SendTemplate("alert", data); err != nil {
+		t.Fatal(err)
+	}
+	if mails := mail_server.Mails(); len(mails) != 1 || !strings.Contains(string(mails[0].Data), "Subject: "+mime.BEncoding.Encode("UTF-8", "web-01 告警")) {
+		t.Errorf("mails = %+v", mails)
+	}
+	if err = mail_sender.SendTemplate("no_title", data); err == nil {
+		t.Error("expect error for template without title")
+	}
+}
@@ -0,0 +1,215 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SimoLin/go-utils/mail"
+	"github.com/SimoLin/go-utils/mail/mailtest"
+	"github.com/SimoLin/go-utils/metrics"
+	"github.com/SimoLin/go-utils/webhook"
+	"github.com/SimoLin/go-utils/webhook/webhooktest"
+)
+
+func TestMetricsRegistry(t *testing.T) {
+	registry := metrics.NewRegistry()
+	counter := registry.MustNewCounter("test_total", "Test counter.\nSecond line.", "name")
+	histogram := registry.MustNewHistogram("test_seconds", "", []float64{1, 0.1}, "name")
+	counter.Inc(`a"b`)
+	counter.Add(2.5, "c")
+	histogram.Observe(0.05, "x")
+	histogram.Observe(0.5, "x")
+	histogram.Observe(3, "x")
+
+	if _, err := registry.NewCounter("test_total", ""); err == nil {
+		t.Error("expect error for duplicate metric")
+	}
+	if _, err := registry.NewCounter("bad-name", ""); err == nil {
+		t.Error("expect error for invalid metric name")
+	}
+	if _, err := registry.NewCounter("good_name", "", "le"); err == nil {
+		t.Error("expect error for reserved label name")
+	}
+	if counter.Value("c") != 2.5 || counter.Value("not_exist") != 0 {
+		t.Errorf("Value() = %v", counter.Value("c"))
+	}
+	if count, sum := histogram.Snapshot("x"); count != 3 || sum != 3.55 {
+		t.Errorf("Snapshot() = %d, %v", count, sum)
+	}
+
+	server := httptest.NewServer(registry.Handler())
+	defer server.Close()
+	response, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	body, _ := io.ReadAll(response.Body)
+	if response.Header.Get("Content-Type") != metrics.CONTENT_TYPE_PROMETHEUS {
+		t.Errorf("Content-Type = %s", response.Header.Get("Content-Type"))
+	}
+	want := `# HELP test_total Test counter.\nSecond line.
+# TYPE test_total counter
+test_total{name="a\"b"} 1
+test_total{name="c"} 2.5
+# TYPE test_seconds histogram
+test_seconds_bucket{name="x",le="0.1"} 1
+test_seconds_bucket{name="x",le="1"} 2
+test_seconds_bucket{name="x",le="+Inf"} 3
+test_seconds_sum{name="x"} 3.55
+test_seconds_count{name="x"} 3
+`
+	if string(body) != want {
+		t.Errorf("metrics =\n%s\nwant\n%s", body, want)
+	}
+}
+
+func TestWebhookSendHooks(t *testing.T) {
+	server := webhooktest.NewServer()
+	defer server.Close()
+	registry := metrics.NewRegistry()
+	send_metrics := metrics.MustNewSendMetrics(registry)
+
+	events := []*webhook.SendEvent{}
+	webhook_sender := webhook.New(
+		"your_api_key",
+		webhook.WithServerAddress(server.WeiXinWorkAddress()),
+		webhook.WithRetry(2, time.Millisecond, time.Millisecond),
+		webhook.WithBeforeSend(func(ctx context.Context, event *webhook.SendEvent) error {
+			text, _ := event.Payload["text"].(map[string]any)
+			if text["content"] == "veto" {
+				return errors.New("blocked")
+			}
+			event.Payload = map[string]any{
+				"msgtype": "text",
+				"text":    map[string]any{"content": "[prod] " + text["content"].(string)},
+			}
+			return nil
+		}),
+		webhook.WithAfterSend(send_metrics.WebhookHook(), func(ctx context.Context, event *webhook.SendEvent) {
+			events = append(events, event)
+		}),
+	)
+
+	if err := webhook_sender.SendMessageText("hello"); err != nil {
+		t.Fatal(err)
+	}
+	request, _ := server.LastRequest()
+	if request.Payload["text"].(map[string]any)["content"] != "[prod] hello" {
+		t.Errorf("payload = %v", request.Payload)
+	}
+
+	err := webhook_sender.SendMessageText("veto")
+	if !webhook.IsVetoed(err) {
+		t.Errorf("err = %v, want vetoed", err)
+	}
+	if len(server.Requests()) != 1 {
+		t.Errorf("vetoed message should not be sent")
+	}
+
+	server.FailNext(45009, 1)
+	if err = webhook_sender.SendMessageText("retry"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 3 {
+		t.Fatalf("events = %d", len(events))
+	}
+	for i, want := range []string{webhook.SEND_STATUS_SUCCESS, webhook.SEND_STATUS_VETOED, webhook.SEND_STATUS_SUCCESS} {
+		if events[i].Status != want {
+			t.Errorf("events[%d].Status = %s, want %s", i, events[i].Status, want)
+		}
+	}
+	if events[2].Attempts != 2 || events[2].Duration <= 0 {
+		t.Errorf("events[2] = %+v", events[2])
+	}
+
+	if v := send_metrics.SendTotal.Value(metrics.CHANNEL_WEBHOOK, webhook.WEBHOOK_TYPE_WEIXIN_WORK, webhook.SEND_STATUS_SUCCESS); v != 2 {
+		t.Errorf("success total = %v", v)
+	}
+	if v := send_metrics.SendTotal.Value(metrics.CHANNEL_WEBHOOK, webhook.WEBHOOK_TYPE_WEIXIN_WORK, webhook.SEND_STATUS_VETOED); v != 1 {
+		t.Errorf("vetoed total = %v", v)
+	}
+	if v := send_metrics.SendAttempts.Value(metrics.CHANNEL_WEBHOOK, webhook.WEBHOOK_TYPE_WEIXIN_WORK); v != 3 {
+		t.Errorf("attempts total = %v", v)
+	}
+	if count, _ := send_metrics.SendDuration.Snapshot(metrics.CHANNEL_WEBHOOK, webhook.WEBHOOK_TYPE_WEIXIN_WORK); count != 2 {
+		t.Errorf("duration count = %d", count)
+	}
+
+	// 钩子修改嵌套字段时不影响调用方传入的 map
+	payload := webhook.NewWeiXinWorkText("nested").ToMap()
+	err = webhook.New(
+		"your_api_key",
+		webhook.WithServerAddress(server.WeiXinWorkAddress()),
+		webhook.WithBeforeSend(func(ctx context.Context, event *webhook.SendEvent) error {
+			event.Payload["text"].(map[string]any)["content"] = "[prod] nested"
+			return nil
+		}),
+	).SendMessage(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content := payload["text"].(map[string]any)["content"]; content != "nested" {
+		t.Errorf("caller payload content = %v, want nested", content)
+	}
+	request, _ = server.LastRequest()
+	if request.Payload["text"].(map[string]any)["content"] != "[prod] nested" {
+		t.Errorf("payload = %v", request.Payload)
+	}
+}
+
+func TestMailSendHooks(t *testing.T) {
+	server := mailtest.NewServer(mailtest.WithRejectReceiver("reject@example.com"))
+	defer server.Close()
+	registry := metrics.NewRegistry()
+	send_metrics := metrics.MustNewSendMetrics(registry)
+
+	statuses := []string{}
+	mail_sender := mail.New(
+		server.Addr(), "user@example.com", "password",
+		mail.WithTLSConfig(server.ClientTLSConfig()),
+		mail.WithBeforeSend(func(ctx context.Context, event *mail.SendEvent) error {
+			if strings.Contains(event.Title, "veto") {
+				return errors.New("blocked")
+			}
+			if strings.Contains(event.Title, "reject") {
+				event.Receivers = []string{"reject@example.com"}
+			}
+			event.Title = "[prod] " + event.Title
+			return nil
+		}),
+		mail.WithAfterSend(send_metrics.MailHook(), func(ctx context.Context, event *mail.SendEvent) {
+			statuses = append(statuses, event.Status)
+		}),
+	)
+
+	if err := mail_sender.SendMail("hello", "content"); err != nil {
+		t.Fatal(err)
+	}
+	if err := mail_sender.SendMail("veto", "content"); !mail.IsVetoed(err) {
+		t.Errorf("err = %v, want vetoed", err)
+	}
+	if err := mail_sender.SendMail("reject", "content"); err == nil {
+		t.Error("expect error for rejected receiver")
+	}
+
+	mails := server.Mails()
+	if len(mails) != 1 || !strings.Contains(string(mails[0].Data), "Subject: [prod] hello") {
+		t.Errorf("mails = %+v", mails)
+	}
+	if strings.Join(statuses, ",") != "success,vetoed,failure" {
+		t.Errorf("statuses = %v", statuses)
+	}
+	for _, status := range []string{mail.SEND_STATUS_SUCCESS, mail.SEND_STATUS_VETOED, mail.SEND_STATUS_FAILURE} {
+		if v := send_metrics.SendTotal.Value(metrics.CHANNEL_MAIL, "smtp", status); v != 1 {
+			t.Errorf("%s total = %v", status, v)
+		}
+	}
+}
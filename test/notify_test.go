@@ -0,0 +1,125 @@
+package test
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/SimoLin/go-utils/common"
+	"github.com/SimoLin/go-utils/notify"
+	"github.com/SimoLin/go-utils/webhook"
+	"github.com/SimoLin/go-utils/webhook/webhooktest"
+)
+
+type recordChannel struct {
+	mutex  sync.Mutex
+	titles []string
+	err    error
+}
+
+func (record_channel *recordChannel) Notify(title string, content string) error {
+	record_channel.mutex.Lock()
+	defer record_channel.mutex.Unlock()
+	record_channel.titles = append(record_channel.titles, title)
+	return record_channel.err
+}
+
+func TestNotifier(t *testing.T) {
+	var payload map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &payload)
+		w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	defer server.Close()
+
+	ops := &recordChannel{}
+	db := &recordChannel{}
+	broken := &recordChannel{err: errors.New("boom")}
+	notifier, err := notify.New(
+		notify.WithChannel("wecom", webhook.New("key", webhook.WithServerAddress(server.URL+"/?key="))),
+		notify.WithChannel("ops", ops, notify.Route{MinSeverity: notify.SEVERITY_ERROR}),
+		notify.WithChannel("db", db, notify.Route{MinSeverity: notify.SEVERITY_WARNING, Tags: []string{"db"}}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := notifier.Send("磁盘告警", "磁盘使用率 90%", notify.SEVERITY_WARNING, "db"); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	if len(ops.titles) != 0 || len(db.titles) != 1 || db.titles[0] != "[WARNING] 磁盘告警" {
+		t.Errorf("route mismatch, ops = %v, db = %v", ops.titles, db.titles)
+	}
+	markdown, _ := payload["markdown"].(map[string]any)
+	if content, _ := markdown["content"].(string); !strings.Contains(content, "[WARNING] 磁盘告警") || !strings.Contains(content, "标签: db") {
+		t.Errorf("webhook payload = %v", payload)
+	}
+
+	if names := notifier.Match(&notify.Message{Severity: notify.SEVERITY_CRITICAL, Tags: []string{"web"}}); strings.Join(names, ",") != "wecom,ops" {
+		t.Errorf("Match() = %v", names)
+	}
+
+	if err = notifier.AddChannel("broken", broken); err != nil {
+		t.Fatal(err)
+	}
+	err = notifier.Send("服务宕机", "api 不可用", notify.SEVERITY_CRITICAL)
+	var notify_error *notify.NotifyError
+	if !errors.As(err, &notify_error) || len(notify_error.Errors) != 1 || notify_error.Errors["broken"] == nil {
+		t.Fatalf("Notify() error = %v, want NotifyError for broken", err)
+	}
+	if len(ops.titles) != 1 {
+		t.Errorf("ops titles = %v", ops.titles)
+	}
+
+	// 渠道名称重复时返回错误，避免发送失败的错误互相覆盖
+	if err = notifier.AddChannel("broken", ops); !errors.Is(err, notify.ErrDuplicateChannel) {
+		t.Errorf("AddChannel() = %v, want ErrDuplicateChannel", err)
+	}
+	if _, err = notify.New(notify.WithChannel("ops", ops), notify.WithChannel("ops", db)); !errors.Is(err, notify.ErrDuplicateChannel) {
+		t.Errorf("New() = %v, want ErrDuplicateChannel", err)
+	}
+
+	if severity, err := notify.ParseSeverity("critical"); err != nil || severity != notify.SEVERITY_CRITICAL {
+		t.Errorf("ParseSeverity() = %v, %v", severity, err)
+	}
+}
+
+func TestWebhookSenderNotify(t *testing.T) {
+	server := webhooktest.NewServer()
+	defer server.Close()
+
+	// 消息已送达但@手机号未生效时不作为发送失败
+	weixin_work_sender := webhook.New(
+		"your_api_key",
+		webhook.WithServerAddress(server.WeiXinWorkAddress()),
+		webhook.WithMention(webhook.Mention{Mobiles: []string{"13800000000"}}),
+	)
+	if err := weixin_work_sender.Notify("磁盘告警", "磁盘使用率 90%"); err != nil {
+		t.Errorf("Notify() error = %v", err)
+	}
+	request, _ := server.LastRequest()
+	if content := common.MapGetValueToString(request.Payload, "markdown.content"); !strings.HasPrefix(content, "**磁盘告警**\n磁盘使用率 90%") {
+		t.Errorf("weixin work content = %q", content)
+	}
+
+	// 飞书卡片标题已显示标题，正文中不重复
+	feishu_sender := webhook.New(
+		"your_api_key",
+		webhook.WithWebhookType(webhook.WEBHOOK_TYPE_FEISHU),
+		webhook.WithServerAddress(server.FeiShuAddress()),
+	)
+	if err := feishu_sender.Notify("磁盘告警", "磁盘使用率 90%"); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	request, _ = server.LastRequest()
+	payload, _ := json.Marshal(request.Payload)
+	if strings.Count(string(payload), "磁盘告警") != 1 || common.MapGetValueToString(request.Payload, "card.header.title.content") != "磁盘告警" {
+		t.Errorf("feishu payload = %s", payload)
+	}
+}
@@ -1,14 +1,47 @@
 package test
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"image"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+	"unicode/utf8"
 
+	"github.com/SimoLin/go-utils/common"
+	"github.com/SimoLin/go-utils/hash"
+	"github.com/SimoLin/go-utils/text_drawer"
 	"github.com/SimoLin/go-utils/webhook"
+	"github.com/SimoLin/go-utils/webhook/webhooktest"
 )
 
+// 将旧版 SendToXXX 函数使用的地址指向模拟服务端，返回恢复函数
+func useMockServerAddress(server *webhooktest.Server) (restore func()) {
+	backup := map[string]string{}
+	for _, webhook_type := range []string{webhook.WEBHOOK_TYPE_WEIXIN_WORK, webhook.WEBHOOK_TYPE_DINGDING, webhook.WEBHOOK_TYPE_FEISHU} {
+		backup[webhook_type] = webhook.DICT_WEBHOOK_TYPE_TO_SERVER_ADDRESS[webhook_type]
+		webhook.DICT_WEBHOOK_TYPE_TO_SERVER_ADDRESS[webhook_type] = server.Address(webhook_type)
+	}
+	return func() {
+		for webhook_type, server_address := range backup {
+			webhook.DICT_WEBHOOK_TYPE_TO_SERVER_ADDRESS[webhook_type] = server_address
+		}
+	}
+}
+
 func TestNewWebhookSender(t *testing.T) {
 	api_key := "your_api_key"
+	server := webhooktest.NewServer(webhooktest.WithKey(api_key, ""))
+	defer server.Close()
 
 	// 样例一：初始化对象，可重复调用函数发送消息
 	webhook_sender := webhook.New(
@@ -16,10 +49,15 @@ func TestNewWebhookSender(t *testing.T) {
 		webhook.WithWebhookType(webhook.WEBHOOK_TYPE_WEIXIN_WORK),
 		// webhook.WithWebhookType(webhook.WEBHOOK_TYPE_DINGDING),
 		// webhook.WithWebhookType(webhook.WEBHOOK_TYPE_FEISHU),
+		webhook.WithServerAddress(server.WeiXinWorkAddress()),
 	)
 
-	webhook_sender.SendMessageText("test1")
-	webhook_sender.SendMessageText("test2")
+	if err := webhook_sender.SendMessageText("test1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := webhook_sender.SendMessageText("test2"); err != nil {
+		t.Fatal(err)
+	}
 
 	// 样例二：实例化对象后直接调用函数发送消息
 	content := map[string]any{
@@ -28,15 +66,27 @@ func TestNewWebhookSender(t *testing.T) {
 			"content": "test—",
 		},
 	}
-	webhook.New(
+	err := webhook.New(
 		api_key,
 		webhook.WithWebhookType(webhook.WEBHOOK_TYPE_WEIXIN_WORK),
+		webhook.WithServerAddress(server.WeiXinWorkAddress()),
 	).SendMessage(content)
+	if err != nil {
+		t.Fatal(err)
+	}
 
+	payloads := server.Payloads()
+	if len(payloads) != 3 || payloads[1]["text"].(map[string]any)["content"] != "test2" || payloads[2]["markdown"].(map[string]any)["content"] != "test—" {
+		t.Error(payloads)
+	}
 }
 
 func TestSendToWeiXinWork(t *testing.T) {
 	api_key := "your_api_key"
+	server := webhooktest.NewServer(webhooktest.WithKey(api_key, ""))
+	defer server.Close()
+	defer useMockServerAddress(server)()
+
 	content := map[string]any{
 		"msgtype": "markdown",
 		"markdown": map[string]string{
@@ -45,14 +95,20 @@ func TestSendToWeiXinWork(t *testing.T) {
 	}
 	err := webhook.SendToWeiXinWork(api_key, content, "")
 	if err != nil {
-		fmt.Println(err)
-		t.Failed()
+		t.Fatal(err)
+	}
+	if request, _ := server.LastRequest(); request.Key != api_key || request.Payload["msgtype"] != "markdown" {
+		t.Error(request)
 	}
 }
 
 // 钉钉机器人推送Markdown消息必须指定标题
 func TestSendToDingDing(t *testing.T) {
 	api_key := "your_api_key"
+	server := webhooktest.NewServer(webhooktest.WithKey(api_key, ""))
+	defer server.Close()
+	defer useMockServerAddress(server)()
+
 	content := map[string]any{
 		"msgtype": "markdown",
 		"markdown": map[string]string{
@@ -63,13 +119,19 @@ func TestSendToDingDing(t *testing.T) {
 
 	err := webhook.SendToDingDing(api_key, content, "")
 	if err != nil {
-		fmt.Println(err)
-		t.Failed()
+		t.Fatal(err)
+	}
+	if request, _ := server.LastRequest(); request.Key != api_key || request.Payload["markdown"].(map[string]any)["title"] != "test" {
+		t.Error(request)
 	}
 }
 
 func TestSendToFeiShu(t *testing.T) {
 	api_key := "your_api_key"
+	server := webhooktest.NewServer(webhooktest.WithKey(api_key, ""))
+	defer server.Close()
+	defer useMockServerAddress(server)()
+
 	content := map[string]any{
 		"msg_type": "text",
 		"content": map[string]string{
@@ -78,7 +140,1228 @@ func TestSendToFeiShu(t *testing.T) {
 	}
 	err := webhook.SendToFeiShu(api_key, content, "")
 	if err != nil {
+		t.Fatal(err)
+	}
+	if request, _ := server.LastRequest(); request.Key != api_key || request.Payload["msg_type"] != "text" {
+		t.Error(request)
+	}
+}
+
+func TestWebhookMockServer(t *testing.T) {
+	api_key := "your_api_key"
+	secret := "your_secret"
+	server := webhooktest.NewServer(webhooktest.WithKey(api_key, secret))
+	defer server.Close()
+
+	for _, webhook_type := range []string{webhook.WEBHOOK_TYPE_WEIXIN_WORK, webhook.WEBHOOK_TYPE_DINGDING, webhook.WEBHOOK_TYPE_FEISHU} {
+		// 正确的 api_key 和签名
+		err := webhook.New(
+			api_key,
+			webhook.WithWebhookType(webhook_type),
+			webhook.WithServerAddress(server.Address(webhook_type)),
+			webhook.WithSecret(secret),
+		).SendMessageMarkdown("# test")
+		if err != nil {
+			t.Errorf("%s: %v", webhook_type, err)
+		}
+
+		// 错误的 api_key
+		var webhook_error *webhook.WebhookError
+		err = webhook.New(
+			"wrong_key",
+			webhook.WithWebhookType(webhook_type),
+			webhook.WithServerAddress(server.Address(webhook_type)),
+		).SendMessageText("test")
+		if !errors.As(err, &webhook_error) || !webhook_error.IsInvalidKey() {
+			t.Errorf("%s: err = %v, want invalid key", webhook_type, err)
+		}
+
+		// 限流错误码
+		code := webhook.DICT_WEBHOOK_TYPE_TO_RATE_LIMITED_CODES[webhook_type][0]
+		server.FailNext(code, 1)
+		err = webhook.New(
+			api_key,
+			webhook.WithWebhookType(webhook_type),
+			webhook.WithServerAddress(server.Address(webhook_type)),
+			webhook.WithSecret(secret),
+		).SendMessageText("test")
+		if !errors.As(err, &webhook_error) || !webhook_error.IsRateLimited() {
+			t.Errorf("%s: err = %v, want rate limited", webhook_type, err)
+		}
+	}
+
+	// 钉钉、飞书签名错误
+	for _, webhook_type := range []string{webhook.WEBHOOK_TYPE_DINGDING, webhook.WEBHOOK_TYPE_FEISHU} {
+		err := webhook.New(
+			api_key,
+			webhook.WithWebhookType(webhook_type),
+			webhook.WithServerAddress(server.Address(webhook_type)),
+			webhook.WithSecret("wrong_secret"),
+		).SendMessageText("test")
+		if err == nil {
+			t.Errorf("%s: expect sign error", webhook_type)
+		}
+	}
+
+	// 关闭拆分后，企微超长消息返回错误码
+	server.Reset()
+	err := webhook.New(
+		api_key,
+		webhook.WithServerAddress(server.WeiXinWorkAddress()),
+		webhook.WithSplitMessage(false),
+	).SendMessageText(strings.Repeat("a", 3000))
+	var webhook_error *webhook.WebhookError
+	if !errors.As(err, &webhook_error) || webhook_error.Code != 40058 {
+		t.Errorf("err = %v, want 40058", err)
+	}
+
+	// 企微上传文件
+	media_id, err := webhook.New(api_key, webhook.WithServerAddress(server.WeiXinWorkAddress())).
+		UploadMedia("test.txt", []byte("hello"), webhook.WEIXIN_WORK_MEDIA_TYPE_FILE)
+	if err != nil || media_id == "" {
+		t.Fatalf("UploadMedia() = %q, %v", media_id, err)
+	}
+	request, _ := server.LastRequest()
+	if _, files, _ := webhooktest.ParseMultipart(request); string(files["media"]) != "hello" {
+		t.Error(files)
+	}
+
+	// 飞书上传图片后发送
+	feishu_open_api_address := webhook.FEISHU_OPEN_API_ADDRESS
+	webhook.FEISHU_OPEN_API_ADDRESS = server.FeiShuOpenAPIAddress()
+	defer func() { webhook.FEISHU_OPEN_API_ADDRESS = feishu_open_api_address }()
+	err = webhook.New(
+		api_key,
+		webhook.WithWebhookType(webhook.WEBHOOK_TYPE_FEISHU),
+		webhook.WithServerAddress(server.FeiShuAddress()),
+		webhook.WithSecret(secret),
+		webhook.WithFeiShuApp("app_id", "app_secret"),
+	).SendMessageImage(image.NewRGBA(image.Rect(0, 0, 10, 10)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	payloads := server.Payloads()
+	last := payloads[len(payloads)-1]
+	if last["msg_type"] != "image" || !strings.HasPrefix(last["content"].(map[string]any)["image_key"].(string), "img_v2_") {
+		t.Error(last)
+	}
+}
+
+func TestSendMessageImage(t *testing.T) {
+	var request_data map[string]map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		request_data = map[string]map[string]string{}
+		json.Unmarshal(body, &request_data)
+		w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	defer server.Close()
+
+	rgba := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	image_bytes := text_drawer.ImageToByte(rgba)
+
+	// 企微机器人：直接发送 base64 和 md5
+	err := webhook.New(
+		"your_api_key",
+		webhook.WithServerAddress(server.URL+"/send?key="),
+	).SendMessageImage(rgba)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request_data["image"]["md5"] != hash.MD5EncodeByte(image_bytes) {
+		t.Error(request_data)
+	}
+	if request_data["image"]["base64"] != text_drawer.GetImageBase64(rgba) || request_data["image"]["md5"] != text_drawer.GetImageMD5(rgba) {
+		t.Error("image payload should match text_drawer.GetImageBase64/GetImageMD5")
+	}
+
+	// 钉钉机器人：上传图片后发送 markdown 图片链接
+	err = webhook.New(
+		"your_api_key",
+		webhook.WithWebhookType(webhook.WEBHOOK_TYPE_DINGDING),
+		webhook.WithServerAddress(server.URL+"/send?access_token="),
+		webhook.WithImageUploader(func(image_bytes []byte) (string, error) {
+			return "https://example.com/image.jpg", nil
+		}),
+	).SendMessageImage(rgba)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(request_data["markdown"]["text"], "https://example.com/image.jpg") {
+		t.Error(request_data)
+	}
+
+	// 飞书机器人：未指定上传函数时需要 WithFeiShuApp
+	err = webhook.New(
+		"your_api_key",
+		webhook.WithWebhookType(webhook.WEBHOOK_TYPE_FEISHU),
+		webhook.WithServerAddress(server.URL+"/hook/"),
+	).SendMessageImage(rgba)
+	if err == nil {
+		t.Error("expect error without feishu app")
+	}
+	fmt.Println(err)
+}
+
+func TestSendMessageWithSecretDingDing(t *testing.T) {
+	secret := "SEC000000000000000000000000000000000000000000000000000000000000000"
+	var query map[string][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	defer server.Close()
+
+	err := webhook.New(
+		"your_api_key",
+		webhook.WithWebhookType(webhook.WEBHOOK_TYPE_DINGDING),
+		webhook.WithServerAddress(server.URL+"/robot/send?access_token="),
+		webhook.WithSecret(secret),
+	).SendMessageText("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	timestamp := query["timestamp"][0]
+	sign := hash.HMACSHA256EncodeToBase64(timestamp+"\n"+secret, secret)
+	if query["sign"][0] != sign || query["access_token"][0] != "your_api_key" {
+		t.Error(query)
+	}
+}
+
+func TestSendMessageWithSecretFeiShu(t *testing.T) {
+	secret := "your_secret"
+	var request_data map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		request_data = map[string]any{}
+		json.Unmarshal(body, &request_data)
+		w.Write([]byte(`{"code":0,"msg":"success","data":{}}`))
+	}))
+	defer server.Close()
+
+	webhook_sender := webhook.New(
+		"your_api_key",
+		webhook.WithWebhookType(webhook.WEBHOOK_TYPE_FEISHU),
+		webhook.WithServerAddress(server.URL+"/open-apis/bot/v2/hook/"),
+		webhook.WithSecret(secret),
+	)
+	content := map[string]any{"msg_type": "text", "content": map[string]string{"text": "test"}}
+	for _, send := range []func() error{
+		func() error { return webhook_sender.SendMessageText("test") },
+		func() error { return webhook_sender.SendMessageMarkdown("test") },
+		func() error { return webhook_sender.SendMessage(content) },
+	} {
+		if err := send(); err != nil {
+			t.Fatal(err)
+		}
+		timestamp, _ := request_data["timestamp"].(string)
+		sign := hash.HMACSHA256EncodeToBase64("", timestamp+"\n"+secret)
+		if timestamp == "" || request_data["sign"] != sign {
+			t.Error(request_data)
+		}
+	}
+	if _, ok := content["sign"]; ok {
+		t.Error("content should not be modified")
+	}
+}
+
+func TestSendMessageWebhookError(t *testing.T) {
+	response_body := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(response_body))
+	}))
+	defer server.Close()
+
+	cases := []struct {
+		webhook_type   string
+		response_body  string
+		is_invalid_key bool
+		is_rate_limit  bool
+	}{
+		{webhook.WEBHOOK_TYPE_WEIXIN_WORK, `{"errcode":93000,"errmsg":"invalid webhook url"}`, true, false},
+		{webhook.WEBHOOK_TYPE_DINGDING, `{"errcode":310000,"errmsg":"keywords not in content"}`, false, false},
+		{webhook.WEBHOOK_TYPE_DINGDING, `{"errcode":130101,"errmsg":"send too fast"}`, false, true},
+		{webhook.WEBHOOK_TYPE_FEISHU, `{"code":19001,"msg":"param invalid: incoming webhook access token invalid","data":{}}`, true, false},
+	}
+	for _, c := range cases {
+		response_body = c.response_body
+		err := webhook.New(
+			"your_api_key",
+			webhook.WithWebhookType(c.webhook_type),
+			webhook.WithServerAddress(server.URL+"/"),
+		).SendMessageText("test")
 		fmt.Println(err)
-		t.Failed()
+		var webhook_error *webhook.WebhookError
+		if !errors.As(err, &webhook_error) {
+			t.Fatal(err)
+		}
+		if webhook_error.IsInvalidKey() != c.is_invalid_key || webhook_error.IsRateLimited() != c.is_rate_limit {
+			t.Error(webhook_error)
+		}
+	}
+
+	response_body = `{"errcode":0,"errmsg":"ok"}`
+	err := webhook.New("your_api_key", webhook.WithServerAddress(server.URL+"/")).SendMessageText("test")
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSendMessageRetry(t *testing.T) {
+	count_request := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count_request++
+		if strings.Contains(r.URL.RawQuery, "invalid") {
+			w.Write([]byte(`{"errcode":300001,"errmsg":"token is not exist"}`))
+			return
+		}
+		if count_request < 3 {
+			w.Write([]byte(`{"errcode":130101,"errmsg":"send too fast"}`))
+			return
+		}
+		w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	defer server.Close()
+
+	options := []webhook.OptionFunc{
+		webhook.WithWebhookType(webhook.WEBHOOK_TYPE_DINGDING),
+		webhook.WithServerAddress(server.URL + "/robot/send?access_token="),
+		webhook.WithRetry(3, time.Millisecond, 10*time.Millisecond),
+	}
+	err := webhook.New("your_api_key", options...).SendMessageText("test")
+	if err != nil || count_request != 3 {
+		t.Error(count_request, err)
+	}
+
+	// key 无效时不重试
+	count_request = 0
+	err = webhook.New("invalid", options...).SendMessageText("test")
+	if err == nil || count_request != 1 {
+		t.Error(count_request, err)
+	}
+
+	// 响应解析失败时不重试
+	invalid_server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count_request++
+		w.Write([]byte(`not json`))
+	}))
+	defer invalid_server.Close()
+	count_request = 0
+	err = webhook.New("your_api_key", webhook.WithServerAddress(invalid_server.URL+"/?key="), webhook.WithRetry(3, time.Millisecond, 0)).SendMessageText("test")
+	if err == nil || count_request != 1 || webhook.IsRetryable(err) {
+		t.Error(count_request, err)
+	}
+
+	// 网络请求失败时重试
+	closed_server := httptest.NewServer(http.NotFoundHandler())
+	closed_server.Close()
+	err = webhook.New("your_api_key", webhook.WithServerAddress(closed_server.URL+"/?key="), webhook.WithRetry(1, time.Millisecond, 0)).SendMessageText("test")
+	if err == nil || !webhook.IsRetryable(err) {
+		t.Error(err)
+	}
+
+	// 请求超时时平台可能已收到消息，默认不重试
+	slow_server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count_request++
+		select {
+		case <-r.Context().Done():
+		case <-time.After(2 * time.Second):
+		}
+	}))
+	defer slow_server.Close()
+	count_request = 0
+	options = []webhook.OptionFunc{
+		webhook.WithServerAddress(slow_server.URL + "/?key="),
+		webhook.WithTimeout(50 * time.Millisecond),
+		webhook.WithRetry(2, time.Millisecond, 0),
+	}
+	err = webhook.New("your_api_key", options...).SendMessageText("test")
+	if err == nil || count_request != 1 || webhook.IsRetryable(err) || !webhook.IsNetworkError(err) {
+		t.Error(count_request, err)
+	}
+
+	// WithRetryNetworkErrors 时重试所有网络错误
+	count_request = 0
+	err = webhook.New("your_api_key", append(options, webhook.WithRetryNetworkErrors())...).SendMessageText("test")
+	if err == nil || count_request != 3 {
+		t.Error(count_request, err)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	rate_limiter := webhook.NewRateLimiter(2, 100*time.Millisecond)
+	if rate_limiter.Reserve() != 0 || rate_limiter.Reserve() != 0 {
+		t.Error("expect no delay")
+	}
+	delay := rate_limiter.Reserve()
+	fmt.Println(delay)
+	if delay <= 0 || delay > 50*time.Millisecond {
+		t.Error(delay)
+	}
+
+	// 相同机器人使用不同的限流配置时分别限流
+	limiter_server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	defer limiter_server.Close()
+	limiter_address := webhook.WithServerAddress(limiter_server.URL + "/?key=")
+	if err := webhook.New("limiter", limiter_address, webhook.WithRateLimit(1, time.Hour)).SendMessageText("test"); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := webhook.New("limiter", limiter_address, webhook.WithRateLimit(10, 10*time.Millisecond)).SendMessageText("test"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("rate limit config ignored, took %v", time.Since(start))
+	}
+
+	retry_policy := webhook.RetryPolicy{MaxRetries: 5, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for attempt, max_delay := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		delay := retry_policy.Delay(attempt)
+		if delay < max_delay*time.Millisecond/2 || delay > max_delay*time.Millisecond {
+			t.Error(attempt, delay)
+		}
+	}
+
+	// MaxDelay 为 0 时不限制最大等待时间
+	retry_policy = webhook.RetryPolicy{MaxRetries: 5, BaseDelay: 100 * time.Millisecond}
+	for attempt, max_delay := range []time.Duration{100, 200, 400, 800, 1600} {
+		delay := retry_policy.Delay(attempt)
+		if delay < max_delay*time.Millisecond/2 || delay > max_delay*time.Millisecond {
+			t.Error(attempt, delay)
+		}
+	}
+	if delay := retry_policy.Delay(100); delay <= 0 {
+		t.Error("delay overflow", delay)
+	}
+}
+
+// 使用 go test -race 运行，验证同一个 WebhookSender 可在多个 goroutine 中并发使用
+func TestSendMessageConcurrent(t *testing.T) {
+	for _, webhook_type := range []string{webhook.WEBHOOK_TYPE_WEIXIN_WORK, webhook.WEBHOOK_TYPE_DINGDING, webhook.WEBHOOK_TYPE_FEISHU} {
+		var mutex sync.Mutex
+		received := map[string]bool{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			mutex.Lock()
+			received[string(body)] = true
+			mutex.Unlock()
+			w.Write([]byte(`{"errcode":0,"errmsg":"ok","code":0,"msg":"success"}`))
+		}))
+
+		webhook_sender := webhook.New(
+			"your_api_key",
+			webhook.WithWebhookType(webhook_type),
+			webhook.WithServerAddress(server.URL+"/"),
+		)
+		count := 50
+		var wait_group sync.WaitGroup
+		for i := 0; i < count; i++ {
+			wait_group.Add(1)
+			go func(i int) {
+				defer wait_group.Done()
+				content := fmt.Sprintf("message-%d", i)
+				var err error
+				if i%2 == 0 {
+					err = webhook_sender.SendMessageText(content)
+				} else {
+					err = webhook_sender.SendMessageMarkdown(content)
+				}
+				if err != nil {
+					t.Error(err)
+				}
+			}(i)
+		}
+		wait_group.Wait()
+		server.Close()
+
+		if len(received) != count {
+			t.Errorf("%s: expect %d distinct payloads, got %d", webhook_type, count, len(received))
+		}
+		for i := 0; i < count; i++ {
+			found := false
+			for body := range received {
+				if strings.Contains(body, fmt.Sprintf(`"message-%d"`, i)) {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("%s: message-%d not received", webhook_type, i)
+			}
+		}
+	}
+	template, _ := webhook.GetMessageTemplate(webhook.WEBHOOK_TYPE_WEIXIN_WORK, webhook.MESSAGE_TYPE_TEXT)
+	if template["text"].(map[string]any)["content"] != "" {
+		t.Error("message template should not be modified")
+	}
+}
+
+func TestProviders(t *testing.T) {
+	var request_path string
+	var request_data map[string]any
+	status_code := http.StatusOK
+	response_body := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		request_path = r.URL.Path
+		request_data = map[string]any{}
+		json.Unmarshal(body, &request_data)
+		w.WriteHeader(status_code)
+		w.Write([]byte(response_body))
+	}))
+	defer server.Close()
+
+	telegram_provider := &webhook.TelegramProvider{ChatID: "10086"}
+	cases := []struct {
+		option        webhook.OptionFunc
+		response_body string
+		request_path  string
+		expect_key    string
+		expect_value  any
+	}{
+		{webhook.WithWebhookType(webhook.WEBHOOK_TYPE_SLACK), "ok", "/your_api_key", "text", "test"},
+		{webhook.WithWebhookType(webhook.WEBHOOK_TYPE_DISCORD), "", "/your_api_key", "content", "test"},
+		{webhook.WithProvider(telegram_provider), `{"ok":true,"result":{}}`, "/your_api_key/sendMessage", "chat_id", "10086"},
+		{webhook.WithWebhookType(webhook.WEBHOOK_TYPE_TEAMS), "1", "/your_api_key", "@type", "MessageCard"},
+		{webhook.WithWebhookType(webhook.WEBHOOK_TYPE_GENERIC), "", "/your_api_key", "content", "test"},
+	}
+	for _, c := range cases {
+		response_body = c.response_body
+		err := webhook.New("your_api_key", c.option, webhook.WithServerAddress(server.URL+"/")).SendMessageMarkdown("test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if request_path != c.request_path || request_data[c.expect_key] != c.expect_value {
+			t.Error(request_path, request_data)
+		}
+	}
+
+	// 平台返回错误
+	status_code = http.StatusNotFound
+	response_body = `{"message": "Unknown Webhook", "code": 10015}`
+	err := webhook.New("your_api_key", webhook.WithWebhookType(webhook.WEBHOOK_TYPE_DISCORD), webhook.WithServerAddress(server.URL+"/")).SendMessageText("test")
+	var webhook_error *webhook.WebhookError
+	if !errors.As(err, &webhook_error) || !webhook_error.IsInvalidKey() {
+		t.Error(err)
+	}
+	status_code = http.StatusTooManyRequests
+	response_body = `{"ok":false,"error_code":429,"description":"Too Many Requests: retry after 5"}`
+	err = webhook.New("your_api_key", webhook.WithProvider(telegram_provider), webhook.WithServerAddress(server.URL+"/")).SendMessageText("test")
+	if !errors.As(err, &webhook_error) || !webhook_error.IsRateLimited() {
+		t.Error(err)
+	}
+	fmt.Println(err)
+
+	// 注册自定义平台
+	status_code = http.StatusOK
+	response_body = ""
+	provider, err := webhook.NewGenericProvider("自定义机器人", server.URL+"/custom/", `{"body": {"text": {{json .Content}}}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	webhook.RegisterProvider(provider)
+	err = webhook.New("your_api_key", webhook.WithWebhookType("自定义机器人")).SendMessageText("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request_path != "/custom/your_api_key" || request_data["body"].(map[string]any)["text"] != "test" {
+		t.Error(request_path, request_data)
+	}
+}
+
+func TestSendMessageMention(t *testing.T) {
+	var request_data map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		request_data = map[string]any{}
+		json.Unmarshal(body, &request_data)
+		w.Write([]byte(`{"errcode":0,"errmsg":"ok","code":0,"msg":"success"}`))
+	}))
+	defer server.Close()
+
+	mention := webhook.Mention{UserIDs: []string{"zhangsan"}, Mobiles: []string{"13800000000"}, AtAll: true}
+
+	// 企微机器人 text 类型
+	err := webhook.New("your_api_key", webhook.WithServerAddress(server.URL+"/"), webhook.WithMention(mention)).SendMessageText("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println(request_data)
+	if common.MapToJsonString(request_data) != `{"msgtype":"text","text":{"content":"test","mentioned_list":["zhangsan","@all"],"mentioned_mobile_list":["13800000000"]}}` {
+		t.Error(request_data)
+	}
+
+	// 企微机器人 markdown 类型不支持@手机号，消息仍会发送并返回警告
+	err = webhook.New("your_api_key", webhook.WithServerAddress(server.URL+"/"), webhook.WithMention(mention)).SendMessageMarkdown("test")
+	fmt.Println(err)
+	if !webhook.IsWarning(err) || common.MapGetValueToString(request_data, "markdown.content") != "test\n<@zhangsan>" {
+		t.Error(err, request_data)
+	}
+
+	// 钉钉机器人
+	err = webhook.New(
+		"your_api_key",
+		webhook.WithWebhookType(webhook.WEBHOOK_TYPE_DINGDING),
+		webhook.WithServerAddress(server.URL+"/"),
+	).Send(&webhook.Message{MessageType: webhook.MESSAGE_TYPE_MARKDOWN, Content: "test", Mention: &mention})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println(request_data)
+	if common.MapGetValueToString(request_data, "markdown.text") != "test\n@13800000000\n@zhangsan" || common.MapGetValue[bool](request_data, "at.isAtAll") != true {
+		t.Error(request_data)
+	}
+
+	// 飞书机器人不支持@手机号
+	err = webhook.New(
+		"your_api_key",
+		webhook.WithWebhookType(webhook.WEBHOOK_TYPE_FEISHU),
+		webhook.WithServerAddress(server.URL+"/"),
+		webhook.WithMention(mention),
+	).SendMessageText("test")
+	fmt.Println(err)
+	if !webhook.IsWarning(err) || common.MapGetValueToString(request_data, "content.text") != "test\n<at user_id=\"zhangsan\"></at>\n<at user_id=\"all\">所有人</at>" {
+		t.Error(err, request_data)
+	}
+}
+
+func TestFeiShuPostAndCard(t *testing.T) {
+	post := webhook.NewFeiShuPost("标题").
+		AddParagraph(webhook.FeiShuPostText("告警: "), webhook.FeiShuPostLink("详情", "https://example.com")).
+		AddParagraph(webhook.FeiShuPostAt("all")).
+		ToMap()
+	fmt.Println(common.MapToJsonString(post))
+	if common.MapToJsonString(post) != `{"content":{"post":{"zh_cn":{"content":[[{"tag":"text","text":"告警: "},{"href":"https://example.com","tag":"a","text":"详情"}],[{"tag":"at","user_id":"all"}]],"title":"标题"}}},"msg_type":"post"}` {
+		t.Error(post)
+	}
+
+	card := webhook.NewFeiShuCard("服务告警", "red").
+		AddMarkdown("**主机**: web-01").
+		AddFields(webhook.NewFeiShuCardField(true, "**级别**\nP1")).
+		AddDivider().
+		AddButtons(webhook.NewFeiShuCardButton("查看详情", "https://example.com", "primary")).
+		ToMap()
+	fmt.Println(common.MapToJsonString(card))
+	if common.MapGetValueToString(card, "msg_type") != "interactive" || common.MapGetValueToString(card, "card.header.template") != "red" {
+		t.Error(card)
+	}
+	if len(common.MapGetValue[[]any](card, "card.elements")) != 4 {
+		t.Error(card)
+	}
+
+	// 飞书机器人的 markdown 类型使用消息卡片发送
+	var request_data map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		request_data = map[string]any{}
+		json.Unmarshal(body, &request_data)
+		w.Write([]byte(`{"code":0,"msg":"success"}`))
+	}))
+	defer server.Close()
+	err := webhook.New(
+		"your_api_key",
+		webhook.WithWebhookType(webhook.WEBHOOK_TYPE_FEISHU),
+		webhook.WithServerAddress(server.URL+"/"),
+		webhook.WithMessageTitle("告警"),
+		webhook.WithMention(webhook.Mention{AtAll: true}),
+	).SendMessageMarkdown("**test**")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println(common.MapToJsonString(request_data))
+	elements := common.MapGetValue[[]any](request_data, "card.elements")
+	if len(elements) != 1 || common.MapGetValueToString(elements[0].(map[string]any), "text.content") != "**test**\n<at id=all></at>" {
+		t.Error(request_data)
+	}
+	if common.MapGetValueToString(request_data, "card.header.title.content") != "告警" {
+		t.Error(request_data)
+	}
+}
+
+func TestWeiXinWorkFileAndCard(t *testing.T) {
+	var request_data map[string]any
+	var upload_content string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cgi-bin/webhook/upload_media", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("key") != "your_api_key" || r.URL.Query().Get("type") != "file" {
+			w.Write([]byte(`{"errcode":93000,"errmsg":"invalid webhook url"}`))
+			return
+		}
+		file, header, err := r.FormFile("media")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		content, _ := io.ReadAll(file)
+		upload_content = header.Filename + ":" + string(content)
+		w.Write([]byte(`{"errcode":0,"errmsg":"ok","type":"file","media_id":"media_id_001","created_at":"1380000000"}`))
+	})
+	mux.HandleFunc("/cgi-bin/webhook/send", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		request_data = map[string]any{}
+		json.Unmarshal(body, &request_data)
+		w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	webhook_sender := webhook.New("your_api_key", webhook.WithServerAddress(server.URL+"/cgi-bin/webhook/send?key="))
+	err := webhook_sender.SendMessageFile("report.log", []byte("log content"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upload_content != "report.log:log content" || common.MapGetValueToString(request_data, "file.media_id") != "media_id_001" {
+		t.Error(upload_content, request_data)
+	}
+
+	err = webhook_sender.SendMessage(webhook.NewWeiXinWorkNews(webhook.WeiXinWorkArticle{Title: "日报", URL: "https://example.com"}).ToMap())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if common.MapGetValueToString(request_data, "msgtype") != "news" {
+		t.Error(request_data)
+	}
+
+	card := webhook.NewWeiXinWorkTemplateCard("text_notice", "服务告警", "web-01 CPU 使用率过高").
+		SetEmphasisContent("95%", "CPU 使用率").
+		AddHorizontalContent("级别", "P1", "").
+		AddJump("查看详情", "https://example.com").
+		SetCardAction("https://example.com")
+	err = webhook_sender.SendMessage(card.ToMap())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println(common.MapToJsonString(request_data))
+	if common.MapGetValueToString(request_data, "template_card.emphasis_content.title") != "95%" || common.MapGetValueToString(request_data, "template_card.card_action.type") != "1" {
+		t.Error(request_data)
+	}
+}
+
+func TestSplitContent(t *testing.T) {
+	lines := []string{}
+	for i := 0; i < 50; i++ {
+		lines = append(lines, fmt.Sprintf("line-%02d", i))
+	}
+	content := strings.Join(lines, "\n")
+	parts, err := webhook.SplitContent(content, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println(len(parts), parts[0])
+	joined := []string{}
+	for i, part := range parts {
+		if len(part) > 100 || !strings.HasPrefix(part, fmt.Sprintf("(%d/%d)\n", i+1, len(parts))) {
+			t.Error(part)
+		}
+		joined = append(joined, strings.SplitN(part, "\n", 2)[1])
+	}
+	if strings.Join(joined, "\n") != content {
+		t.Error("content changed after split")
+	}
+
+	// 单行超长时不截断 UTF-8 字符
+	parts, err = webhook.SplitContent(strings.Repeat("测试", 100), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, part := range parts {
+		if len(part) > 100 || !utf8.ValidString(part) {
+			t.Error(part)
+		}
+	}
+
+	// limit 无法容纳编号或单个字符时返回错误，不会死循环，也不会返回超出 limit 的部分
+	for _, limit := range []int{2, 16} {
+		done := make(chan error)
+		go func() {
+			_, err := webhook.SplitContent(strings.Repeat("测试", 10), limit)
+			done <- err
+		}()
+		select {
+		case err = <-done:
+			if !errors.Is(err, webhook.ErrContentLimitTooSmall) {
+				t.Errorf("limit %d: err = %v, want ErrContentLimitTooSmall", limit, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("SplitContent did not return")
+		}
+	}
+	// 最小的可用 limit，每部分一个字符
+	parts, err = webhook.SplitContent(strings.Repeat("测试", 10), 17)
+	if err != nil || len(parts) != 20 {
+		t.Error(len(parts), err)
+	}
+	for _, part := range parts {
+		if len(part) > 17 || !utf8.ValidString(part) {
+			t.Error(part)
+		}
+	}
+
+	// 代码块被拆分时补全并重新打开
+	content = "日志如下:\n```log\n" + strings.Join(lines, "\n") + "\n```\n结束"
+	parts, err = webhook.SplitContent(content, 120)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, part := range parts {
+		if len(part) > 120 || strings.Count(part, "```")%2 != 0 {
+			t.Error(part)
+		}
+	}
+	fmt.Println(parts[1])
+	if !strings.Contains(parts[1], "```log\n") {
+		t.Error(parts[1])
+	}
+
+	// 超出企微机器人 text 类型 2048 字节时自动拆分发送
+	request_contents := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		request_data := map[string]any{}
+		json.Unmarshal(body, &request_data)
+		request_contents = append(request_contents, common.MapGetValueToString(request_data, "text.content"))
+		w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	defer server.Close()
+	err = webhook.New("your_api_key", webhook.WithServerAddress(server.URL+"/")).SendMessageText(strings.Repeat("0123456789\n", 500))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(request_contents) != 3 {
+		t.Error(len(request_contents))
+	}
+	for _, request_content := range request_contents {
+		if len(request_content) > 2048 {
+			t.Error(len(request_content))
+		}
+	}
+
+	// @提醒预留的长度超出平台限制时返回错误，不发送超长消息
+	request_contents = []string{}
+	mobiles := []string{}
+	for i := 0; i < 100; i++ {
+		mobiles = append(mobiles, fmt.Sprintf("138%08d", i))
+	}
+	err = webhook.New("your_api_key", webhook.WithServerAddress(server.URL+"/")).Send(&webhook.Message{
+		MessageType: webhook.MESSAGE_TYPE_TEXT,
+		Content:     strings.Repeat("0123456789\n", 200),
+		Mention:     &webhook.Mention{Mobiles: mobiles},
+	})
+	if err == nil || len(request_contents) != 0 {
+		t.Error(len(request_contents), err)
+	}
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	content := strings.Join([]string{
+		"## 服务告警",
+		`状态: <font color="red">触发</font>`,
+		"详情: [查看](https://example.com)",
+		"",
+		"| 主机 | 值 |",
+		"| --- | --- |",
+		"| web-01 | 95% |",
+		"```",
+		"## 代码块内不转换",
+		"```",
+	}, "\n")
+
+	cases := map[string]string{
+		webhook.WEBHOOK_TYPE_WEIXIN_WORK: "## 服务告警\n状态: <font color=\"warning\">触发</font>\n详情: [查看](https://example.com)\n\n```\n主机   | 值\n-------+----\nweb-01 | 95%\n```\n```\n## 代码块内不转换\n```",
+		webhook.WEBHOOK_TYPE_DINGDING:    "## 服务告警\n状态: <font color=\"#FF0000\">触发</font>\n详情: [查看](https://example.com)\n\n```\n主机   | 值\n-------+----\nweb-01 | 95%\n```\n```\n## 代码块内不转换\n```",
+		webhook.WEBHOOK_TYPE_FEISHU:      "**服务告警**\n状态: <font color=\"red\">触发</font>\n详情: [查看](https://example.com)\n\n```\n主机   | 值\n-------+----\nweb-01 | 95%\n```\n```\n## 代码块内不转换\n```",
+		webhook.WEBHOOK_TYPE_SLACK:       "*服务告警*\n状态: 触发\n详情: <https://example.com|查看>\n\n```\n主机   | 值\n-------+----\nweb-01 | 95%\n```\n```\n## 代码块内不转换\n```",
+		webhook.WEBHOOK_TYPE_GENERIC:     content,
+	}
+	for webhook_type, expect := range cases {
+		result := webhook.RenderMarkdown(webhook_type, content)
+		if result != expect {
+			t.Errorf("%s:\n%s", webhook_type, result)
+		}
+	}
+
+	result := webhook.StripMarkdown(content)
+	fmt.Println(result)
+	if result != "服务告警\n状态: 触发\n详情: 查看 (https://example.com)\n\n主机   | 值\n-------+----\nweb-01 | 95%\n## 代码块内不转换" {
+		t.Error(result)
+	}
+}
+
+func TestDispatcher(t *testing.T) {
+	spool_dir := t.TempDir()
+
+	// 模拟无响应的机器人，消息保留在落盘目录中
+	release := make(chan struct{})
+	blocking_server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	defer blocking_server.Close()
+	dispatcher, err := webhook.NewDispatcher(
+		webhook.New("your_api_key", webhook.WithServerAddress(blocking_server.URL+"/")),
+		webhook.WithDispatcherSpoolDir(spool_dir),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		close(release)
+		dispatcher.Close()
+	}()
+	for i := 0; i < 3; i++ {
+		if err = dispatcher.SendMessageText(fmt.Sprintf("message-%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	file_paths, _ := filepath.Glob(filepath.Join(spool_dir, "*.json"))
+	if len(file_paths) != 3 || dispatcher.Stats().QueueDepth != 3 {
+		t.Error(file_paths, dispatcher.Stats())
+	}
+
+	// 落盘目录不能被多个 dispatcher 共享
+	if _, err = webhook.NewDispatcher(webhook.New("your_api_key"), webhook.WithDispatcherSpoolDir(spool_dir)); !errors.Is(err, webhook.ErrSpoolDirInUse) {
+		t.Errorf("err = %v, want ErrSpoolDirInUse", err)
+	}
+
+	// 复制落盘文件模拟进程崩溃，重启后重新发送落盘的消息
+	restart_dir := t.TempDir()
+	for _, file_path := range file_paths {
+		data, _ := os.ReadFile(file_path)
+		os.WriteFile(filepath.Join(restart_dir, filepath.Base(file_path)), data, 0o644)
+	}
+	var mutex sync.Mutex
+	received := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		request_data := map[string]any{}
+		json.Unmarshal(body, &request_data)
+		mutex.Lock()
+		received = append(received, common.MapGetValueToString(request_data, "text.content"))
+		mutex.Unlock()
+		if common.MapGetValueToString(request_data, "text.content") == "invalid" {
+			w.Write([]byte(`{"errcode":93000,"errmsg":"invalid webhook url"}`))
+			return
+		}
+		w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	defer server.Close()
+	restarted_dispatcher, err := webhook.NewDispatcher(
+		webhook.New("your_api_key", webhook.WithServerAddress(server.URL+"/")),
+		webhook.WithDispatcherSpoolDir(restart_dir),
+		webhook.WithDispatcherWorkers(2),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restarted_dispatcher.SendMessageText("invalid")
+	if err = restarted_dispatcher.Close(); err != nil {
+		t.Fatal(err)
+	}
+	stats := restarted_dispatcher.Stats()
+	fmt.Println(received, stats)
+	if len(received) != 4 || stats.Sent != 3 || stats.Failed != 1 || stats.QueueDepth != 0 {
+		t.Error(received, stats)
+	}
+	failed_files, _ := restarted_dispatcher.FailedFiles()
+	if len(failed_files) != 1 {
+		t.Error(failed_files)
+	}
+	if restarted_dispatcher.SendMessageText("closed") != webhook.ErrDispatcherClosed {
+		t.Error("expect ErrDispatcherClosed")
+	}
+}
+
+// 使用 go test -race 运行，验证 Flush 与入队并发时不会破坏等待逻辑
+func TestDispatcherFlushConcurrent(t *testing.T) {
+	server := webhooktest.NewServer()
+	defer server.Close()
+	dispatcher, err := webhook.NewDispatcher(
+		webhook.New("your_api_key", webhook.WithServerAddress(server.WeiXinWorkAddress())),
+		webhook.WithDispatcherWorkers(4),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wait_group sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wait_group.Add(1)
+		go func() {
+			defer wait_group.Done()
+			for j := 0; j < 25; j++ {
+				dispatcher.SendMessageText(fmt.Sprintf("message-%d-%d", i, j))
+				dispatcher.Flush()
+			}
+		}()
+	}
+	wait_group.Wait()
+	dispatcher.Flush()
+	if stats := dispatcher.Stats(); stats.Sent != 100 || stats.QueueDepth != 0 {
+		t.Error(stats)
+	}
+	if err = dispatcher.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDispatcherCloseContext(t *testing.T) {
+	spool_dir := t.TempDir()
+	blocking_server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 读取完请求体后才能感知客户端断开连接
+		io.ReadAll(r.Body)
+		<-r.Context().Done()
+	}))
+	defer blocking_server.Close()
+	dispatcher, err := webhook.NewDispatcher(
+		webhook.New("your_api_key", webhook.WithServerAddress(blocking_server.URL+"/"), webhook.WithTimeout(time.Hour)),
+		webhook.WithDispatcherSpoolDir(spool_dir),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err = dispatcher.SendMessageText(fmt.Sprintf("message-%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// FlushContext 超时时停止等待
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err = dispatcher.FlushContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("FlushContext() = %v, want context.DeadlineExceeded", err)
+	}
+
+	// 机器人无响应时 CloseContext 超时返回，取消正在发送的消息，消息保留在落盘目录中
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err = dispatcher.CloseContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("CloseContext() = %v, want context.DeadlineExceeded", err)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Errorf("CloseContext took %v", time.Since(start))
+	}
+	stats := dispatcher.Stats()
+	file_paths, _ := filepath.Glob(filepath.Join(spool_dir, "*.json"))
+	failed_files, _ := dispatcher.FailedFiles()
+	if len(file_paths) != 3 || len(failed_files) != 0 || stats.Sent != 0 || stats.Failed != 0 || stats.QueueDepth != 0 {
+		t.Error(file_paths, failed_files, stats)
+	}
+
+	// 关闭后落盘目录可以被新的 dispatcher 使用，重新发送保留的消息
+	server := webhooktest.NewServer()
+	defer server.Close()
+	restarted_dispatcher, err := webhook.NewDispatcher(
+		webhook.New("your_api_key", webhook.WithServerAddress(server.WeiXinWorkAddress())),
+		webhook.WithDispatcherSpoolDir(spool_dir),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = restarted_dispatcher.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(server.Payloads()) != 3 {
+		t.Error(server.Payloads())
+	}
+}
+
+func TestAggregator(t *testing.T) {
+	server := webhooktest.NewServer()
+	defer server.Close()
+
+	aggregator := webhook.NewAggregator(
+		webhook.New("your_api_key", webhook.WithServerAddress(server.WeiXinWorkAddress())),
+		webhook.WithAggregatorWindow(200*time.Millisecond),
+	)
+	defer aggregator.Close()
+
+	for i := 0; i < 5; i++ {
+		if err := aggregator.SendMessageText("disk usage 90%"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if suppressed, err := aggregator.Send("cpu", &webhook.Message{MessageType: webhook.MESSAGE_TYPE_TEXT, Content: "cpu 95%"}); suppressed || err != nil {
+		t.Fatalf("Send() = %v, %v", suppressed, err)
+	}
+	if suppressed, _ := aggregator.Send("cpu", &webhook.Message{MessageType: webhook.MESSAGE_TYPE_TEXT, Content: "cpu 96%"}); !suppressed {
+		t.Error("expect suppressed by key")
+	}
+	// 只触发一次的告警不发送汇总和恢复通知
+	if err := aggregator.SendMessageText("memory 80%"); err != nil {
+		t.Fatal(err)
+	}
+	if len(server.Payloads()) != 3 {
+		t.Fatalf("payloads = %v", server.Payloads())
+	}
+
+	// 第一个窗口结束发送汇总，第二个窗口无重复发送恢复通知
+	contents := func() (contents []string) {
+		for _, payload := range server.Payloads() {
+			contents = append(contents, payload["text"].(map[string]any)["content"].(string))
+		}
+		return
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for (len(server.Payloads()) < 7 || len(aggregator.Stats()) > 0) && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	// 再等待一个窗口，确认没有多余的恢复通知
+	time.Sleep(300 * time.Millisecond)
+	got := strings.Join(contents(), "\n")
+	if len(server.Payloads()) != 7 || strings.Count(got, "memory 80%") != 1 {
+		t.Errorf("contents = %q", got)
+	}
+	for _, want := range []string{
+		"disk usage 90% repeated 4 times in 200ms",
+		"cpu 95% repeated 1 times in 200ms",
+		"disk usage 90% recovered",
+		"cpu 95% recovered",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("contents = %q, want %q", got, want)
+		}
+	}
+	if stats := aggregator.Stats(); len(stats) != 0 {
+		t.Errorf("stats = %v", stats)
+	}
+}
+
+func TestAggregatorSendFailure(t *testing.T) {
+	server := webhooktest.NewServer()
+	defer server.Close()
+	aggregator := webhook.NewAggregator(
+		webhook.New("your_api_key", webhook.WithServerAddress(server.WeiXinWorkAddress())),
+		webhook.WithAggregatorWindow(time.Hour),
+	)
+	defer aggregator.Close()
+
+	// 第一条消息发送失败时不抑制后续的重复消息
+	server.FailNext(93000, 1)
+	if suppressed, err := aggregator.Send("disk", &webhook.Message{MessageType: webhook.MESSAGE_TYPE_TEXT, Content: "disk 90%"}); suppressed || err == nil {
+		t.Fatalf("Send() = %v, %v, want error", suppressed, err)
+	}
+	if stats := aggregator.Stats(); len(stats) != 0 {
+		t.Errorf("stats = %v", stats)
+	}
+	if suppressed, err := aggregator.Send("disk", &webhook.Message{MessageType: webhook.MESSAGE_TYPE_TEXT, Content: "disk 91%"}); suppressed || err != nil {
+		t.Fatalf("Send() = %v, %v", suppressed, err)
+	}
+	if suppressed, _ := aggregator.Send("disk", &webhook.Message{MessageType: webhook.MESSAGE_TYPE_TEXT, Content: "disk 92%"}); !suppressed {
+		t.Error("expect suppressed after the first message is delivered")
+	}
+	payloads := server.Payloads()
+	if content := payloads[len(payloads)-1]["text"].(map[string]any)["content"]; content != "disk 91%" {
+		t.Errorf("content = %v", content)
+	}
+}
+
+// Close 等待正在发送的汇总完成，返回后不再发送消息
+func TestAggregatorClose(t *testing.T) {
+	var mutex sync.Mutex
+	received := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		request_data := map[string]any{}
+		json.Unmarshal(body, &request_data)
+		content := common.MapGetValueToString(request_data, "text.content")
+		if strings.Contains(content, "repeated") {
+			time.Sleep(300 * time.Millisecond)
+		}
+		mutex.Lock()
+		received = append(received, content)
+		mutex.Unlock()
+		w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	defer server.Close()
+	aggregator := webhook.NewAggregator(
+		webhook.New("your_api_key", webhook.WithServerAddress(server.URL+"/")),
+		webhook.WithAggregatorWindow(100*time.Millisecond),
+	)
+	for i := 0; i < 2; i++ {
+		aggregator.SendMessageText("disk usage 90%")
+	}
+	// 等待窗口结束，汇总正在发送时关闭
+	time.Sleep(150 * time.Millisecond)
+	aggregator.Close()
+	mutex.Lock()
+	count_received := len(received)
+	mutex.Unlock()
+	time.Sleep(300 * time.Millisecond)
+	mutex.Lock()
+	defer mutex.Unlock()
+	if count_received != 2 || len(received) != 2 || !strings.Contains(received[1], "repeated 1 times") {
+		t.Errorf("received = %q, count at Close = %d", received, count_received)
+	}
+}
+
+func TestSendMessageContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		if strings.Contains(r.URL.RawQuery, "slow") || strings.HasPrefix(r.URL.Path, "/slow") {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+			return
+		}
+		w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	defer server.Close()
+
+	// ctx 超时中断请求
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := webhook.New("slow", webhook.WithServerAddress(server.URL+"/send?key=")).SendMessageContext(ctx, webhook.NewWeiXinWorkText("test").ToMap())
+	if !errors.Is(err, context.DeadlineExceeded) || time.Since(start) > 2*time.Second {
+		t.Errorf("err = %v after %v, want context.DeadlineExceeded", err, time.Since(start))
+	}
+
+	// WithTimeout 限制单次请求
+	start = time.Now()
+	err = webhook.New("slow", webhook.WithServerAddress(server.URL+"/send?key="), webhook.WithTimeout(100*time.Millisecond)).SendMessageText("test")
+	if err == nil || time.Since(start) > 2*time.Second {
+		t.Errorf("err = %v after %v, want timeout", err, time.Since(start))
+	}
+
+	// 等待限流令牌时 ctx 超时
+	webhook_sender := webhook.New("fast", webhook.WithServerAddress(server.URL+"/send?key="), webhook.WithRateLimit(1, time.Hour))
+	if err = webhook_sender.SendContext(context.Background(), &webhook.Message{MessageType: webhook.MESSAGE_TYPE_TEXT, Content: "test"}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err = webhook_sender.SendContext(ctx, &webhook.Message{MessageType: webhook.MESSAGE_TYPE_TEXT, Content: "test"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want context.DeadlineExceeded", err)
+	}
+
+	// 上传图片时 ctx 超时中断请求
+	feishu_open_api_address := webhook.FEISHU_OPEN_API_ADDRESS
+	webhook.FEISHU_OPEN_API_ADDRESS = server.URL + "/slow"
+	defer func() { webhook.FEISHU_OPEN_API_ADDRESS = feishu_open_api_address }()
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	err = webhook.New(
+		"slow",
+		webhook.WithWebhookType(webhook.WEBHOOK_TYPE_FEISHU),
+		webhook.WithServerAddress(server.URL+"/send?key="),
+		webhook.WithFeiShuApp("app_id", "app_secret"),
+	).SendMessageImageContext(ctx, image.NewRGBA(image.Rect(0, 0, 10, 10)))
+	if err == nil || time.Since(start) > 2*time.Second {
+		t.Errorf("err = %v after %v, want timeout", err, time.Since(start))
+	}
+
+	// 上传文件时 ctx 超时中断请求
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	err = webhook.New("slow", webhook.WithServerAddress(server.URL+"/send?key=")).SendMessageFileContext(ctx, "test.txt", []byte("hello"))
+	if err == nil || time.Since(start) > 2*time.Second {
+		t.Errorf("err = %v after %v, want timeout", err, time.Since(start))
 	}
 }
@@ -258,23 +258,25 @@ func SaveImageToFile(rgba image.Image, file_path string) {
 }
 
 func GetImageBase64(rgba image.Image) (image_base64 string) {
-	buf := new(bytes.Buffer)
-	err := jpeg.Encode(buf, rgba, nil)
-	if err != nil {
+	return GetImageBytesBase64(ImageToByte(rgba))
+}
+
+func GetImageMD5(rgba image.Image) (image_MD5 string) {
+	return GetImageBytesMD5(ImageToByte(rgba))
+}
+
+// 获取已编码图片的 base64，image_bytes 为空时返回空字符串
+func GetImageBytesBase64(image_bytes []byte) (image_base64 string) {
+	if len(image_bytes) == 0 {
 		return
 	}
-	image_bytes := buf.Bytes()
-	image_base64 = hash.Base64Encode(string(image_bytes))
-	return
+	return hash.Base64Encode(string(image_bytes))
 }
 
-func GetImageMD5(rgba image.Image) (image_MD5 string) {
-	buf := new(bytes.Buffer)
-	err := jpeg.Encode(buf, rgba, nil)
-	if err != nil {
+// 获取已编码图片的 md5，image_bytes 为空时返回空字符串
+func GetImageBytesMD5(image_bytes []byte) (image_MD5 string) {
+	if len(image_bytes) == 0 {
 		return
 	}
-	image_bytes := buf.Bytes()
-	image_MD5 = hash.MD5EncodeByte(image_bytes)
-	return
+	return hash.MD5EncodeByte(image_bytes)
 }
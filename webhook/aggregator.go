@@ -0,0 +1,249 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SimoLin/go-utils/hash"
+)
+
+var ErrAggregatorClosed = errors.New("aggregator 已关闭")
+
+// 默认的汇总和恢复消息格式，参数依次为告警摘要、重复次数、窗口时长
+const (
+	DEFAULT_AGGREGATOR_SUMMARY_FORMAT  = "%s repeated %d times in %s"
+	DEFAULT_AGGREGATOR_RECOVERY_FORMAT = "%s recovered"
+)
+
+// 告警去重聚合，放在 WebhookSender 之前使用
+//
+//	相同指纹（调用方指定的 key，为空时为内容的 MD5）的消息只发送第一条，窗口内的重复消息被抑制并计数
+//	窗口结束时如有重复则发送一条汇总并开启下一个窗口；整个窗口内没有重复时视为告警停止，
+//	曾经抑制过重复（告警风暴）的告警发送恢复通知，只触发一次的告警直接移除
+//	第一条消息发送失败时移除该指纹，后续相同的消息不会被抑制
+type Aggregator struct {
+	webhook_sender  *WebhookSender
+	window          time.Duration
+	recovery        bool
+	summary_format  string
+	recovery_format string
+	error_handler   func(err error)
+	mutex           sync.Mutex
+	closed          bool
+	expiring        sync.WaitGroup // 正在发送的汇总和恢复通知，Close 等待其完成
+	groups          map[string]*aggregateGroup
+}
+
+// 同一指纹的告警
+type aggregateGroup struct {
+	fingerprint string
+	message     *Message
+	suppressed  int  // 当前窗口内被抑制的次数
+	storm       bool // 是否曾经抑制过重复，告警停止时只为告警风暴发送恢复通知
+	timer       *time.Timer
+}
+
+// 告警聚合状态
+type AggregateStats struct {
+	Fingerprint string
+	Suppressed  int
+}
+
+type AggregatorOptionFunc func(*Aggregator)
+
+// 可指定聚合窗口，默认为 5 分钟
+func WithAggregatorWindow(d time.Duration) AggregatorOptionFunc {
+	return func(aggregator *Aggregator) {
+		aggregator.window = d
+	}
+}
+
+// 是否在告警风暴（窗口内有重复）停止时发送恢复通知，默认为 true
+func WithAggregatorRecovery(b bool) AggregatorOptionFunc {
+	return func(aggregator *Aggregator) {
+		aggregator.recovery = b
+	}
+}
+
+// 可指定汇总消息格式，参数依次为告警摘要(%s)、重复次数(%d)、窗口时长(%s)
+func WithAggregatorSummaryFormat(s string) AggregatorOptionFunc {
+	return func(aggregator *Aggregator) {
+		aggregator.summary_format = s
+	}
+}
+
+// 可指定恢复通知格式，参数为告警摘要(%s)
+func WithAggregatorRecoveryFormat(s string) AggregatorOptionFunc {
+	return func(aggregator *Aggregator) {
+		aggregator.recovery_format = s
+	}
+}
+
+// 汇总和恢复通知在后台发送，发送失败时调用，默认忽略
+func WithAggregatorErrorHandler(f func(err error)) AggregatorOptionFunc {
+	return func(aggregator *Aggregator) {
+		aggregator.error_handler = f
+	}
+}
+
+func NewAggregator(webhook_sender *WebhookSender, options ...AggregatorOptionFunc) *Aggregator {
+	aggregator := &Aggregator{
+		webhook_sender:  webhook_sender,
+		window:          5 * time.Minute,
+		recovery:        true,
+		summary_format:  DEFAULT_AGGREGATOR_SUMMARY_FORMAT,
+		recovery_format: DEFAULT_AGGREGATOR_RECOVERY_FORMAT,
+		error_handler:   func(err error) {},
+		groups:          map[string]*aggregateGroup{},
+	}
+	for _, option_func := range options {
+		option_func(aggregator)
+	}
+	return aggregator
+}
+
+// 计算消息指纹，key 为空时使用内容的 MD5
+func Fingerprint(key string, message *Message) string {
+	if key != "" {
+		return key
+	}
+	return hash.MD5Encode(message.Content)
+}
+
+// 发送消息，窗口内重复的消息被抑制时返回 suppressed 为 true
+func (aggregator *Aggregator) Send(key string, message *Message) (suppressed bool, err error) {
+	fingerprint := Fingerprint(key, message)
+	aggregator.mutex.Lock()
+	if aggregator.closed {
+		aggregator.mutex.Unlock()
+		return false, ErrAggregatorClosed
+	}
+	if group, ok := aggregator.groups[fingerprint]; ok {
+		group.suppressed++
+		aggregator.mutex.Unlock()
+		return true, nil
+	}
+	group := &aggregateGroup{fingerprint: fingerprint, message: message}
+	aggregator.groups[fingerprint] = group
+	group.timer = time.AfterFunc(aggregator.window, func() { aggregator.expire(group) })
+	aggregator.mutex.Unlock()
+
+	err = aggregator.webhook_sender.Send(message)
+	if err != nil && !IsWarning(err) {
+		// 告警未送达，不能抑制后续的重复消息，也不能汇总
+		aggregator.mutex.Lock()
+		if aggregator.groups[fingerprint] == group {
+			delete(aggregator.groups, fingerprint)
+		}
+		group.timer.Stop()
+		aggregator.mutex.Unlock()
+	}
+	return false, err
+}
+
+// 推送Text类型消息，使用内容作为指纹
+func (aggregator *Aggregator) SendMessageText(content string) (err error) {
+	_, err = aggregator.Send("", &Message{MessageType: MESSAGE_TYPE_TEXT, Title: aggregator.webhook_sender.message_title, Content: content})
+	return
+}
+
+// 推送Markdown类型消息，使用内容作为指纹
+func (aggregator *Aggregator) SendMessageMarkdown(content string) (err error) {
+	_, err = aggregator.Send("", &Message{MessageType: MESSAGE_TYPE_MARKDOWN, Title: aggregator.webhook_sender.message_title, Content: content})
+	return
+}
+
+// 窗口结束：有重复时发送汇总并开启下一个窗口，否则发送恢复通知并移除
+func (aggregator *Aggregator) expire(group *aggregateGroup) {
+	aggregator.mutex.Lock()
+	// 已关闭或第一条消息发送失败已被移除
+	if aggregator.closed || aggregator.groups[group.fingerprint] != group {
+		aggregator.mutex.Unlock()
+		return
+	}
+	aggregator.expiring.Add(1)
+	defer aggregator.expiring.Done()
+	suppressed := group.suppressed
+	group.suppressed = 0
+	if suppressed > 0 {
+		group.storm = true
+		group.timer = time.AfterFunc(aggregator.window, func() { aggregator.expire(group) })
+	} else {
+		delete(aggregator.groups, group.fingerprint)
+	}
+	aggregator.mutex.Unlock()
+
+	if suppressed > 0 {
+		aggregator.notify(group.message, fmt.Sprintf(aggregator.summary_format, summarize(group.message), suppressed, formatWindow(aggregator.window)))
+	} else if aggregator.recovery && group.storm {
+		aggregator.notify(group.message, fmt.Sprintf(aggregator.recovery_format, summarize(group.message)))
+	}
+}
+
+func (aggregator *Aggregator) notify(message *Message, content string) {
+	err := aggregator.webhook_sender.Send(&Message{
+		MessageType: message.MessageType,
+		Title:       message.Title,
+		Content:     content,
+	})
+	if err != nil && !IsWarning(err) {
+		aggregator.error_handler(err)
+	}
+}
+
+// 获取当前处于聚合窗口内的告警
+func (aggregator *Aggregator) Stats() (stats []AggregateStats) {
+	aggregator.mutex.Lock()
+	defer aggregator.mutex.Unlock()
+	for fingerprint, group := range aggregator.groups {
+		stats = append(stats, AggregateStats{Fingerprint: fingerprint, Suppressed: group.suppressed})
+	}
+	return
+}
+
+// 停止所有窗口，等待正在发送的汇总和恢复通知完成后发送尚未发送的汇总，不发送恢复通知
+//
+//	Close 返回后不会再发送任何消息
+func (aggregator *Aggregator) Close() {
+	aggregator.mutex.Lock()
+	if aggregator.closed {
+		aggregator.mutex.Unlock()
+		return
+	}
+	aggregator.closed = true
+	groups := aggregator.groups
+	aggregator.groups = map[string]*aggregateGroup{}
+	aggregator.mutex.Unlock()
+	aggregator.expiring.Wait()
+
+	for _, group := range groups {
+		group.timer.Stop()
+		if group.suppressed > 0 {
+			aggregator.notify(group.message, fmt.Sprintf(aggregator.summary_format, summarize(group.message), group.suppressed, formatWindow(aggregator.window)))
+		}
+	}
+}
+
+// 告警摘要：优先使用标题，否则使用内容的第一行
+func summarize(message *Message) string {
+	if message.Title != "" {
+		return message.Title
+	}
+	line, _, _ := strings.Cut(strings.TrimSpace(message.Content), "\n")
+	return strings.TrimLeft(line, "# ")
+}
+
+// 去除 time.Duration 字符串中多余的零，例如 5m0s 显示为 5m
+func formatWindow(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = s[:len(s)-2]
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = s[:len(s)-2]
+	}
+	return s
+}
@@ -0,0 +1,473 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SimoLin/go-utils/crypto"
+	"github.com/SimoLin/go-utils/hash"
+	"github.com/jummyliu/pkg/request"
+)
+
+var (
+	ErrCallbackSignature = errors.New("回调签名校验失败")
+	ErrCallbackToken     = errors.New("回调 verification token 校验失败")
+	ErrCallbackPlatform  = errors.New("回调请求不匹配已配置的平台")
+)
+
+// 回调签名时间戳允许的误差，与平台一致为 1 小时
+var CALLBACK_TIMESTAMP_TOLERANCE = time.Hour
+
+// 回调请求体的最大字节数，超出时返回 413，平台推送的消息事件远小于该限制
+var CALLBACK_MAX_BODY_SIZE int64 = 1 << 20
+
+// 飞书消息中 @ 的占位符，例如 @_user_1
+var regexp_feishu_mention_key = regexp.MustCompile(`@_user_\d+`)
+
+// 收到的群聊消息
+type CallbackMessage struct {
+	WebhookType    string
+	MessageID      string
+	ConversationID string // 钉钉 conversationId，飞书 chat_id
+	SenderID       string // 钉钉 senderStaffId，飞书 open_id
+	SenderName     string
+	Content        string   // 去除 @机器人 后的文本
+	Command        string   // Content 按空白切分后的第一个词
+	Args           []string // Content 按空白切分后的其余部分
+	Raw            map[string]any
+	reply          func(content string) error
+}
+
+// 在同一会话中回复文本消息，钉钉使用 sessionWebhook，飞书使用回复消息接口
+func (callback_message *CallbackMessage) Reply(content string) error {
+	if callback_message.reply == nil {
+		return fmt.Errorf("%s消息不支持回复", callback_message.WebhookType)
+	}
+	return callback_message.reply(content)
+}
+
+// 命令处理函数
+type CommandHandler func(message *CallbackMessage) error
+
+// 接收钉钉企业内部机器人（outgoing）和飞书事件订阅的回调，按命令分发消息
+//
+//	只处理已配置凭证的平台：请求头包含 timestamp 和 sign 且指定了钉钉 AppSecret 时按钉钉处理，
+//	否则指定了飞书 Verification Token 或 Encrypt Key 时按飞书处理，其余请求返回 403
+//	处理函数同步执行，耗时较长的命令请自行启动 goroutine，避免平台超时重推
+type CallbackHandler struct {
+	dingding_secret           string
+	feishu_verification_token string
+	feishu_encrypt_key        string
+	feishu_app_id             string
+	feishu_app_secret         string
+	request_headers           map[string]string
+	proxy_address             string
+	mutex                     sync.RWMutex
+	commands                  map[string]CommandHandler
+	default_handler           CommandHandler
+	error_handler             func(err error)
+	seen_mutex                sync.Mutex
+	seen_event_ids            map[string]bool
+	seen_event_list           []string
+}
+
+type CallbackOptionFunc func(*CallbackHandler)
+
+// 钉钉机器人的 AppSecret，用于校验请求头中的 sign
+func WithCallbackDingDingSecret(s string) CallbackOptionFunc {
+	return func(callback_handler *CallbackHandler) {
+		callback_handler.dingding_secret = s
+	}
+}
+
+// 飞书事件订阅的 Verification Token 和 Encrypt Key，encrypt_key 为空时不解密
+//
+//	指定 encrypt_key 时只接受加密且带 X-Lark-Signature 签名的事件；
+//	配置订阅地址的 url_verification 请求不带签名，需要指定 verification_token 校验
+func WithCallbackFeiShu(verification_token string, encrypt_key string) CallbackOptionFunc {
+	return func(callback_handler *CallbackHandler) {
+		callback_handler.feishu_verification_token = verification_token
+		callback_handler.feishu_encrypt_key = encrypt_key
+	}
+}
+
+// 飞书应用的 app_id 和 app_secret，用于回复消息
+func WithCallbackFeiShuApp(app_id string, app_secret string) CallbackOptionFunc {
+	return func(callback_handler *CallbackHandler) {
+		callback_handler.feishu_app_id = app_id
+		callback_handler.feishu_app_secret = app_secret
+	}
+}
+
+// 回复消息时使用的代理
+func WithCallbackProxyAddress(s string) CallbackOptionFunc {
+	return func(callback_handler *CallbackHandler) {
+		callback_handler.proxy_address = s
+	}
+}
+
+// 处理函数返回的错误及回调解析错误的处理函数，默认忽略
+func WithCallbackErrorHandler(f func(err error)) CallbackOptionFunc {
+	return func(callback_handler *CallbackHandler) {
+		callback_handler.error_handler = f
+	}
+}
+
+func NewCallbackHandler(options ...CallbackOptionFunc) *CallbackHandler {
+	callback_handler := &CallbackHandler{
+		request_headers: map[string]string{
+			"Accept":       "application/json",
+			"Content-Type": "application/json;charset=UTF-8",
+		},
+		commands:       map[string]CommandHandler{},
+		error_handler:  func(err error) {},
+		seen_event_ids: map[string]bool{},
+	}
+	for _, option_func := range options {
+		option_func(callback_handler)
+	}
+	return callback_handler
+}
+
+// 注册命令，例如 "/deploy"
+func (callback_handler *CallbackHandler) Handle(command string, f CommandHandler) {
+	callback_handler.mutex.Lock()
+	defer callback_handler.mutex.Unlock()
+	callback_handler.commands[command] = f
+}
+
+// 注册未匹配任何命令时的处理函数
+func (callback_handler *CallbackHandler) HandleDefault(f CommandHandler) {
+	callback_handler.mutex.Lock()
+	defer callback_handler.mutex.Unlock()
+	callback_handler.default_handler = f
+}
+
+func (callback_handler *CallbackHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, CALLBACK_MAX_BODY_SIZE))
+	if err != nil {
+		status_code := http.StatusBadRequest
+		var max_bytes_error *http.MaxBytesError
+		if errors.As(err, &max_bytes_error) {
+			status_code = http.StatusRequestEntityTooLarge
+		}
+		callback_handler.error_handler(err)
+		http.Error(w, err.Error(), status_code)
+		return
+	}
+	switch {
+	case callback_handler.dingding_secret != "" && r.Header.Get("timestamp") != "" && r.Header.Get("sign") != "":
+		callback_handler.serveDingDing(w, r, body)
+	case callback_handler.feishu_verification_token != "" || callback_handler.feishu_encrypt_key != "":
+		callback_handler.serveFeiShu(w, r, body)
+	default:
+		callback_handler.error_handler(ErrCallbackPlatform)
+		http.Error(w, ErrCallbackPlatform.Error(), http.StatusForbidden)
+	}
+}
+
+// 校验钉钉签名：sign = base64(HmacSHA256(timestamp + "\n" + secret, secret))
+func VerifyDingDingSign(secret string, timestamp string, sign string, now time.Time) bool {
+	var milliseconds int64
+	if _, err := fmt.Sscanf(timestamp, "%d", &milliseconds); err != nil {
+		return false
+	}
+	if !checkCallbackTimestamp(time.UnixMilli(milliseconds), now) {
+		return false
+	}
+	return hmac.Equal([]byte(hash.HMACSHA256EncodeToBase64(timestamp+"\n"+secret, secret)), []byte(sign))
+}
+
+// 签名时间戳与当前时间的误差不超过 CALLBACK_TIMESTAMP_TOLERANCE，避免重放已捕获的请求
+func checkCallbackTimestamp(t time.Time, now time.Time) bool {
+	diff := now.Sub(t)
+	return diff <= CALLBACK_TIMESTAMP_TOLERANCE && diff >= -CALLBACK_TIMESTAMP_TOLERANCE
+}
+
+func (callback_handler *CallbackHandler) serveDingDing(w http.ResponseWriter, r *http.Request, body []byte) {
+	if !VerifyDingDingSign(callback_handler.dingding_secret, r.Header.Get("timestamp"), r.Header.Get("sign"), time.Now()) {
+		callback_handler.error_handler(ErrCallbackSignature)
+		http.Error(w, ErrCallbackSignature.Error(), http.StatusForbidden)
+		return
+	}
+	raw := map[string]any{}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		callback_handler.error_handler(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	content := ""
+	if text, ok := raw["text"].(map[string]any); ok {
+		content, _ = text["content"].(string)
+	}
+	callback_message := &CallbackMessage{
+		WebhookType:    WEBHOOK_TYPE_DINGDING,
+		MessageID:      stringValue(raw, "msgId"),
+		ConversationID: stringValue(raw, "conversationId"),
+		SenderID:       stringValue(raw, "senderStaffId"),
+		SenderName:     stringValue(raw, "senderNick"),
+		Raw:            raw,
+	}
+	callback_message.setContent(content)
+	if session_webhook := stringValue(raw, "sessionWebhook"); session_webhook != "" {
+		callback_message.reply = func(content string) error {
+			return callback_handler.post(WEBHOOK_TYPE_DINGDING, session_webhook, NewDingDingText(content).ToMap(), nil)
+		}
+	}
+	callback_handler.dispatch(callback_message)
+	writeCallbackJSON(w, map[string]any{})
+}
+
+// 解密飞书事件：key = sha256(encrypt_key)，密文 base64 解码后前 16 字节为 IV
+func DecryptFeiShuEvent(encrypt string, encrypt_key string) (decrypted []byte, err error) {
+	encrypted, err := base64.StdEncoding.DecodeString(encrypt)
+	if err != nil {
+		return
+	}
+	if len(encrypted) < 16 {
+		return nil, fmt.Errorf("飞书事件密文长度错误: %d", len(encrypted))
+	}
+	key := sha256.Sum256([]byte(encrypt_key))
+	return crypto.AESDecryptCBCWithIV(encrypted[16:], key[:], encrypted[:16])
+}
+
+// 校验飞书签名：signature = sha256(timestamp + nonce + encrypt_key + body)，timestamp 为秒级时间戳
+func VerifyFeiShuSignature(timestamp string, nonce string, encrypt_key string, body []byte, signature string, now time.Time) bool {
+	var seconds int64
+	if _, err := fmt.Sscanf(timestamp, "%d", &seconds); err != nil {
+		return false
+	}
+	if !checkCallbackTimestamp(time.Unix(seconds, 0), now) {
+		return false
+	}
+	sum := sha256.Sum256([]byte(timestamp + nonce + encrypt_key + string(body)))
+	return hmac.Equal([]byte(hex.EncodeToString(sum[:])), []byte(signature))
+}
+
+func (callback_handler *CallbackHandler) serveFeiShu(w http.ResponseWriter, r *http.Request, body []byte) {
+	raw := map[string]any{}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		callback_handler.error_handler(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// 签名校验通过时，可以不指定 verification token
+	signature_verified := false
+	encrypt, encrypted := raw["encrypt"].(string)
+	if encrypted {
+		if callback_handler.feishu_encrypt_key == "" {
+			callback_handler.error_handler(errors.New("飞书事件已加密，需要使用 WithCallbackFeiShu 指定 encrypt_key"))
+			http.Error(w, "encrypt key required", http.StatusBadRequest)
+			return
+		}
+		// 缺少签名的请求仅允许 url_verification，解密后校验 verification token
+		if signature := r.Header.Get("X-Lark-Signature"); signature != "" {
+			if !VerifyFeiShuSignature(
+				r.Header.Get("X-Lark-Request-Timestamp"),
+				r.Header.Get("X-Lark-Request-Nonce"),
+				callback_handler.feishu_encrypt_key,
+				body,
+				signature,
+				time.Now(),
+			) {
+				callback_handler.error_handler(ErrCallbackSignature)
+				http.Error(w, ErrCallbackSignature.Error(), http.StatusForbidden)
+				return
+			}
+			signature_verified = true
+		}
+		decrypted, err := DecryptFeiShuEvent(encrypt, callback_handler.feishu_encrypt_key)
+		if err == nil {
+			raw = map[string]any{}
+			err = json.Unmarshal(decrypted, &raw)
+		}
+		if err != nil {
+			callback_handler.error_handler(err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else if callback_handler.feishu_encrypt_key != "" {
+		// 指定 encrypt_key 后平台只推送加密事件
+		callback_handler.error_handler(ErrCallbackSignature)
+		http.Error(w, ErrCallbackSignature.Error(), http.StatusForbidden)
+		return
+	}
+
+	// 配置事件订阅地址时的校验请求
+	if stringValue(raw, "type") == "url_verification" {
+		if !callback_handler.checkFeiShuToken(stringValue(raw, "token"), signature_verified) {
+			callback_handler.error_handler(ErrCallbackToken)
+			http.Error(w, ErrCallbackToken.Error(), http.StatusForbidden)
+			return
+		}
+		writeCallbackJSON(w, map[string]any{"challenge": stringValue(raw, "challenge")})
+		return
+	}
+
+	if encrypted && !signature_verified {
+		callback_handler.error_handler(ErrCallbackSignature)
+		http.Error(w, ErrCallbackSignature.Error(), http.StatusForbidden)
+		return
+	}
+	header, _ := raw["header"].(map[string]any)
+	if !callback_handler.checkFeiShuToken(stringValue(header, "token"), signature_verified) {
+		callback_handler.error_handler(ErrCallbackToken)
+		http.Error(w, ErrCallbackToken.Error(), http.StatusForbidden)
+		return
+	}
+	// 飞书未及时收到响应时会重推，按 event_id 去重
+	if stringValue(header, "event_type") == "im.message.receive_v1" && !callback_handler.seen(stringValue(header, "event_id")) {
+		if callback_message := callback_handler.parseFeiShuMessage(raw); callback_message != nil {
+			callback_handler.dispatch(callback_message)
+		}
+	}
+	writeCallbackJSON(w, map[string]any{})
+}
+
+// 校验 verification token，未指定 token 时只接受签名校验通过的请求
+func (callback_handler *CallbackHandler) checkFeiShuToken(token string, signature_verified bool) bool {
+	if callback_handler.feishu_verification_token == "" {
+		return signature_verified
+	}
+	return subtle.ConstantTimeCompare([]byte(callback_handler.feishu_verification_token), []byte(token)) == 1
+}
+
+// 记录 event_id，已处理过时返回 true，最多保留 1000 个
+func (callback_handler *CallbackHandler) seen(event_id string) bool {
+	if event_id == "" {
+		return false
+	}
+	callback_handler.seen_mutex.Lock()
+	defer callback_handler.seen_mutex.Unlock()
+	if callback_handler.seen_event_ids[event_id] {
+		return true
+	}
+	callback_handler.seen_event_ids[event_id] = true
+	callback_handler.seen_event_list = append(callback_handler.seen_event_list, event_id)
+	if len(callback_handler.seen_event_list) > 1000 {
+		delete(callback_handler.seen_event_ids, callback_handler.seen_event_list[0])
+		callback_handler.seen_event_list = callback_handler.seen_event_list[1:]
+	}
+	return false
+}
+
+func (callback_handler *CallbackHandler) parseFeiShuMessage(raw map[string]any) *CallbackMessage {
+	event, _ := raw["event"].(map[string]any)
+	message, _ := event["message"].(map[string]any)
+	if message == nil || stringValue(message, "message_type") != "text" {
+		return nil
+	}
+	content := map[string]any{}
+	json.Unmarshal([]byte(stringValue(message, "content")), &content)
+	sender, _ := event["sender"].(map[string]any)
+	sender_id, _ := sender["sender_id"].(map[string]any)
+
+	callback_message := &CallbackMessage{
+		WebhookType:    WEBHOOK_TYPE_FEISHU,
+		MessageID:      stringValue(message, "message_id"),
+		ConversationID: stringValue(message, "chat_id"),
+		SenderID:       stringValue(sender_id, "open_id"),
+		Raw:            raw,
+	}
+	callback_message.setContent(regexp_feishu_mention_key.ReplaceAllString(stringValue(content, "text"), ""))
+	if callback_handler.feishu_app_id != "" && callback_message.MessageID != "" {
+		callback_message.reply = func(content string) error {
+			return callback_handler.replyFeiShu(callback_message.MessageID, content)
+		}
+	}
+	return callback_message
+}
+
+func (callback_handler *CallbackHandler) replyFeiShu(message_id string, content string) (err error) {
+	tenant_access_token, err := GetFeiShuTenantAccessToken(
+		callback_handler.feishu_app_id,
+		callback_handler.feishu_app_secret,
+		callback_handler.request_headers,
+		callback_handler.proxy_address,
+	)
+	if err != nil {
+		return
+	}
+	text, _ := json.Marshal(map[string]string{"text": content})
+	return callback_handler.post(
+		WEBHOOK_TYPE_FEISHU,
+		FEISHU_OPEN_API_ADDRESS+"/im/v1/messages/"+message_id+"/reply",
+		map[string]any{"msg_type": "text", "content": string(text)},
+		map[string]string{"Authorization": "Bearer " + tenant_access_token},
+	)
+}
+
+func (callback_handler *CallbackHandler) post(webhook_type string, request_url string, payload map[string]any, headers map[string]string) (err error) {
+	request_headers := map[string]string{}
+	for k, v := range callback_handler.request_headers {
+		request_headers[k] = v
+	}
+	for k, v := range headers {
+		request_headers[k] = v
+	}
+	request_data, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	status_code, response_body, _, err := request.DoRequest(
+		request_url,
+		request.WithMethod(http.MethodPost),
+		request.WithHeader(request_headers),
+		request.WithData(request_data),
+		request.WithProxy(callback_handler.proxy_address),
+	)
+	if err != nil {
+		return
+	}
+	return ParseResponse(webhook_type, status_code, response_body)
+}
+
+func (callback_handler *CallbackHandler) dispatch(callback_message *CallbackMessage) {
+	callback_handler.mutex.RLock()
+	f, ok := callback_handler.commands[callback_message.Command]
+	if !ok {
+		f = callback_handler.default_handler
+	}
+	callback_handler.mutex.RUnlock()
+	if f == nil {
+		return
+	}
+	if err := f(callback_message); err != nil {
+		callback_handler.error_handler(err)
+	}
+}
+
+func (callback_message *CallbackMessage) setContent(content string) {
+	callback_message.Content = strings.TrimSpace(content)
+	fields := strings.Fields(callback_message.Content)
+	if len(fields) > 0 {
+		callback_message.Command = fields[0]
+		callback_message.Args = fields[1:]
+	}
+}
+
+func stringValue(m map[string]any, key string) string {
+	s, _ := m[key].(string)
+	return s
+}
+
+func writeCallbackJSON(w http.ResponseWriter, data map[string]any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(data)
+}
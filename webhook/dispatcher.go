@@ -0,0 +1,377 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrDispatcherClosed = errors.New("dispatcher 已关闭")
+	ErrQueueFull        = errors.New("dispatcher 队列已满")
+	ErrSpoolDirInUse    = errors.New("落盘目录已被其他 dispatcher 使用")
+)
+
+// 当前进程中正在使用的落盘目录
+var (
+	spool_dirs_mutex sync.Mutex
+	spool_dirs       = map[string]bool{}
+)
+
+// 异步推送队列，使用固定数量的 worker 调用 WebhookSender 发送消息
+//
+//	指定落盘目录时，入队的消息会先写入文件，发送完成后删除，重启后会重新发送未完成的消息
+//	发送失败（已按 WebhookSender 的重试策略重试）的消息移动到落盘目录的 failed 子目录
+//	落盘目录按文件路径删除已发送的消息，不能被多个 dispatcher 共享：
+//	同一进程中使用已被占用的目录时 NewDispatcher 返回 ErrSpoolDirInUse，多个进程之间需要使用不同的目录
+//	CloseContext 超时时取消正在发送的消息，未发送完成的消息保留在落盘目录中，下次启动时重新发送
+type Dispatcher struct {
+	webhook_sender *WebhookSender
+	ctx            context.Context // worker 发送消息使用的 ctx，CloseContext 超时时取消
+	cancel         context.CancelFunc
+	spool_dir      string
+	workers        int
+	queue_size     int
+	queue          chan *dispatchItem
+	mutex          sync.RWMutex
+	closed         bool
+	pending_mutex  sync.Mutex
+	pending_cond   *sync.Cond // 未发送完成的消息数归零时通知 Flush
+	count_pending  int64
+	workers_done   sync.WaitGroup
+	sequence       atomic.Int64
+	count_sent     atomic.Int64
+	count_failed   atomic.Int64
+	error_mutex    sync.Mutex
+	last_error     error
+}
+
+// 落盘的消息，Message 与 Payload 二选一
+type dispatchItem struct {
+	Message   *Message       `json:"message,omitempty"`
+	Payload   map[string]any `json:"payload,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+	file_path string
+}
+
+// 队列状态
+type DispatcherStats struct {
+	QueueDepth int64 // 未发送完成的消息数
+	Sent       int64 // 发送成功的消息数
+	Failed     int64 // 发送失败的消息数
+	LastError  error // 最近一次发送失败的错误
+}
+
+type DispatcherOptionFunc func(*Dispatcher)
+
+// 可指定 worker 数量，默认为 1，保证消息按入队顺序发送
+func WithDispatcherWorkers(i int) DispatcherOptionFunc {
+	return func(dispatcher *Dispatcher) {
+		dispatcher.workers = i
+	}
+}
+
+// 可指定队列长度，默认为 1000，队列已满时入队返回 ErrQueueFull
+func WithDispatcherQueueSize(i int) DispatcherOptionFunc {
+	return func(dispatcher *Dispatcher) {
+		dispatcher.queue_size = i
+	}
+}
+
+// 可指定落盘目录，为空时不落盘
+func WithDispatcherSpoolDir(s string) DispatcherOptionFunc {
+	return func(dispatcher *Dispatcher) {
+		dispatcher.spool_dir = s
+	}
+}
+
+func NewDispatcher(webhook_sender *WebhookSender, options ...DispatcherOptionFunc) (dispatcher *Dispatcher, err error) {
+	dispatcher = &Dispatcher{
+		webhook_sender: webhook_sender,
+		workers:        1,
+		queue_size:     1000,
+	}
+	dispatcher.pending_cond = sync.NewCond(&dispatcher.pending_mutex)
+	dispatcher.ctx, dispatcher.cancel = context.WithCancel(context.Background())
+	for _, option_func := range options {
+		option_func(dispatcher)
+	}
+	if dispatcher.workers <= 0 {
+		dispatcher.workers = 1
+	}
+
+	// 加载落盘目录中未发送完成的消息
+	spool_items := []*dispatchItem{}
+	if dispatcher.spool_dir != "" {
+		if err = dispatcher.lockSpool(); err != nil {
+			return nil, err
+		}
+		if err = os.MkdirAll(filepath.Join(dispatcher.spool_dir, "failed"), 0o755); err != nil {
+			dispatcher.unlockSpool()
+			return nil, err
+		}
+		if spool_items, err = dispatcher.loadSpool(); err != nil {
+			dispatcher.unlockSpool()
+			return nil, err
+		}
+	}
+	dispatcher.queue = make(chan *dispatchItem, max(dispatcher.queue_size, len(spool_items)))
+	for _, item := range spool_items {
+		dispatcher.addPending(1)
+		dispatcher.queue <- item
+	}
+
+	for i := 0; i < dispatcher.workers; i++ {
+		dispatcher.workers_done.Add(1)
+		go dispatcher.work()
+	}
+	return
+}
+
+// 占用落盘目录，同一进程中的多个 dispatcher 不能使用同一个目录
+func (dispatcher *Dispatcher) lockSpool() (err error) {
+	spool_dir, err := filepath.Abs(dispatcher.spool_dir)
+	if err != nil {
+		return
+	}
+	spool_dirs_mutex.Lock()
+	defer spool_dirs_mutex.Unlock()
+	if spool_dirs[spool_dir] {
+		return fmt.Errorf("%w: %s", ErrSpoolDirInUse, spool_dir)
+	}
+	spool_dirs[spool_dir] = true
+	dispatcher.spool_dir = spool_dir
+	return
+}
+
+func (dispatcher *Dispatcher) unlockSpool() {
+	spool_dirs_mutex.Lock()
+	defer spool_dirs_mutex.Unlock()
+	delete(spool_dirs, dispatcher.spool_dir)
+}
+
+// 增加或减少未发送完成的消息数，归零时唤醒等待中的 Flush
+func (dispatcher *Dispatcher) addPending(i int64) {
+	dispatcher.pending_mutex.Lock()
+	defer dispatcher.pending_mutex.Unlock()
+	dispatcher.count_pending += i
+	if dispatcher.count_pending == 0 {
+		dispatcher.pending_cond.Broadcast()
+	}
+}
+
+func (dispatcher *Dispatcher) loadSpool() (items []*dispatchItem, err error) {
+	file_paths, err := filepath.Glob(filepath.Join(dispatcher.spool_dir, "*.json"))
+	if err != nil {
+		return
+	}
+	sort.Strings(file_paths)
+	for _, file_path := range file_paths {
+		data, err := os.ReadFile(file_path)
+		if err != nil {
+			return nil, err
+		}
+		item := &dispatchItem{}
+		if err = json.Unmarshal(data, item); err != nil {
+			// 无法解析的文件移动到 failed 目录，避免阻塞启动
+			os.Rename(file_path, filepath.Join(dispatcher.spool_dir, "failed", filepath.Base(file_path)))
+			continue
+		}
+		item.file_path = file_path
+		dispatcher.sequence.Add(1)
+		items = append(items, item)
+	}
+	return
+}
+
+// 先写入临时文件再重命名，避免重启时读取到不完整的文件
+func (dispatcher *Dispatcher) writeSpool(item *dispatchItem) (err error) {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return
+	}
+	file_name := fmt.Sprintf("%d-%06d.json", item.CreatedAt.UnixNano(), dispatcher.sequence.Add(1))
+	item.file_path = filepath.Join(dispatcher.spool_dir, file_name)
+	temp_path := item.file_path + ".tmp"
+	if err = os.WriteFile(temp_path, data, 0o644); err != nil {
+		return
+	}
+	return os.Rename(temp_path, item.file_path)
+}
+
+func (dispatcher *Dispatcher) enqueue(item *dispatchItem) (err error) {
+	dispatcher.mutex.RLock()
+	defer dispatcher.mutex.RUnlock()
+	if dispatcher.closed {
+		return ErrDispatcherClosed
+	}
+	if len(dispatcher.queue) >= cap(dispatcher.queue) {
+		return ErrQueueFull
+	}
+	item.CreatedAt = time.Now()
+	if dispatcher.spool_dir != "" {
+		if err = dispatcher.writeSpool(item); err != nil {
+			return
+		}
+	}
+	dispatcher.addPending(1)
+	select {
+	case dispatcher.queue <- item:
+	default:
+		dispatcher.addPending(-1)
+		if item.file_path != "" {
+			os.Remove(item.file_path)
+		}
+		return ErrQueueFull
+	}
+	return
+}
+
+func (dispatcher *Dispatcher) work() {
+	defer dispatcher.workers_done.Done()
+	for item := range dispatcher.queue {
+		// 已取消时不再发送，落盘的消息保留在落盘目录中
+		if dispatcher.ctx.Err() != nil {
+			dispatcher.addPending(-1)
+			continue
+		}
+		var err error
+		if item.Message != nil {
+			err = dispatcher.webhook_sender.SendContext(dispatcher.ctx, item.Message)
+		} else {
+			err = dispatcher.webhook_sender.SendMessageContext(dispatcher.ctx, item.Payload)
+		}
+		switch {
+		case err != nil && dispatcher.ctx.Err() != nil:
+			// 被取消的发送不计入失败，保留在落盘目录中
+		case err != nil && !IsWarning(err):
+			dispatcher.count_failed.Add(1)
+			dispatcher.error_mutex.Lock()
+			dispatcher.last_error = err
+			dispatcher.error_mutex.Unlock()
+			if item.file_path != "" {
+				os.Rename(item.file_path, filepath.Join(dispatcher.spool_dir, "failed", filepath.Base(item.file_path)))
+			}
+		default:
+			dispatcher.count_sent.Add(1)
+			if item.file_path != "" {
+				os.Remove(item.file_path)
+			}
+		}
+		dispatcher.addPending(-1)
+	}
+}
+
+// 异步推送通用消息
+func (dispatcher *Dispatcher) Send(message *Message) error {
+	return dispatcher.enqueue(&dispatchItem{Message: message})
+}
+
+// 异步推送平台格式的消息
+func (dispatcher *Dispatcher) SendMessage(content map[string]any) error {
+	return dispatcher.enqueue(&dispatchItem{Payload: content})
+}
+
+// 异步推送Text类型消息
+func (dispatcher *Dispatcher) SendMessageText(content string) error {
+	return dispatcher.Send(&Message{
+		MessageType: MESSAGE_TYPE_TEXT,
+		Title:       dispatcher.webhook_sender.message_title,
+		Content:     content,
+	})
+}
+
+// 异步推送Markdown类型消息
+func (dispatcher *Dispatcher) SendMessageMarkdown(content string) error {
+	return dispatcher.Send(&Message{
+		MessageType: MESSAGE_TYPE_MARKDOWN,
+		Title:       dispatcher.webhook_sender.message_title,
+		Content:     content,
+	})
+}
+
+// 等待已入队的消息全部发送完成，等待期间可以继续入队，新入队的消息同样需要发送完成
+func (dispatcher *Dispatcher) Flush() {
+	dispatcher.FlushContext(context.Background())
+}
+
+// 等待已入队的消息全部发送完成，ctx 取消或超时时停止等待并返回 ctx.Err()，不影响正在发送的消息
+func (dispatcher *Dispatcher) FlushContext(ctx context.Context) (err error) {
+	// sync.Cond 不支持 select，ctx 结束时唤醒等待
+	stop := context.AfterFunc(ctx, func() {
+		dispatcher.pending_mutex.Lock()
+		defer dispatcher.pending_mutex.Unlock()
+		dispatcher.pending_cond.Broadcast()
+	})
+	defer stop()
+	dispatcher.pending_mutex.Lock()
+	defer dispatcher.pending_mutex.Unlock()
+	for dispatcher.count_pending > 0 {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		dispatcher.pending_cond.Wait()
+	}
+	return
+}
+
+// 停止接收新消息，等待已入队的消息发送完成后退出 worker
+//
+//	机器人接口无响应时会一直等待到请求超时，需要限制等待时间时使用 CloseContext
+func (dispatcher *Dispatcher) Close() (err error) {
+	return dispatcher.CloseContext(context.Background())
+}
+
+// 停止接收新消息，等待已入队的消息发送完成后退出 worker
+//
+//	ctx 取消或超时时取消正在发送的消息并返回 ctx.Err()，未发送完成的消息保留在落盘目录中，未指定落盘目录时丢弃
+func (dispatcher *Dispatcher) CloseContext(ctx context.Context) (err error) {
+	dispatcher.mutex.Lock()
+	if dispatcher.closed {
+		dispatcher.mutex.Unlock()
+		return ErrDispatcherClosed
+	}
+	dispatcher.closed = true
+	dispatcher.mutex.Unlock()
+
+	err = dispatcher.FlushContext(ctx)
+	if err != nil {
+		dispatcher.cancel()
+	}
+	close(dispatcher.queue)
+	dispatcher.workers_done.Wait()
+	dispatcher.cancel()
+	if dispatcher.spool_dir != "" {
+		dispatcher.unlockSpool()
+	}
+	return
+}
+
+func (dispatcher *Dispatcher) Stats() (stats DispatcherStats) {
+	dispatcher.pending_mutex.Lock()
+	stats = DispatcherStats{
+		QueueDepth: dispatcher.count_pending,
+		Sent:       dispatcher.count_sent.Load(),
+		Failed:     dispatcher.count_failed.Load(),
+	}
+	dispatcher.pending_mutex.Unlock()
+	dispatcher.error_mutex.Lock()
+	stats.LastError = dispatcher.last_error
+	dispatcher.error_mutex.Unlock()
+	return
+}
+
+// 落盘目录中发送失败的消息文件
+func (dispatcher *Dispatcher) FailedFiles() (file_paths []string, err error) {
+	if dispatcher.spool_dir == "" {
+		return
+	}
+	return filepath.Glob(filepath.Join(dispatcher.spool_dir, "failed", "*.json"))
+}
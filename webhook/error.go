@@ -0,0 +1,63 @@
+package webhook
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+)
+
+// 各平台表示限流的错误码
+var DICT_WEBHOOK_TYPE_TO_RATE_LIMITED_CODES = map[string][]int{
+	WEBHOOK_TYPE_WEIXIN_WORK: {45009},       // api freq out of limit
+	WEBHOOK_TYPE_DINGDING:    {130101},      // send too fast, exceed 20 times per minute
+	WEBHOOK_TYPE_FEISHU:      {9499, 11232}, // too many request / frequency limited
+	WEBHOOK_TYPE_TELEGRAM:    {429},         // too many requests
+}
+
+// 各平台表示 key 无效的错误码
+var DICT_WEBHOOK_TYPE_TO_INVALID_KEY_CODES = map[string][]int{
+	WEBHOOK_TYPE_WEIXIN_WORK: {93000},          // invalid webhook url
+	WEBHOOK_TYPE_DINGDING:    {300001, 300005}, // token is not exist
+	WEBHOOK_TYPE_FEISHU:      {19001},          // incoming webhook access token invalid
+	WEBHOOK_TYPE_SLACK:       {403, 404},       // invalid_token / no_service
+	WEBHOOK_TYPE_DISCORD:     {10015, 50027},   // unknown webhook / invalid webhook token
+	WEBHOOK_TYPE_TELEGRAM:    {401, 404},       // unauthorized / not found
+	WEBHOOK_TYPE_TEAMS:       {404},            // webhook not found
+}
+
+// webhook 平台返回的错误
+type WebhookError struct {
+	WebhookType string // webhook 类型
+	StatusCode  int    // HTTP 状态码
+	Code        int    // 平台错误码，企微、钉钉为 errcode，飞书为 code，无错误码的平台为 HTTP 状态码
+	Message     string // 平台错误信息，企微、钉钉为 errmsg，飞书为 msg
+}
+
+func (webhook_error *WebhookError) Error() string {
+	return fmt.Sprintf("%s推送失败: http %d, code %d, %s", webhook_error.WebhookType, webhook_error.StatusCode, webhook_error.Code, webhook_error.Message)
+}
+
+// 是否被平台限流
+func (webhook_error *WebhookError) IsRateLimited() bool {
+	if webhook_error.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	return slices.Contains(DICT_WEBHOOK_TYPE_TO_RATE_LIMITED_CODES[webhook_error.WebhookType], webhook_error.Code)
+}
+
+// 是否为无效的 key
+func (webhook_error *WebhookError) IsInvalidKey() bool {
+	return slices.Contains(DICT_WEBHOOK_TYPE_TO_INVALID_KEY_CODES[webhook_error.WebhookType], webhook_error.Code)
+}
+
+// 解析平台响应，平台返回错误时返回 *WebhookError
+//
+//	企微、钉钉响应格式为 {"errcode": 0, "errmsg": "ok"}
+//	飞书响应格式为 {"code": 0, "msg": "success"}，旧版本为 {"StatusCode": 0, "StatusMessage": "success"}
+func ParseResponse(webhook_type string, status_code int, response_body []byte) (err error) {
+	provider, ok := GetProvider(webhook_type)
+	if !ok {
+		return fmt.Errorf("未注册的 webhook 类型: %s", webhook_type)
+	}
+	return provider.ParseResponse(status_code, response_body)
+}
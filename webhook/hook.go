@@ -0,0 +1,74 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// 发送结果状态
+const (
+	SEND_STATUS_SUCCESS = "success" // 发送成功，包括返回 *MentionWarning 的情况
+	SEND_STATUS_FAILURE = "failure" // 发送失败
+	SEND_STATUS_VETOED  = "vetoed"  // 被 before-send 钩子拦截，未发送
+)
+
+var ErrSendVetoed = errors.New("消息已被 before-send 钩子拦截")
+
+// 一次推送的事件，包括限流等待和重试
+type SendEvent struct {
+	WebhookType   string         // webhook 类型
+	ServerAddress string         // 服务端地址
+	Payload       map[string]any // 平台格式的请求体，before-send 钩子可修改或替换
+	Attempts      int            // 请求次数，包括重试
+	Duration      time.Duration  // 发送耗时，包括限流等待和重试间隔
+	Status        string         // 发送结果状态，SEND_STATUS_SUCCESS | SEND_STATUS_FAILURE | SEND_STATUS_VETOED
+	Err           error          // 发送失败或被拦截时的错误
+}
+
+// 发送前调用，可修改 event.Payload，返回错误时拦截本次发送
+type BeforeSendHook func(ctx context.Context, event *SendEvent) error
+
+// 发送后调用，被拦截时同样会调用
+type AfterSendHook func(ctx context.Context, event *SendEvent)
+
+// 可添加 before-send 钩子，按添加顺序调用，任一钩子返回错误时停止调用后续钩子
+func WithBeforeSend(hooks ...BeforeSendHook) OptionFunc {
+	return func(webhook_sender *WebhookSender) {
+		webhook_sender.before_send_hooks = append(webhook_sender.before_send_hooks, hooks...)
+	}
+}
+
+// 可添加 after-send 钩子，按添加顺序调用
+func WithAfterSend(hooks ...AfterSendHook) OptionFunc {
+	return func(webhook_sender *WebhookSender) {
+		webhook_sender.after_send_hooks = append(webhook_sender.after_send_hooks, hooks...)
+	}
+}
+
+// 调用 before-send 钩子，返回的错误包装了 ErrSendVetoed
+func (webhook_sender *WebhookSender) runBeforeSendHooks(ctx context.Context, event *SendEvent) (err error) {
+	if len(webhook_sender.before_send_hooks) == 0 {
+		return
+	}
+	// 通过 JSON 序列化深拷贝请求体，钩子修改嵌套的 map 或切片时也不影响调用方传入的 map
+	event.Payload = toMap(event.Payload)
+	for _, hook := range webhook_sender.before_send_hooks {
+		if err = hook(ctx, event); err != nil {
+			return fmt.Errorf("%w: %w", ErrSendVetoed, err)
+		}
+	}
+	return
+}
+
+func (webhook_sender *WebhookSender) runAfterSendHooks(ctx context.Context, event *SendEvent) {
+	for _, hook := range webhook_sender.after_send_hooks {
+		hook(ctx, event)
+	}
+}
+
+// 是否为被 before-send 钩子拦截的错误
+func IsVetoed(err error) bool {
+	return errors.Is(err, ErrSendVetoed)
+}
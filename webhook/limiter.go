@@ -0,0 +1,150 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// 令牌桶限流器，同一个机器人的多个 WebhookSender 共享同一个限流器
+type RateLimiter struct {
+	mutex     sync.Mutex
+	capacity  float64   // 令牌桶容量
+	tokens    float64   // 当前令牌数
+	rate      float64   // 每秒生成的令牌数
+	last_time time.Time // 上次生成令牌的时间
+}
+
+// 创建令牌桶限流器，duration 时间内最多允许 count 次请求
+func NewRateLimiter(count int, duration time.Duration) *RateLimiter {
+	return &RateLimiter{
+		capacity:  float64(count),
+		tokens:    float64(count),
+		rate:      float64(count) / duration.Seconds(),
+		last_time: time.Now(),
+	}
+}
+
+// 获取令牌，不需要等待时返回 0，否则返回需要等待的时间
+func (rate_limiter *RateLimiter) Reserve() time.Duration {
+	rate_limiter.mutex.Lock()
+	defer rate_limiter.mutex.Unlock()
+	now := time.Now()
+	rate_limiter.tokens += now.Sub(rate_limiter.last_time).Seconds() * rate_limiter.rate
+	if rate_limiter.tokens > rate_limiter.capacity {
+		rate_limiter.tokens = rate_limiter.capacity
+	}
+	rate_limiter.last_time = now
+	// 令牌数允许为负数，表示已被预订的令牌
+	rate_limiter.tokens--
+	if rate_limiter.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-rate_limiter.tokens / rate_limiter.rate * float64(time.Second))
+}
+
+// 阻塞直到获取令牌
+func (rate_limiter *RateLimiter) Wait() {
+	rate_limiter.WaitContext(context.Background())
+}
+
+// 阻塞直到获取令牌，ctx 取消时归还预订的令牌并返回 ctx.Err()
+func (rate_limiter *RateLimiter) WaitContext(ctx context.Context) error {
+	delay := rate_limiter.Reserve()
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		rate_limiter.mutex.Lock()
+		rate_limiter.tokens++
+		rate_limiter.mutex.Unlock()
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+var (
+	rate_limiters_mutex sync.Mutex
+	rate_limiters       = map[string]*RateLimiter{}
+)
+
+// 按机器人和限流配置获取限流器，不存在时创建，相同机器人使用不同配置时分别限流
+func getRateLimiter(key string, count int, duration time.Duration) *RateLimiter {
+	key = fmt.Sprintf("%s|%d|%s", key, count, duration)
+	rate_limiters_mutex.Lock()
+	defer rate_limiters_mutex.Unlock()
+	rate_limiter, ok := rate_limiters[key]
+	if !ok {
+		rate_limiter = NewRateLimiter(count, duration)
+		rate_limiters[key] = rate_limiter
+	}
+	return rate_limiter
+}
+
+// 重试策略，使用指数退避加随机抖动
+type RetryPolicy struct {
+	MaxRetries int           // 最大重试次数，0 表示不重试
+	BaseDelay  time.Duration // 首次重试的等待时间
+	MaxDelay   time.Duration // 最大等待时间，0 表示不限制
+	// 是否重试所有网络错误，默认只重试建立连接失败的请求
+	//	读取响应超时等情况下平台可能已收到消息，重试会导致重复推送
+	RetryNetworkErrors bool
+}
+
+// 第 attempt 次重试（从 0 开始）的等待时间，在 [delay/2, delay] 范围内随机
+func (retry_policy RetryPolicy) Delay(attempt int) time.Duration {
+	delay := retry_policy.BaseDelay
+	for i := 0; i < attempt && (retry_policy.MaxDelay <= 0 || delay < retry_policy.MaxDelay); i++ {
+		// 不限制最大等待时间时避免溢出
+		if delay > math.MaxInt64/2 {
+			delay = math.MaxInt64
+			break
+		}
+		delay *= 2
+	}
+	if retry_policy.MaxDelay > 0 && delay > retry_policy.MaxDelay {
+		delay = retry_policy.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// 是否允许重试，RetryNetworkErrors 为 true 时所有网络错误都重试
+func (retry_policy RetryPolicy) IsRetryable(err error) bool {
+	return IsRetryable(err) || (retry_policy.RetryNetworkErrors && IsNetworkError(err))
+}
+
+// 平台限流、服务端 5xx 错误以及建立连接失败时允许重试
+//
+//	建立连接失败时平台一定未收到消息；请求超时等其他网络错误可能导致重复推送，不重试
+//	其他平台错误（如 key 无效）、响应解析失败和构造请求失败不重试
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	var webhook_error *WebhookError
+	if errors.As(err, &webhook_error) {
+		return webhook_error.IsRateLimited() || webhook_error.StatusCode >= 500
+	}
+	var op_error *net.OpError
+	return errors.As(err, &op_error) && op_error.Op == "dial"
+}
+
+// 是否为网络请求失败，包括建立连接失败和请求超时
+func IsNetworkError(err error) bool {
+	var net_error net.Error
+	var url_error *url.Error
+	return errors.As(err, &net_error) || errors.As(err, &url_error)
+}
@@ -0,0 +1,325 @@
+package webhook
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/SimoLin/go-utils/text_drawer"
+)
+
+// 各平台的 markdown 方言转换函数，输入为通用 markdown，颜色统一使用 <font color="red">文本</font> 表示
+//
+//	SendMessageMarkdown 发送前会按 webhook 类型转换，未配置的类型原样发送
+var DICT_WEBHOOK_TYPE_TO_MARKDOWN_RENDERER = map[string]func(content string) string{
+	WEBHOOK_TYPE_WEIXIN_WORK: RenderMarkdownWeiXinWork,
+	WEBHOOK_TYPE_DINGDING:    RenderMarkdownDingDing,
+	WEBHOOK_TYPE_FEISHU:      RenderMarkdownFeiShu,
+	WEBHOOK_TYPE_SLACK:       RenderMarkdownSlack,
+	WEBHOOK_TYPE_DISCORD:     RenderMarkdownDiscord,
+	WEBHOOK_TYPE_TELEGRAM:    RenderMarkdownTelegram,
+	WEBHOOK_TYPE_TEAMS:       RenderMarkdownTeams,
+}
+
+var (
+	regexp_markdown_color     = regexp.MustCompile(`<font\s+color\s*=\s*["']?([#\w]+)["']?\s*>(.*?)</font>`)
+	regexp_markdown_heading   = regexp.MustCompile(`^(\s{0,3})(#{1,6})\s+(.+?)(\s+#+)?\s*$`)
+	regexp_markdown_link      = regexp.MustCompile(`(!?)\[([^\]]*)\]\(([^)\s]+)\)`)
+	regexp_markdown_autolink  = regexp.MustCompile(`<(https?://[^>\s]+)>`)
+	regexp_markdown_bold      = regexp.MustCompile(`\*\*(.+?)\*\*`)
+	regexp_markdown_table_sep = regexp.MustCompile(`^\s*\|?\s*:?-{3,}:?\s*(\|\s*:?-{3,}:?\s*)*\|?\s*$`)
+)
+
+// 颜色名称统一为 red | green | grey | orange | yellow | blue，十六进制颜色原样返回
+func normalizeColor(color string) string {
+	color = strings.ToLower(color)
+	switch color {
+	case "info", "green", "success":
+		return "green"
+	case "comment", "gray", "grey":
+		return "grey"
+	case "warning", "orange":
+		return "orange"
+	case "red", "danger", "error":
+		return "red"
+	}
+	return color
+}
+
+// 按颜色映射函数替换颜色标签，映射结果为空时去掉颜色只保留文本
+func replaceColor(line string, map_color func(color string) string) string {
+	return regexp_markdown_color.ReplaceAllStringFunc(line, func(s string) string {
+		match := regexp_markdown_color.FindStringSubmatch(s)
+		color := map_color(normalizeColor(match[1]))
+		if color == "" {
+			return match[2]
+		}
+		return fmt.Sprintf(`<font color="%s">%s</font>`, color, match[2])
+	})
+}
+
+func stripColor(line string) string {
+	return replaceColor(line, func(color string) string { return "" })
+}
+
+// 标题统一为 "# 标题" 格式，max_level 为平台支持的最大标题级别，超出或为 0 时转为 bold 格式
+func replaceHeading(line string, max_level int, bold string) string {
+	match := regexp_markdown_heading.FindStringSubmatch(line)
+	if match == nil {
+		return line
+	}
+	if len(match[2]) > max_level {
+		return fmt.Sprintf("%s%s%s%s", match[1], bold, match[3], bold)
+	}
+	return fmt.Sprintf("%s%s %s", match[1], match[2], match[3])
+}
+
+// 按链接格式化函数替换链接，尖括号自动链接视为文本与链接相同的链接
+func replaceLink(line string, format_link func(is_image bool, text string, url string) string) string {
+	line = regexp_markdown_link.ReplaceAllStringFunc(line, func(s string) string {
+		match := regexp_markdown_link.FindStringSubmatch(s)
+		return format_link(match[1] == "!", match[2], match[3])
+	})
+	return regexp_markdown_autolink.ReplaceAllStringFunc(line, func(s string) string {
+		url := regexp_markdown_autolink.FindStringSubmatch(s)[1]
+		return format_link(false, url, url)
+	})
+}
+
+// 图片不支持时转为链接
+func formatImageAsLink(is_image bool, text string, url string) string {
+	if text == "" {
+		text = url
+	}
+	return fmt.Sprintf("[%s](%s)", text, url)
+}
+
+func formatLink(is_image bool, text string, url string) string {
+	if is_image {
+		return fmt.Sprintf("![%s](%s)", text, url)
+	}
+	return fmt.Sprintf("[%s](%s)", text, url)
+}
+
+func splitTableRow(line string) (cells []string) {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	line = strings.TrimSuffix(line, "|")
+	for _, cell := range strings.Split(line, "|") {
+		cells = append(cells, strings.TrimSpace(cell))
+	}
+	return
+}
+
+// 将表格渲染为按列对齐的文本，中文按两个字符宽度计算
+func RenderTableText(rows [][]string) string {
+	widths := []int{}
+	for _, row := range rows {
+		for i, cell := range row {
+			if i >= len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[i] = max(widths[i], text_drawer.GetTextLength(cell))
+		}
+	}
+	lines := []string{}
+	for row_index, row := range rows {
+		cells := []string{}
+		for i, width := range widths {
+			cell := ""
+			if i < len(row) {
+				cell = row[i]
+			}
+			cells = append(cells, cell+strings.Repeat(" ", width-text_drawer.GetTextLength(cell)))
+		}
+		lines = append(lines, strings.TrimRight(strings.Join(cells, " | "), " "))
+		if row_index == 0 {
+			separators := []string{}
+			for _, width := range widths {
+				separators = append(separators, strings.Repeat("-", width))
+			}
+			lines = append(lines, strings.Join(separators, "-+-"))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// 逐行转换 markdown，代码块内的内容不转换
+//
+//	table_as_code 为 true 时，表格转为代码块中按列对齐的文本，为 false 时转为对齐的文本
+func transformMarkdown(content string, transform_line func(line string) string, table_as_code bool) string {
+	lines := strings.Split(content, "\n")
+	result := make([]string, 0, len(lines))
+	in_fence := false
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			in_fence = !in_fence
+			result = append(result, line)
+			continue
+		}
+		if in_fence {
+			result = append(result, line)
+			continue
+		}
+		// 表格：表头行之后为分隔行
+		if strings.Contains(line, "|") && i+1 < len(lines) && regexp_markdown_table_sep.MatchString(lines[i+1]) {
+			rows := [][]string{splitTableRow(line)}
+			i += 2
+			for ; i < len(lines) && strings.Contains(lines[i], "|") && strings.TrimSpace(lines[i]) != ""; i++ {
+				rows = append(rows, splitTableRow(lines[i]))
+			}
+			i--
+			for _, row := range rows {
+				for j := range row {
+					row[j] = stripColor(row[j])
+				}
+			}
+			if table_as_code {
+				result = append(result, "```", RenderTableText(rows), "```")
+			} else {
+				result = append(result, RenderTableText(rows))
+			}
+			continue
+		}
+		result = append(result, transform_line(line))
+	}
+	return strings.Join(result, "\n")
+}
+
+// 企微机器人：支持 1-6 级标题、链接，颜色仅支持 info(绿色)、comment(灰色)、warning(橙红色)，不支持图片和表格
+func RenderMarkdownWeiXinWork(content string) string {
+	return transformMarkdown(content, func(line string) string {
+		line = replaceColor(line, func(color string) string {
+			switch color {
+			case "green":
+				return "info"
+			case "grey":
+				return "comment"
+			case "orange", "red", "yellow":
+				return "warning"
+			}
+			return ""
+		})
+		line = replaceHeading(line, 6, "**")
+		return replaceLink(line, formatImageAsLink)
+	}, true)
+}
+
+// 钉钉机器人：支持 1-6 级标题、链接、图片，颜色使用十六进制，表格显示效果差转为代码块
+func RenderMarkdownDingDing(content string) string {
+	dict_color_to_hex := map[string]string{
+		"red":    "#FF0000",
+		"green":  "#008000",
+		"grey":   "#808080",
+		"orange": "#FFA500",
+		"yellow": "#FFD700",
+		"blue":   "#0000FF",
+	}
+	return transformMarkdown(content, func(line string) string {
+		line = replaceColor(line, func(color string) string {
+			if strings.HasPrefix(color, "#") {
+				return color
+			}
+			return dict_color_to_hex[color]
+		})
+		line = replaceHeading(line, 6, "**")
+		return replaceLink(line, formatLink)
+	}, true)
+}
+
+// 飞书消息卡片 lark_md：不支持标题、图片和表格，颜色仅支持 red、green、grey
+func RenderMarkdownFeiShu(content string) string {
+	return transformMarkdown(content, func(line string) string {
+		line = replaceColor(line, func(color string) string {
+			switch color {
+			case "red", "orange":
+				return "red"
+			case "green", "grey":
+				return color
+			}
+			return ""
+		})
+		line = replaceHeading(line, 0, "**")
+		return replaceLink(line, formatImageAsLink)
+	}, true)
+}
+
+// Slack mrkdwn：粗体为 *文本*，链接为 <url|文本>，不支持标题、颜色和表格
+func RenderMarkdownSlack(content string) string {
+	return transformMarkdown(content, func(line string) string {
+		line = stripColor(line)
+		line = regexp_markdown_bold.ReplaceAllString(line, "*$1*")
+		line = replaceHeading(line, 0, "*")
+		return replaceLink(line, func(is_image bool, text string, url string) string {
+			if text == "" || text == url {
+				return fmt.Sprintf("<%s>", url)
+			}
+			return fmt.Sprintf("<%s|%s>", url, text)
+		})
+	}, true)
+}
+
+// Discord：支持 1-3 级标题和链接，不支持颜色、图片和表格
+func RenderMarkdownDiscord(content string) string {
+	return transformMarkdown(content, func(line string) string {
+		line = stripColor(line)
+		line = replaceHeading(line, 3, "**")
+		return replaceLink(line, func(is_image bool, text string, url string) string {
+			if is_image || text == "" || text == url {
+				return url
+			}
+			return fmt.Sprintf("[%s](%s)", text, url)
+		})
+	}, true)
+}
+
+// Telegram Markdown：粗体为 *文本*，不支持标题、颜色、图片和表格
+func RenderMarkdownTelegram(content string) string {
+	return transformMarkdown(content, func(line string) string {
+		line = stripColor(line)
+		line = regexp_markdown_bold.ReplaceAllString(line, "*$1*")
+		line = replaceHeading(line, 0, "*")
+		return replaceLink(line, formatImageAsLink)
+	}, true)
+}
+
+// Teams MessageCard：不支持标题、颜色和表格
+func RenderMarkdownTeams(content string) string {
+	return transformMarkdown(content, func(line string) string {
+		line = stripColor(line)
+		line = replaceHeading(line, 0, "**")
+		return replaceLink(line, formatLink)
+	}, true)
+}
+
+// 去掉 markdown 格式转为纯文本，链接转为 "文本 (链接)"，表格转为按列对齐的文本
+func StripMarkdown(content string) string {
+	content = transformMarkdown(content, func(line string) string {
+		line = stripColor(line)
+		line = regexp_markdown_bold.ReplaceAllString(line, "$1")
+		line = replaceHeading(line, 0, "")
+		return replaceLink(line, func(is_image bool, text string, url string) string {
+			if text == "" || text == url {
+				return url
+			}
+			return fmt.Sprintf("%s (%s)", text, url)
+		})
+	}, false)
+	lines := []string{}
+	for _, line := range strings.Split(content, "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "```") {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// 按 webhook 类型转换 markdown 方言，未配置的类型原样返回
+func RenderMarkdown(webhook_type string, content string) string {
+	renderer, ok := DICT_WEBHOOK_TYPE_TO_MARKDOWN_RENDERER[webhook_type]
+	if !ok {
+		return content
+	}
+	return renderer(content)
+}
@@ -0,0 +1,60 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// @提醒
+type Mention struct {
+	UserIDs []string // 用户 ID，企微为 userid，钉钉为 userId，飞书为 open_id 或 user_id
+	Mobiles []string // 手机号，飞书机器人不支持
+	AtAll   bool     // @所有人
+}
+
+func (mention *Mention) IsEmpty() bool {
+	return mention == nil || (len(mention.UserIDs) == 0 && len(mention.Mobiles) == 0 && !mention.AtAll)
+}
+
+var ErrMentionNotSupported = errors.New("不支持@提醒")
+
+// 平台的消息类型不支持部分或全部@提醒时返回的警告，此时消息仍会正常发送
+type MentionWarning struct {
+	WebhookType string // webhook 类型
+	MessageType string // 消息类型
+	Reason      string // 不支持的原因
+}
+
+func (mention_warning *MentionWarning) Error() string {
+	return fmt.Sprintf("%s的 %s 类型消息%s，已忽略", mention_warning.WebhookType, mention_warning.MessageType, mention_warning.Reason)
+}
+
+func (mention_warning *MentionWarning) Unwrap() error {
+	return ErrMentionNotSupported
+}
+
+// 是否为警告，警告表示消息已发送但部分内容被忽略
+func IsWarning(err error) bool {
+	return errors.Is(err, ErrMentionNotSupported)
+}
+
+func newMentionWarning(provider Provider, message *Message, reason string) *MentionWarning {
+	return &MentionWarning{
+		WebhookType: provider.Name(),
+		MessageType: message.MessageType,
+		Reason:      reason,
+	}
+}
+
+// 将 @ 列表按 format 格式化后追加到内容末尾，例如 "@%s"、"<@%s>"
+func appendMentionText(content string, items []string, format string) string {
+	if len(items) == 0 {
+		return content
+	}
+	mention_text := make([]string, 0, len(items))
+	for _, item := range items {
+		mention_text = append(mention_text, fmt.Sprintf(format, item))
+	}
+	return content + "\n" + strings.Join(mention_text, " ")
+}
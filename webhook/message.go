@@ -0,0 +1,255 @@
+package webhook
+
+import (
+	"encoding/json"
+)
+
+// 消息构造器，每次调用 ToMap 都返回新的 map，可在多个 goroutine 中并发使用
+type MessageBuilder interface {
+	ToMap() map[string]any
+}
+
+// 通过 JSON 序列化深拷贝为 map[string]any
+func toMap(v any) (result map[string]any) {
+	result = map[string]any{}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	json.Unmarshal(data, &result)
+	return
+}
+
+// 获取消息模板的副本，修改副本不会影响 DICT_WEBHOOK_TYPE_TO_MESSAGE_TEMPLATE
+func GetMessageTemplate(webhook_type string, message_type string) (template map[string]any, ok bool) {
+	template, ok = DICT_WEBHOOK_TYPE_TO_MESSAGE_TEMPLATE[webhook_type][message_type]
+	if !ok {
+		return nil, false
+	}
+	return toMap(template), true
+}
+
+// 企微机器人消息
+type WeiXinWorkMessage struct {
+	MsgType      string                  `json:"msgtype"`
+	Text         *WeiXinWorkText         `json:"text,omitempty"`
+	Markdown     *WeiXinWorkMarkdown     `json:"markdown,omitempty"`
+	Image        *WeiXinWorkImage        `json:"image,omitempty"`
+	News         *WeiXinWorkNews         `json:"news,omitempty"`
+	File         *WeiXinWorkFile         `json:"file,omitempty"`
+	TemplateCard *WeiXinWorkTemplateCard `json:"template_card,omitempty"`
+}
+
+type WeiXinWorkText struct {
+	Content             string   `json:"content"`
+	MentionedList       []string `json:"mentioned_list,omitempty"`        // @的 userid 列表，"@all" 表示所有人
+	MentionedMobileList []string `json:"mentioned_mobile_list,omitempty"` // @的手机号列表，"@all" 表示所有人
+}
+
+type WeiXinWorkMarkdown struct {
+	Content string `json:"content"`
+}
+
+type WeiXinWorkImage struct {
+	Base64 string `json:"base64"`
+	MD5    string `json:"md5"`
+}
+
+func (message *WeiXinWorkMessage) ToMap() map[string]any {
+	return toMap(message)
+}
+
+func NewWeiXinWorkText(content string) *WeiXinWorkMessage {
+	return &WeiXinWorkMessage{MsgType: MESSAGE_TYPE_TEXT, Text: &WeiXinWorkText{Content: content}}
+}
+
+func NewWeiXinWorkMarkdown(content string) *WeiXinWorkMessage {
+	return &WeiXinWorkMessage{MsgType: MESSAGE_TYPE_MARKDOWN, Markdown: &WeiXinWorkMarkdown{Content: content}}
+}
+
+func NewWeiXinWorkImage(image_base64 string, image_md5 string) *WeiXinWorkMessage {
+	return &WeiXinWorkMessage{MsgType: MESSAGE_TYPE_IMAGE, Image: &WeiXinWorkImage{Base64: image_base64, MD5: image_md5}}
+}
+
+// 钉钉机器人消息
+type DingDingMessage struct {
+	MsgType  string            `json:"msgtype"`
+	Text     *DingDingText     `json:"text,omitempty"`
+	Markdown *DingDingMarkdown `json:"markdown,omitempty"`
+	At       *DingDingAt       `json:"at,omitempty"`
+}
+
+type DingDingAt struct {
+	AtMobiles []string `json:"atMobiles,omitempty"`
+	AtUserIds []string `json:"atUserIds,omitempty"`
+	IsAtAll   bool     `json:"isAtAll,omitempty"`
+}
+
+type DingDingText struct {
+	Content string `json:"content"`
+}
+
+type DingDingMarkdown struct {
+	Title string `json:"title"`
+	Text  string `json:"text"`
+}
+
+func (message *DingDingMessage) ToMap() map[string]any {
+	return toMap(message)
+}
+
+func NewDingDingText(content string) *DingDingMessage {
+	return &DingDingMessage{MsgType: MESSAGE_TYPE_TEXT, Text: &DingDingText{Content: content}}
+}
+
+// 钉钉机器人的 Markdown 类型必须指定标题，title 为空时使用“新消息”
+func NewDingDingMarkdown(title string, text string) *DingDingMessage {
+	if title == "" {
+		title = "新消息"
+	}
+	return &DingDingMessage{MsgType: MESSAGE_TYPE_MARKDOWN, Markdown: &DingDingMarkdown{Title: title, Text: text}}
+}
+
+// 飞书机器人消息
+type FeiShuMessage struct {
+	MsgType string         `json:"msg_type"`
+	Content *FeiShuContent `json:"content,omitempty"`
+	Card    *FeiShuCard    `json:"card,omitempty"` // interactive 类型的消息卡片
+}
+
+type FeiShuContent struct {
+	Text     string      `json:"text,omitempty"`
+	ImageKey string      `json:"image_key,omitempty"`
+	Post     *FeiShuPost `json:"post,omitempty"` // post 类型的富文本
+}
+
+func (message *FeiShuMessage) ToMap() map[string]any {
+	return toMap(message)
+}
+
+func NewFeiShuText(text string) *FeiShuMessage {
+	return &FeiShuMessage{MsgType: MESSAGE_TYPE_TEXT, Content: &FeiShuContent{Text: text}}
+}
+
+func NewFeiShuImage(image_key string) *FeiShuMessage {
+	return &FeiShuMessage{MsgType: MESSAGE_TYPE_IMAGE, Content: &FeiShuContent{ImageKey: image_key}}
+}
+
+// Slack 机器人消息
+type SlackMessage struct {
+	Text   string       `json:"text"`
+	Blocks []SlackBlock `json:"blocks,omitempty"`
+}
+
+type SlackBlock struct {
+	Type     string     `json:"type"`
+	Text     *SlackText `json:"text,omitempty"`
+	ImageURL string     `json:"image_url,omitempty"`
+	AltText  string     `json:"alt_text,omitempty"`
+}
+
+type SlackText struct {
+	Type string `json:"type"` // plain_text | mrkdwn
+	Text string `json:"text"`
+}
+
+func (message *SlackMessage) ToMap() map[string]any {
+	return toMap(message)
+}
+
+func NewSlackText(text string) *SlackMessage {
+	return &SlackMessage{Text: text}
+}
+
+// text 作为通知预览，markdown 内容以 mrkdwn section 的形式发送
+func NewSlackMarkdown(text string) *SlackMessage {
+	return &SlackMessage{
+		Text:   text,
+		Blocks: []SlackBlock{{Type: "section", Text: &SlackText{Type: "mrkdwn", Text: text}}},
+	}
+}
+
+func NewSlackImage(title string, image_url string) *SlackMessage {
+	if title == "" {
+		title = "image"
+	}
+	return &SlackMessage{
+		Text:   title,
+		Blocks: []SlackBlock{{Type: "image", ImageURL: image_url, AltText: title}},
+	}
+}
+
+// Discord 机器人消息
+type DiscordMessage struct {
+	Content string         `json:"content,omitempty"`
+	Embeds  []DiscordEmbed `json:"embeds,omitempty"`
+}
+
+type DiscordEmbed struct {
+	Title string             `json:"title,omitempty"`
+	Image *DiscordEmbedImage `json:"image,omitempty"`
+}
+
+type DiscordEmbedImage struct {
+	URL string `json:"url"`
+}
+
+func (message *DiscordMessage) ToMap() map[string]any {
+	return toMap(message)
+}
+
+// Discord 原生支持 markdown，text 与 markdown 类型的格式相同
+func NewDiscordText(content string) *DiscordMessage {
+	return &DiscordMessage{Content: content}
+}
+
+func NewDiscordImage(title string, image_url string) *DiscordMessage {
+	return &DiscordMessage{Embeds: []DiscordEmbed{{Title: title, Image: &DiscordEmbedImage{URL: image_url}}}}
+}
+
+// Telegram 机器人消息
+type TelegramMessage struct {
+	ChatID    string `json:"chat_id"`
+	Text      string `json:"text"`
+	ParseMode string `json:"parse_mode,omitempty"` // Markdown | MarkdownV2 | HTML
+}
+
+func (message *TelegramMessage) ToMap() map[string]any {
+	return toMap(message)
+}
+
+func NewTelegramText(chat_id string, text string) *TelegramMessage {
+	return &TelegramMessage{ChatID: chat_id, Text: text}
+}
+
+func NewTelegramMarkdown(chat_id string, text string) *TelegramMessage {
+	return &TelegramMessage{ChatID: chat_id, Text: text, ParseMode: "Markdown"}
+}
+
+// Teams 机器人消息，使用 MessageCard 格式
+type TeamsMessage struct {
+	Type    string `json:"@type"`
+	Context string `json:"@context"`
+	Summary string `json:"summary"`
+	Title   string `json:"title,omitempty"`
+	Text    string `json:"text"`
+}
+
+func (message *TeamsMessage) ToMap() map[string]any {
+	return toMap(message)
+}
+
+// MessageCard 的 text 支持 markdown，summary 为通知预览，不能为空
+func NewTeamsMessage(title string, text string) *TeamsMessage {
+	summary := title
+	if summary == "" {
+		summary = "新消息"
+	}
+	return &TeamsMessage{
+		Type:    "MessageCard",
+		Context: "http://schema.org/extensions",
+		Summary: summary,
+		Title:   title,
+		Text:    text,
+	}
+}
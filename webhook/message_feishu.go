@@ -0,0 +1,167 @@
+package webhook
+
+const (
+	FEISHU_MESSAGE_TYPE_POST        string = "post"
+	FEISHU_MESSAGE_TYPE_INTERACTIVE string = "interactive"
+)
+
+// 飞书富文本消息，每个段落由多个元素组成
+//
+//	webhook.NewFeiShuPost("标题").
+//		AddParagraph(webhook.FeiShuPostText("告警: "), webhook.FeiShuPostLink("详情", "https://example.com")).
+//		AddParagraph(webhook.FeiShuPostAt("all")).
+//		ToMap()
+type FeiShuPost struct {
+	ZhCN *FeiShuPostContent `json:"zh_cn"`
+}
+
+type FeiShuPostContent struct {
+	Title   string                `json:"title"`
+	Content [][]FeiShuPostElement `json:"content"`
+}
+
+type FeiShuPostElement struct {
+	Tag      string `json:"tag"` // text | a | at | img
+	Text     string `json:"text,omitempty"`
+	Href     string `json:"href,omitempty"`
+	UserID   string `json:"user_id,omitempty"`
+	ImageKey string `json:"image_key,omitempty"`
+}
+
+func NewFeiShuPost(title string) *FeiShuPost {
+	return &FeiShuPost{ZhCN: &FeiShuPostContent{Title: title, Content: [][]FeiShuPostElement{}}}
+}
+
+// 添加一个段落
+func (post *FeiShuPost) AddParagraph(elements ...FeiShuPostElement) *FeiShuPost {
+	post.ZhCN.Content = append(post.ZhCN.Content, elements)
+	return post
+}
+
+func (post *FeiShuPost) ToMap() map[string]any {
+	return toMap(&FeiShuMessage{MsgType: FEISHU_MESSAGE_TYPE_POST, Content: &FeiShuContent{Post: post}})
+}
+
+func FeiShuPostText(text string) FeiShuPostElement {
+	return FeiShuPostElement{Tag: "text", Text: text}
+}
+
+func FeiShuPostLink(text string, href string) FeiShuPostElement {
+	return FeiShuPostElement{Tag: "a", Text: text, Href: href}
+}
+
+// user_id 为 open_id 或 user_id，"all" 表示所有人
+func FeiShuPostAt(user_id string) FeiShuPostElement {
+	return FeiShuPostElement{Tag: "at", UserID: user_id}
+}
+
+func FeiShuPostImage(image_key string) FeiShuPostElement {
+	return FeiShuPostElement{Tag: "img", ImageKey: image_key}
+}
+
+// 飞书消息卡片
+//
+//	webhook.NewFeiShuCard("服务告警", "red").
+//		AddMarkdown("**主机**: web-01").
+//		AddFields(webhook.NewFeiShuCardField(true, "**级别**\nP1"), webhook.NewFeiShuCardField(true, "**状态**\n触发")).
+//		AddButtons(webhook.NewFeiShuCardButton("查看详情", "https://example.com", "primary")).
+//		ToMap()
+type FeiShuCard struct {
+	Config   *FeiShuCardConfig   `json:"config,omitempty"`
+	Header   *FeiShuCardHeader   `json:"header,omitempty"`
+	Elements []FeiShuCardElement `json:"elements"`
+}
+
+type FeiShuCardConfig struct {
+	WideScreenMode bool `json:"wide_screen_mode"`
+}
+
+type FeiShuCardHeader struct {
+	Title    FeiShuCardText `json:"title"`
+	Template string         `json:"template,omitempty"` // 标题颜色，blue | wathet | turquoise | green | yellow | orange | red | carmine | violet | purple | indigo | grey
+}
+
+type FeiShuCardText struct {
+	Tag     string `json:"tag"` // plain_text | lark_md
+	Content string `json:"content"`
+}
+
+type FeiShuCardElement struct {
+	Tag     string             `json:"tag"` // div | hr | action
+	Text    *FeiShuCardText    `json:"text,omitempty"`
+	Fields  []FeiShuCardField  `json:"fields,omitempty"`
+	Actions []FeiShuCardAction `json:"actions,omitempty"`
+}
+
+type FeiShuCardField struct {
+	IsShort bool           `json:"is_short"`
+	Text    FeiShuCardText `json:"text"`
+}
+
+type FeiShuCardAction struct {
+	Tag  string         `json:"tag"`
+	Text FeiShuCardText `json:"text"`
+	URL  string         `json:"url,omitempty"`
+	Type string         `json:"type,omitempty"` // default | primary | danger
+}
+
+// title 为空时不显示标题，template 为标题颜色，为空时使用默认颜色
+func NewFeiShuCard(title string, template string) *FeiShuCard {
+	card := &FeiShuCard{
+		Config:   &FeiShuCardConfig{WideScreenMode: true},
+		Elements: []FeiShuCardElement{},
+	}
+	if title != "" {
+		card.Header = &FeiShuCardHeader{
+			Title:    FeiShuCardText{Tag: "plain_text", Content: title},
+			Template: template,
+		}
+	}
+	return card
+}
+
+// 添加 lark_md 格式的文本
+func (card *FeiShuCard) AddMarkdown(content string) *FeiShuCard {
+	card.Elements = append(card.Elements, FeiShuCardElement{
+		Tag:  "div",
+		Text: &FeiShuCardText{Tag: "lark_md", Content: content},
+	})
+	return card
+}
+
+// 添加字段，is_short 的字段两列并排显示
+func (card *FeiShuCard) AddFields(fields ...FeiShuCardField) *FeiShuCard {
+	card.Elements = append(card.Elements, FeiShuCardElement{Tag: "div", Fields: fields})
+	return card
+}
+
+// 添加按钮
+func (card *FeiShuCard) AddButtons(buttons ...FeiShuCardAction) *FeiShuCard {
+	card.Elements = append(card.Elements, FeiShuCardElement{Tag: "action", Actions: buttons})
+	return card
+}
+
+// 添加分割线
+func (card *FeiShuCard) AddDivider() *FeiShuCard {
+	card.Elements = append(card.Elements, FeiShuCardElement{Tag: "hr"})
+	return card
+}
+
+func (card *FeiShuCard) ToMap() map[string]any {
+	return toMap(&FeiShuMessage{MsgType: FEISHU_MESSAGE_TYPE_INTERACTIVE, Card: card})
+}
+
+// content 为 lark_md 格式
+func NewFeiShuCardField(is_short bool, content string) FeiShuCardField {
+	return FeiShuCardField{IsShort: is_short, Text: FeiShuCardText{Tag: "lark_md", Content: content}}
+}
+
+// button_type 为 default | primary | danger
+func NewFeiShuCardButton(text string, url string, button_type string) FeiShuCardAction {
+	return FeiShuCardAction{
+		Tag:  "button",
+		Text: FeiShuCardText{Tag: "plain_text", Content: text},
+		URL:  url,
+		Type: button_type,
+	}
+}
@@ -0,0 +1,146 @@
+package webhook
+
+const (
+	WEIXIN_WORK_MESSAGE_TYPE_NEWS          string = "news"
+	WEIXIN_WORK_MESSAGE_TYPE_FILE          string = "file"
+	WEIXIN_WORK_MESSAGE_TYPE_TEMPLATE_CARD string = "template_card"
+	WEIXIN_WORK_MEDIA_TYPE_FILE            string = "file"  // 普通文件，不超过 20MB
+	WEIXIN_WORK_MEDIA_TYPE_VOICE           string = "voice" // 语音，仅支持 AMR 格式，不超过 2MB
+)
+
+// 企微机器人图文消息，最多 8 条图文
+type WeiXinWorkNews struct {
+	Articles []WeiXinWorkArticle `json:"articles"`
+}
+
+type WeiXinWorkArticle struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	URL         string `json:"url"`
+	PicURL      string `json:"picurl,omitempty"`
+}
+
+func NewWeiXinWorkNews(articles ...WeiXinWorkArticle) *WeiXinWorkMessage {
+	return &WeiXinWorkMessage{MsgType: WEIXIN_WORK_MESSAGE_TYPE_NEWS, News: &WeiXinWorkNews{Articles: articles}}
+}
+
+// 企微机器人文件消息，media_id 通过 WebhookSender.UploadMedia 获取
+type WeiXinWorkFile struct {
+	MediaID string `json:"media_id"`
+}
+
+func NewWeiXinWorkFile(media_id string) *WeiXinWorkMessage {
+	return &WeiXinWorkMessage{MsgType: WEIXIN_WORK_MESSAGE_TYPE_FILE, File: &WeiXinWorkFile{MediaID: media_id}}
+}
+
+// 企微机器人模版卡片消息
+//
+//	webhook.NewWeiXinWorkTemplateCard("text_notice", "服务告警", "web-01 CPU 使用率过高").
+//		SetEmphasisContent("95%", "CPU 使用率").
+//		AddHorizontalContent("级别", "P1", "").
+//		AddJump("查看详情", "https://example.com").
+//		SetCardAction("https://example.com").
+//		ToMap()
+type WeiXinWorkTemplateCard struct {
+	CardType              string                        `json:"card_type"` // text_notice | news_notice
+	Source                *WeiXinWorkCardSource         `json:"source,omitempty"`
+	MainTitle             WeiXinWorkCardTitle           `json:"main_title"`
+	EmphasisContent       *WeiXinWorkCardTitle          `json:"emphasis_content,omitempty"`
+	CardImage             *WeiXinWorkCardImage          `json:"card_image,omitempty"`
+	SubTitleText          string                        `json:"sub_title_text,omitempty"`
+	HorizontalContentList []WeiXinWorkHorizontalContent `json:"horizontal_content_list,omitempty"`
+	JumpList              []WeiXinWorkCardJump          `json:"jump_list,omitempty"`
+	CardAction            WeiXinWorkCardAction          `json:"card_action"`
+}
+
+type WeiXinWorkCardSource struct {
+	IconURL   string `json:"icon_url,omitempty"`
+	Desc      string `json:"desc,omitempty"`
+	DescColor int    `json:"desc_color,omitempty"` // 0 灰色，1 黑色，2 红色，3 绿色
+}
+
+type WeiXinWorkCardTitle struct {
+	Title string `json:"title,omitempty"`
+	Desc  string `json:"desc,omitempty"`
+}
+
+type WeiXinWorkCardImage struct {
+	URL         string  `json:"url"`
+	AspectRatio float64 `json:"aspect_ratio,omitempty"`
+}
+
+type WeiXinWorkHorizontalContent struct {
+	Type    int    `json:"type,omitempty"` // 0 文本，1 链接，2 附件
+	KeyName string `json:"keyname"`
+	Value   string `json:"value,omitempty"`
+	URL     string `json:"url,omitempty"`
+	MediaID string `json:"media_id,omitempty"`
+}
+
+type WeiXinWorkCardJump struct {
+	Type  int    `json:"type"` // 1 链接
+	URL   string `json:"url"`
+	Title string `json:"title"`
+}
+
+type WeiXinWorkCardAction struct {
+	Type int    `json:"type"` // 1 链接
+	URL  string `json:"url"`
+}
+
+// card_type 为 text_notice 或 news_notice，模版卡片必须指定 card_action，可使用 SetCardAction 设置
+func NewWeiXinWorkTemplateCard(card_type string, title string, desc string) *WeiXinWorkTemplateCard {
+	return &WeiXinWorkTemplateCard{
+		CardType:  card_type,
+		MainTitle: WeiXinWorkCardTitle{Title: title, Desc: desc},
+	}
+}
+
+func (card *WeiXinWorkTemplateCard) SetSource(icon_url string, desc string, desc_color int) *WeiXinWorkTemplateCard {
+	card.Source = &WeiXinWorkCardSource{IconURL: icon_url, Desc: desc, DescColor: desc_color}
+	return card
+}
+
+// 关键数据，仅 text_notice 类型支持
+func (card *WeiXinWorkTemplateCard) SetEmphasisContent(title string, desc string) *WeiXinWorkTemplateCard {
+	card.EmphasisContent = &WeiXinWorkCardTitle{Title: title, Desc: desc}
+	return card
+}
+
+// 卡片图片，仅 news_notice 类型支持
+func (card *WeiXinWorkTemplateCard) SetCardImage(url string, aspect_ratio float64) *WeiXinWorkTemplateCard {
+	card.CardImage = &WeiXinWorkCardImage{URL: url, AspectRatio: aspect_ratio}
+	return card
+}
+
+func (card *WeiXinWorkTemplateCard) SetSubTitleText(s string) *WeiXinWorkTemplateCard {
+	card.SubTitleText = s
+	return card
+}
+
+// 添加二级标题和文本，url 不为空时为链接
+func (card *WeiXinWorkTemplateCard) AddHorizontalContent(key_name string, value string, url string) *WeiXinWorkTemplateCard {
+	horizontal_content := WeiXinWorkHorizontalContent{KeyName: key_name, Value: value}
+	if url != "" {
+		horizontal_content.Type = 1
+		horizontal_content.URL = url
+	}
+	card.HorizontalContentList = append(card.HorizontalContentList, horizontal_content)
+	return card
+}
+
+// 添加跳转链接
+func (card *WeiXinWorkTemplateCard) AddJump(title string, url string) *WeiXinWorkTemplateCard {
+	card.JumpList = append(card.JumpList, WeiXinWorkCardJump{Type: 1, URL: url, Title: title})
+	return card
+}
+
+// 点击卡片跳转的链接
+func (card *WeiXinWorkTemplateCard) SetCardAction(url string) *WeiXinWorkTemplateCard {
+	card.CardAction = WeiXinWorkCardAction{Type: 1, URL: url}
+	return card
+}
+
+func (card *WeiXinWorkTemplateCard) ToMap() map[string]any {
+	return toMap(&WeiXinWorkMessage{MsgType: WEIXIN_WORK_MESSAGE_TYPE_TEMPLATE_CARD, TemplateCard: card})
+}
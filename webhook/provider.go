@@ -0,0 +1,276 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/SimoLin/go-utils/text_drawer"
+)
+
+// 通用消息，由 Provider 转换为各平台的请求体
+type Message struct {
+	MessageType string // 消息类型，MESSAGE_TYPE_TEXT | MESSAGE_TYPE_MARKDOWN | MESSAGE_TYPE_IMAGE
+	Title       string // 消息标题，为空时由平台决定是否使用默认标题
+	Content     string // 文本或 markdown 内容
+	Image       []byte // 图片内容，企微机器人直接发送
+	ImageURL    string // 图片上传后的链接，飞书机器人为 image_key
+	Mention     *Mention
+}
+
+// webhook 平台，负责构造请求地址、请求体以及解析响应
+type Provider interface {
+	// webhook 类型名称，同时作为注册名称
+	Name() string
+	// 默认服务端地址
+	ServerAddress() string
+	// 根据服务端地址和 key 拼接请求地址
+	RequestURL(server_address string, api_key string) string
+	// 将通用消息转换为平台请求体，@提醒不支持时返回 *MentionWarning，此时 payload 仍可发送
+	BuildPayload(message *Message) (payload map[string]any, err error)
+	// 解析平台响应，平台返回错误时返回 *WebhookError
+	ParseResponse(status_code int, response_body []byte) error
+}
+
+// 支持加签的平台实现该接口，返回签名后的请求地址和请求体，不应修改传入的 payload
+type SignProvider interface {
+	Sign(request_url string, payload map[string]any, secret string) (string, map[string]any)
+}
+
+var (
+	providers_mutex sync.RWMutex
+	providers       = map[string]Provider{}
+)
+
+// 注册 webhook 平台，名称相同时覆盖已注册的平台
+func RegisterProvider(provider Provider) {
+	providers_mutex.Lock()
+	defer providers_mutex.Unlock()
+	providers[provider.Name()] = provider
+}
+
+// 按 webhook 类型获取已注册的平台
+func GetProvider(webhook_type string) (provider Provider, ok bool) {
+	providers_mutex.RLock()
+	defer providers_mutex.RUnlock()
+	provider, ok = providers[webhook_type]
+	return
+}
+
+func init() {
+	RegisterProvider(&WeiXinWorkProvider{})
+	RegisterProvider(&DingDingProvider{})
+	RegisterProvider(&FeiShuProvider{})
+}
+
+// 解析 errcode/errmsg 或 code/msg 格式的响应
+func parseCodeResponse(webhook_type string, status_code int, response_body []byte, code_key string, msg_key string) (err error) {
+	response := map[string]any{}
+	json_err := json.Unmarshal(response_body, &response)
+	webhook_error := &WebhookError{
+		WebhookType: webhook_type,
+		StatusCode:  status_code,
+	}
+	if code, ok := response[code_key].(float64); ok {
+		webhook_error.Code = int(code)
+	}
+	webhook_error.Message, _ = response[msg_key].(string)
+	if webhook_error.Code != 0 {
+		return webhook_error
+	}
+	if status_code < 200 || status_code >= 300 {
+		if webhook_error.Message == "" {
+			webhook_error.Message = http.StatusText(status_code)
+		}
+		return webhook_error
+	}
+	if json_err != nil {
+		return fmt.Errorf("%s响应解析失败: %w", webhook_type, json_err)
+	}
+	return
+}
+
+// 企微机器人
+type WeiXinWorkProvider struct{}
+
+func (provider *WeiXinWorkProvider) Name() string {
+	return WEBHOOK_TYPE_WEIXIN_WORK
+}
+
+func (provider *WeiXinWorkProvider) ServerAddress() string {
+	return DICT_WEBHOOK_TYPE_TO_SERVER_ADDRESS[WEBHOOK_TYPE_WEIXIN_WORK]
+}
+
+func (provider *WeiXinWorkProvider) RequestURL(server_address string, api_key string) string {
+	return server_address + api_key
+}
+
+// 企微机器人 text 类型支持 @userid 和 @手机号，markdown 类型仅支持 <@userid>
+func (provider *WeiXinWorkProvider) BuildPayload(message *Message) (payload map[string]any, err error) {
+	mention := message.Mention
+	switch message.MessageType {
+	case MESSAGE_TYPE_TEXT:
+		weixin_work_message := NewWeiXinWorkText(message.Content)
+		if !mention.IsEmpty() {
+			weixin_work_message.Text.MentionedList = append([]string{}, mention.UserIDs...)
+			weixin_work_message.Text.MentionedMobileList = append([]string{}, mention.Mobiles...)
+			if mention.AtAll {
+				weixin_work_message.Text.MentionedList = append(weixin_work_message.Text.MentionedList, "@all")
+			}
+		}
+		return weixin_work_message.ToMap(), nil
+	case MESSAGE_TYPE_MARKDOWN:
+		content := message.Content
+		if !mention.IsEmpty() {
+			content = appendMentionText(content, mention.UserIDs, "<@%s>")
+			if len(mention.Mobiles) > 0 || mention.AtAll {
+				err = newMentionWarning(provider, message, "不支持@手机号和@所有人")
+			}
+		}
+		return NewWeiXinWorkMarkdown(content).ToMap(), err
+	case MESSAGE_TYPE_IMAGE:
+		if !mention.IsEmpty() {
+			err = newMentionWarning(provider, message, "不支持@提醒")
+		}
+		return NewWeiXinWorkImage(text_drawer.GetImageBytesBase64(message.Image), text_drawer.GetImageBytesMD5(message.Image)).ToMap(), err
+	}
+	return nil, fmt.Errorf("%s不支持的消息类型: %s", provider.Name(), message.MessageType)
+}
+
+func (provider *WeiXinWorkProvider) ParseResponse(status_code int, response_body []byte) error {
+	return parseCodeResponse(provider.Name(), status_code, response_body, "errcode", "errmsg")
+}
+
+// 钉钉机器人
+type DingDingProvider struct{}
+
+func (provider *DingDingProvider) Name() string {
+	return WEBHOOK_TYPE_DINGDING
+}
+
+func (provider *DingDingProvider) ServerAddress() string {
+	return DICT_WEBHOOK_TYPE_TO_SERVER_ADDRESS[WEBHOOK_TYPE_DINGDING]
+}
+
+func (provider *DingDingProvider) RequestURL(server_address string, api_key string) string {
+	return server_address + api_key
+}
+
+// 钉钉机器人不支持 image 类型，改为使用 markdown 图片链接
+//
+//	@提醒写入 at 字段，markdown 类型需要在内容中包含 @手机号 或 @userId 才会生效
+func (provider *DingDingProvider) BuildPayload(message *Message) (payload map[string]any, err error) {
+	var dingding_message *DingDingMessage
+	switch message.MessageType {
+	case MESSAGE_TYPE_TEXT:
+		dingding_message = NewDingDingText(message.Content)
+	case MESSAGE_TYPE_MARKDOWN:
+		dingding_message = NewDingDingMarkdown(message.Title, message.Content)
+	case MESSAGE_TYPE_IMAGE:
+		if message.ImageURL == "" {
+			return nil, fmt.Errorf("钉钉机器人发送图片需要使用 WithImageUploader 指定图片上传函数")
+		}
+		dingding_message = NewDingDingMarkdown(message.Title, fmt.Sprintf("![image](%s)", message.ImageURL))
+	default:
+		return nil, fmt.Errorf("%s不支持的消息类型: %s", provider.Name(), message.MessageType)
+	}
+	if mention := message.Mention; !mention.IsEmpty() {
+		dingding_message.At = &DingDingAt{
+			AtMobiles: append([]string{}, mention.Mobiles...),
+			AtUserIds: append([]string{}, mention.UserIDs...),
+			IsAtAll:   mention.AtAll,
+		}
+		if dingding_message.Markdown != nil {
+			dingding_message.Markdown.Text = appendMentionText(dingding_message.Markdown.Text, mention.Mobiles, "@%s")
+			dingding_message.Markdown.Text = appendMentionText(dingding_message.Markdown.Text, mention.UserIDs, "@%s")
+		}
+	}
+	return dingding_message.ToMap(), nil
+}
+
+// 钉钉机器人加签，签名以 timestamp 和 sign 参数拼接在请求地址中
+func (provider *DingDingProvider) Sign(request_url string, payload map[string]any, secret string) (string, map[string]any) {
+	timestamp, sign := SignDingDing(secret, time.Now())
+	return fmt.Sprintf("%s&timestamp=%s&sign=%s", request_url, timestamp, url.QueryEscape(sign)), payload
+}
+
+func (provider *DingDingProvider) ParseResponse(status_code int, response_body []byte) error {
+	return parseCodeResponse(provider.Name(), status_code, response_body, "errcode", "errmsg")
+}
+
+// 飞书机器人
+type FeiShuProvider struct{}
+
+func (provider *FeiShuProvider) Name() string {
+	return WEBHOOK_TYPE_FEISHU
+}
+
+func (provider *FeiShuProvider) ServerAddress() string {
+	return DICT_WEBHOOK_TYPE_TO_SERVER_ADDRESS[WEBHOOK_TYPE_FEISHU]
+}
+
+func (provider *FeiShuProvider) RequestURL(server_address string, api_key string) string {
+	return server_address + api_key
+}
+
+// 飞书机器人的 markdown 类型以消息卡片的 lark_md 元素发送；图片需要先上传获取 image_key
+//
+//	@提醒在 text 类型中以 <at user_id="..."></at> 标签写入，在消息卡片中以 <at id=...></at> 写入，不支持@手机号
+func (provider *FeiShuProvider) BuildPayload(message *Message) (payload map[string]any, err error) {
+	mention := message.Mention
+	if !mention.IsEmpty() && len(mention.Mobiles) > 0 {
+		err = newMentionWarning(provider, message, "不支持@手机号")
+	}
+	switch message.MessageType {
+	case MESSAGE_TYPE_TEXT:
+		content := message.Content
+		if !mention.IsEmpty() {
+			content = appendMentionText(content, mention.UserIDs, `<at user_id="%s"></at>`)
+			if mention.AtAll {
+				content = appendMentionText(content, []string{"all"}, `<at user_id="%s">所有人</at>`)
+			}
+		}
+		return NewFeiShuText(content).ToMap(), err
+	case MESSAGE_TYPE_MARKDOWN:
+		content := message.Content
+		if !mention.IsEmpty() {
+			content = appendMentionText(content, mention.UserIDs, "<at id=%s></at>")
+			if mention.AtAll {
+				content = appendMentionText(content, []string{"all"}, "<at id=%s></at>")
+			}
+		}
+		return NewFeiShuCard(message.Title, "").AddMarkdown(content).ToMap(), err
+	case MESSAGE_TYPE_IMAGE:
+		if message.ImageURL == "" {
+			return nil, fmt.Errorf("飞书机器人发送图片需要使用 WithFeiShuApp 指定应用的 app_id 和 app_secret")
+		}
+		if !mention.IsEmpty() {
+			err = newMentionWarning(provider, message, "不支持@提醒")
+		}
+		return NewFeiShuImage(message.ImageURL).ToMap(), err
+	}
+	return nil, fmt.Errorf("%s不支持的消息类型: %s", provider.Name(), message.MessageType)
+}
+
+// 飞书机器人签名校验，签名以 timestamp 和 sign 字段写入请求体
+func (provider *FeiShuProvider) Sign(request_url string, payload map[string]any, secret string) (string, map[string]any) {
+	// 复制一份再写入签名，避免修改调用方的 payload
+	signed_payload := make(map[string]any, len(payload)+2)
+	for k, v := range payload {
+		signed_payload[k] = v
+	}
+	signed_payload["timestamp"], signed_payload["sign"] = SignFeiShu(secret, time.Now())
+	return request_url, signed_payload
+}
+
+// 飞书响应格式为 {"code": 0, "msg": "success"}，旧版本为 {"StatusCode": 0, "StatusMessage": "success"}
+func (provider *FeiShuProvider) ParseResponse(status_code int, response_body []byte) (err error) {
+	err = parseCodeResponse(provider.Name(), status_code, response_body, "code", "msg")
+	if err != nil {
+		return
+	}
+	return parseCodeResponse(provider.Name(), status_code, response_body, "StatusCode", "StatusMessage")
+}
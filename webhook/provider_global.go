@@ -0,0 +1,301 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+)
+
+func init() {
+	RegisterProvider(&SlackProvider{})
+	RegisterProvider(&DiscordProvider{})
+	RegisterProvider(&TelegramProvider{})
+	RegisterProvider(&TeamsProvider{})
+	generic_provider, _ := NewGenericProvider(WEBHOOK_TYPE_GENERIC, "", DEFAULT_GENERIC_PAYLOAD_TEMPLATE)
+	RegisterProvider(generic_provider)
+}
+
+// 解析以 HTTP 状态码表示结果的响应，错误码使用 HTTP 状态码，错误信息使用响应内容
+func parseStatusResponse(webhook_type string, status_code int, response_body []byte) (err error) {
+	if status_code >= 200 && status_code < 300 {
+		return nil
+	}
+	message := strings.TrimSpace(string(response_body))
+	if message == "" {
+		message = http.StatusText(status_code)
+	}
+	return &WebhookError{
+		WebhookType: webhook_type,
+		StatusCode:  status_code,
+		Code:        status_code,
+		Message:     message,
+	}
+}
+
+// 将 @userid 和 @所有人 写入内容，@手机号 不支持时返回警告
+func appendChatMention(provider Provider, message *Message, user_format string, at_all string) (content string, err error) {
+	content = message.Content
+	mention := message.Mention
+	if mention.IsEmpty() {
+		return
+	}
+	content = appendMentionText(content, mention.UserIDs, user_format)
+	if mention.AtAll {
+		content = appendMentionText(content, []string{at_all}, "%s")
+	}
+	if len(mention.Mobiles) > 0 {
+		err = newMentionWarning(provider, message, "不支持@手机号")
+	}
+	return
+}
+
+// Slack 机器人，api_key 为 incoming webhook 地址中 services/ 之后的部分
+type SlackProvider struct{}
+
+func (provider *SlackProvider) Name() string {
+	return WEBHOOK_TYPE_SLACK
+}
+
+func (provider *SlackProvider) ServerAddress() string {
+	return DICT_WEBHOOK_TYPE_TO_SERVER_ADDRESS[WEBHOOK_TYPE_SLACK]
+}
+
+func (provider *SlackProvider) RequestURL(server_address string, api_key string) string {
+	return server_address + api_key
+}
+
+// @提醒以 <@userid> 和 <!channel> 写入内容，不支持@手机号
+func (provider *SlackProvider) BuildPayload(message *Message) (payload map[string]any, err error) {
+	content, err := appendChatMention(provider, message, "<@%s>", "<!channel>")
+	switch message.MessageType {
+	case MESSAGE_TYPE_TEXT:
+		return NewSlackText(content).ToMap(), err
+	case MESSAGE_TYPE_MARKDOWN:
+		return NewSlackMarkdown(content).ToMap(), err
+	case MESSAGE_TYPE_IMAGE:
+		if message.ImageURL == "" {
+			return nil, fmt.Errorf("%s发送图片需要使用 WithImageUploader 指定图片上传函数", provider.Name())
+		}
+		return NewSlackImage(message.Title, message.ImageURL).ToMap(), err
+	}
+	return nil, fmt.Errorf("%s不支持的消息类型: %s", provider.Name(), message.MessageType)
+}
+
+// 成功时响应内容为 ok，失败时为 invalid_payload、no_service 等错误信息
+func (provider *SlackProvider) ParseResponse(status_code int, response_body []byte) error {
+	return parseStatusResponse(provider.Name(), status_code, response_body)
+}
+
+// Discord 机器人，api_key 为 webhook 地址中 webhooks/ 之后的 {id}/{token}
+type DiscordProvider struct{}
+
+func (provider *DiscordProvider) Name() string {
+	return WEBHOOK_TYPE_DISCORD
+}
+
+func (provider *DiscordProvider) ServerAddress() string {
+	return DICT_WEBHOOK_TYPE_TO_SERVER_ADDRESS[WEBHOOK_TYPE_DISCORD]
+}
+
+func (provider *DiscordProvider) RequestURL(server_address string, api_key string) string {
+	return server_address + api_key
+}
+
+// @提醒以 <@userid> 和 @everyone 写入内容，不支持@手机号
+func (provider *DiscordProvider) BuildPayload(message *Message) (payload map[string]any, err error) {
+	content, err := appendChatMention(provider, message, "<@%s>", "@everyone")
+	switch message.MessageType {
+	case MESSAGE_TYPE_TEXT, MESSAGE_TYPE_MARKDOWN:
+		return NewDiscordText(content).ToMap(), err
+	case MESSAGE_TYPE_IMAGE:
+		if message.ImageURL == "" {
+			return nil, fmt.Errorf("%s发送图片需要使用 WithImageUploader 指定图片上传函数", provider.Name())
+		}
+		discord_message := NewDiscordImage(message.Title, message.ImageURL)
+		if content != "" {
+			discord_message.Content = strings.TrimSpace(content)
+		}
+		return discord_message.ToMap(), err
+	}
+	return nil, fmt.Errorf("%s不支持的消息类型: %s", provider.Name(), message.MessageType)
+}
+
+// 成功时返回 204，失败时响应格式为 {"message": "Unknown Webhook", "code": 10015}
+func (provider *DiscordProvider) ParseResponse(status_code int, response_body []byte) (err error) {
+	err = parseStatusResponse(provider.Name(), status_code, response_body)
+	if err == nil {
+		return
+	}
+	response := struct {
+		Message string `json:"message"`
+		Code    int    `json:"code"`
+	}{}
+	if json.Unmarshal(response_body, &response) == nil && response.Code != 0 {
+		webhook_error := err.(*WebhookError)
+		webhook_error.Code = response.Code
+		webhook_error.Message = response.Message
+	}
+	return
+}
+
+// Telegram 机器人，api_key 为 bot token，需要指定发送的 ChatID
+//
+//	webhook.New(bot_token, webhook.WithProvider(&webhook.TelegramProvider{ChatID: "123456"}))
+type TelegramProvider struct {
+	ChatID string // 群组或用户的 chat_id
+}
+
+func (provider *TelegramProvider) Name() string {
+	return WEBHOOK_TYPE_TELEGRAM
+}
+
+func (provider *TelegramProvider) ServerAddress() string {
+	return DICT_WEBHOOK_TYPE_TO_SERVER_ADDRESS[WEBHOOK_TYPE_TELEGRAM]
+}
+
+func (provider *TelegramProvider) RequestURL(server_address string, api_key string) string {
+	return server_address + api_key + "/sendMessage"
+}
+
+// Telegram 的 sendMessage 不支持图片，图片消息以链接的形式发送；不支持@提醒
+func (provider *TelegramProvider) BuildPayload(message *Message) (payload map[string]any, err error) {
+	if provider.ChatID == "" {
+		return nil, fmt.Errorf("%s需要使用 WithProvider(&TelegramProvider{ChatID: ...}) 指定 chat_id", provider.Name())
+	}
+	if !message.Mention.IsEmpty() {
+		err = newMentionWarning(provider, message, "不支持@提醒")
+	}
+	switch message.MessageType {
+	case MESSAGE_TYPE_TEXT:
+		return NewTelegramText(provider.ChatID, message.Content).ToMap(), err
+	case MESSAGE_TYPE_MARKDOWN:
+		return NewTelegramMarkdown(provider.ChatID, message.Content).ToMap(), err
+	case MESSAGE_TYPE_IMAGE:
+		if message.ImageURL == "" {
+			return nil, fmt.Errorf("%s发送图片需要使用 WithImageUploader 指定图片上传函数", provider.Name())
+		}
+		return NewTelegramText(provider.ChatID, message.ImageURL).ToMap(), err
+	}
+	return nil, fmt.Errorf("%s不支持的消息类型: %s", provider.Name(), message.MessageType)
+}
+
+// 响应格式为 {"ok": false, "error_code": 429, "description": "Too Many Requests: retry after 5"}
+func (provider *TelegramProvider) ParseResponse(status_code int, response_body []byte) (err error) {
+	response := struct {
+		OK          bool   `json:"ok"`
+		ErrorCode   int    `json:"error_code"`
+		Description string `json:"description"`
+	}{}
+	if json.Unmarshal(response_body, &response) != nil {
+		return parseStatusResponse(provider.Name(), status_code, response_body)
+	}
+	if response.OK {
+		return nil
+	}
+	return &WebhookError{
+		WebhookType: provider.Name(),
+		StatusCode:  status_code,
+		Code:        response.ErrorCode,
+		Message:     response.Description,
+	}
+}
+
+// Teams 机器人，Teams 的 webhook 地址因租户而异，api_key 需要传入完整地址
+type TeamsProvider struct{}
+
+func (provider *TeamsProvider) Name() string {
+	return WEBHOOK_TYPE_TEAMS
+}
+
+func (provider *TeamsProvider) ServerAddress() string {
+	return DICT_WEBHOOK_TYPE_TO_SERVER_ADDRESS[WEBHOOK_TYPE_TEAMS]
+}
+
+func (provider *TeamsProvider) RequestURL(server_address string, api_key string) string {
+	return server_address + api_key
+}
+
+// MessageCard 不支持@提醒
+func (provider *TeamsProvider) BuildPayload(message *Message) (payload map[string]any, err error) {
+	if !message.Mention.IsEmpty() {
+		err = newMentionWarning(provider, message, "不支持@提醒")
+	}
+	switch message.MessageType {
+	case MESSAGE_TYPE_TEXT, MESSAGE_TYPE_MARKDOWN:
+		return NewTeamsMessage(message.Title, message.Content).ToMap(), err
+	case MESSAGE_TYPE_IMAGE:
+		if message.ImageURL == "" {
+			return nil, fmt.Errorf("%s发送图片需要使用 WithImageUploader 指定图片上传函数", provider.Name())
+		}
+		return NewTeamsMessage(message.Title, fmt.Sprintf("![image](%s)", message.ImageURL)).ToMap(), err
+	}
+	return nil, fmt.Errorf("%s不支持的消息类型: %s", provider.Name(), message.MessageType)
+}
+
+// 成功时响应内容为 1，失败时为错误信息
+func (provider *TeamsProvider) ParseResponse(status_code int, response_body []byte) error {
+	return parseStatusResponse(provider.Name(), status_code, response_body)
+}
+
+// 通用 Webhook 默认请求体模板
+const DEFAULT_GENERIC_PAYLOAD_TEMPLATE = `{"msgtype": {{json .MessageType}}, "title": {{json .Title}}, "content": {{json .Content}}, "image_url": {{json .ImageURL}}}`
+
+// 通用 Webhook，使用 text/template 模板渲染 JSON 请求体，模板的数据为 *Message
+//
+//	模板中可使用 json 函数输出转义后的 JSON 字符串，例如 {"text": {{json .Content}}}
+//	@提醒可在模板中通过 .Mention 自行渲染
+type GenericProvider struct {
+	name             string
+	server_address   string
+	payload_template *template.Template
+}
+
+// 创建通用 Webhook 平台，可通过 RegisterProvider 注册后使用 WithWebhookType(name)，或直接使用 WithProvider
+func NewGenericProvider(name string, server_address string, payload_template string) (provider *GenericProvider, err error) {
+	parsed_template, err := template.New(name).Funcs(template.FuncMap{
+		"json": func(v any) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+	}).Parse(payload_template)
+	if err != nil {
+		return
+	}
+	provider = &GenericProvider{
+		name:             name,
+		server_address:   server_address,
+		payload_template: parsed_template,
+	}
+	return
+}
+
+func (provider *GenericProvider) Name() string {
+	return provider.name
+}
+
+func (provider *GenericProvider) ServerAddress() string {
+	return provider.server_address
+}
+
+func (provider *GenericProvider) RequestURL(server_address string, api_key string) string {
+	return server_address + api_key
+}
+
+func (provider *GenericProvider) BuildPayload(message *Message) (payload map[string]any, err error) {
+	buffer := new(bytes.Buffer)
+	if err = provider.payload_template.Execute(buffer, message); err != nil {
+		return
+	}
+	payload = map[string]any{}
+	if err = json.Unmarshal(buffer.Bytes(), &payload); err != nil {
+		return nil, fmt.Errorf("%s请求体模板渲染结果不是 JSON 对象: %w", provider.name, err)
+	}
+	return
+}
+
+func (provider *GenericProvider) ParseResponse(status_code int, response_body []byte) error {
+	return parseStatusResponse(provider.name, status_code, response_body)
+}
@@ -0,0 +1,160 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// 各平台消息内容的最大字节数，超出时 WebhookSender 会自动拆分消息
+var DICT_WEBHOOK_TYPE_TO_CONTENT_LIMIT = map[string]map[string]int{
+	WEBHOOK_TYPE_WEIXIN_WORK: {MESSAGE_TYPE_TEXT: 2048, MESSAGE_TYPE_MARKDOWN: 4096},
+	WEBHOOK_TYPE_DINGDING:    {MESSAGE_TYPE_TEXT: 20000, MESSAGE_TYPE_MARKDOWN: 20000},
+	WEBHOOK_TYPE_FEISHU:      {MESSAGE_TYPE_TEXT: 18000, MESSAGE_TYPE_MARKDOWN: 18000}, // 请求体不超过 20KB，预留签名等字段
+	WEBHOOK_TYPE_SLACK:       {MESSAGE_TYPE_TEXT: 40000, MESSAGE_TYPE_MARKDOWN: 3000},  // section 的 mrkdwn 不超过 3000 字符
+	WEBHOOK_TYPE_DISCORD:     {MESSAGE_TYPE_TEXT: 2000, MESSAGE_TYPE_MARKDOWN: 2000},
+	WEBHOOK_TYPE_TELEGRAM:    {MESSAGE_TYPE_TEXT: 4096, MESSAGE_TYPE_MARKDOWN: 4096},
+	WEBHOOK_TYPE_TEAMS:       {MESSAGE_TYPE_TEXT: 24000, MESSAGE_TYPE_MARKDOWN: 24000}, // 请求体不超过 28KB
+}
+
+const (
+	split_number_reserved = 12 // 编号 "(999/999)\n" 预留的字节数
+	split_fence_reserved  = 4  // 代码块被拆分时补全 "\n```" 预留的字节数
+)
+
+var ErrContentLimitTooSmall = errors.New("内容长度限制过小，无法拆分")
+
+// 按行拆分超出 limit 字节的内容，拆分后每部分以 "(1/3)" 编号开头
+//
+//	单行超出限制时按字符拆分，不会截断 UTF-8 字符
+//	markdown 代码块被拆分时，在前一部分末尾补全 ``` 并在后一部分开头重新打开代码块
+//	limit 无法容纳编号或单个字符导致拆分后仍超出限制时返回 ErrContentLimitTooSmall
+func SplitContent(content string, limit int) (parts []string, err error) {
+	if limit <= 0 || len(content) <= limit {
+		return []string{content}, nil
+	}
+	budget := limit - split_number_reserved - split_fence_reserved
+	if budget <= 0 {
+		return nil, fmt.Errorf("%w: limit %d 字节不足以容纳编号", ErrContentLimitTooSmall, limit)
+	}
+
+	chunks := []string{}
+	current := new(strings.Builder)
+	fence := ""     // 当前所在代码块的起始行，为空表示不在代码块中
+	reopen_len := 0 // 当前部分开头重新打开代码块的长度
+	flush := func() {
+		if current.Len() <= reopen_len {
+			return
+		}
+		chunk := strings.TrimRight(current.String(), "\n")
+		if fence != "" {
+			chunk += "\n```"
+		}
+		chunks = append(chunks, chunk)
+		current.Reset()
+		reopen_len = 0
+		if fence != "" {
+			current.WriteString(fence + "\n")
+			reopen_len = current.Len()
+		}
+	}
+
+	for _, line := range strings.SplitAfter(content, "\n") {
+		if line == "" {
+			continue
+		}
+		for len(line) > 0 {
+			if current.Len()+len(line) <= budget {
+				current.WriteString(line)
+				break
+			}
+			// 优先在行边界拆分
+			if current.Len() > reopen_len {
+				flush()
+				continue
+			}
+			// 单行超出限制，按字符边界拆分
+			cut := min(max(budget-current.Len(), 1), len(line))
+			for cut > 0 && cut < len(line) && !utf8.RuneStart(line[cut]) {
+				cut--
+			}
+			// limit 小于一个字符的长度时，每部分至少包含一个完整字符，避免死循环，拆分后返回错误
+			if cut == 0 {
+				_, cut = utf8.DecodeRuneInString(line)
+			}
+			current.WriteString(line[:cut])
+			line = line[cut:]
+			flush()
+		}
+		trimmed_line := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed_line, "```") {
+			if fence == "" {
+				fence = trimmed_line
+			} else {
+				fence = ""
+			}
+		}
+	}
+	fence = ""
+	flush()
+
+	if len(chunks) > 1 {
+		for i, chunk := range chunks {
+			parts = append(parts, fmt.Sprintf("(%d/%d)\n%s", i+1, len(chunks), chunk))
+		}
+	} else {
+		parts = chunks
+	}
+	// 拆分数量过多导致编号超出预留长度，或 limit 小于单个字符的长度
+	for i, part := range parts {
+		if len(part) > limit {
+			return nil, fmt.Errorf("%w: 第 %d 部分为 %d 字节，超出 limit %d 字节", ErrContentLimitTooSmall, i+1, len(part), limit)
+		}
+	}
+	return
+}
+
+// 获取平台消息内容的最大字节数，0 表示不限制
+func getContentLimit(webhook_type string, message_type string) int {
+	return DICT_WEBHOOK_TYPE_TO_CONTENT_LIMIT[webhook_type][message_type]
+}
+
+// @提醒会追加到内容中，拆分时预留对应长度
+func mentionReserved(mention *Mention) (reserved int) {
+	if mention.IsEmpty() {
+		return
+	}
+	for _, item := range append(append([]string{}, mention.UserIDs...), mention.Mobiles...) {
+		reserved += len(item) + 24
+	}
+	return reserved + 32
+}
+
+// 拆分超长内容后依次发送，@提醒仅在第一部分生效
+func (webhook_sender *WebhookSender) sendSplitMessage(ctx context.Context, message *Message, limit int) (err error) {
+	budget := limit - mentionReserved(message.Mention)
+	if budget <= 0 {
+		return fmt.Errorf("@提醒预留 %d 字节，超出平台消息长度限制 %d 字节，无法拆分发送", mentionReserved(message.Mention), limit)
+	}
+	parts, err := SplitContent(message.Content, budget)
+	if err != nil {
+		return
+	}
+	var warning error
+	for i, part := range parts {
+		message_part := *message
+		message_part.Content = part
+		if i > 0 {
+			message_part.Mention = nil
+		}
+		err = webhook_sender.sendOne(ctx, &message_part)
+		if IsWarning(err) {
+			warning = err
+		} else if err != nil {
+			return
+		}
+	}
+	return warning
+}
@@ -1,10 +1,23 @@
 package webhook
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"image"
+	"io"
+	"mime/multipart"
 	"net/http"
-
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SimoLin/go-utils/hash"
+	"github.com/SimoLin/go-utils/message_template"
+	"github.com/SimoLin/go-utils/text_drawer"
 	"github.com/jummyliu/pkg/request"
 )
 
@@ -12,6 +25,11 @@ const (
 	WEBHOOK_TYPE_WEIXIN_WORK string = "企微机器人"
 	WEBHOOK_TYPE_DINGDING    string = "钉钉机器人"
 	WEBHOOK_TYPE_FEISHU      string = "飞书机器人"
+	WEBHOOK_TYPE_SLACK       string = "Slack机器人"
+	WEBHOOK_TYPE_DISCORD     string = "Discord机器人"
+	WEBHOOK_TYPE_TELEGRAM    string = "Telegram机器人"
+	WEBHOOK_TYPE_TEAMS       string = "Teams机器人"
+	WEBHOOK_TYPE_GENERIC     string = "通用Webhook"
 	MESSAGE_TYPE_TEXT        string = "text"
 	MESSAGE_TYPE_MARKDOWN    string = "markdown"
 	MESSAGE_TYPE_IMAGE       string = "image"
@@ -21,8 +39,16 @@ var DICT_WEBHOOK_TYPE_TO_SERVER_ADDRESS = map[string]string{
 	WEBHOOK_TYPE_WEIXIN_WORK: "https://qyapi.weixin.qq.com/cgi-bin/webhook/send?key=",
 	WEBHOOK_TYPE_DINGDING:    "https://oapi.dingtalk.com/robot/send?access_token=",
 	WEBHOOK_TYPE_FEISHU:      "https://open.feishu.cn/open-apis/bot/v2/hook/",
+	WEBHOOK_TYPE_SLACK:       "https://hooks.slack.com/services/",
+	WEBHOOK_TYPE_DISCORD:     "https://discord.com/api/webhooks/",
+	WEBHOOK_TYPE_TELEGRAM:    "https://api.telegram.org/bot",
+	WEBHOOK_TYPE_TEAMS:       "", // Teams 的 webhook 地址因租户而异，api_key 需要传入完整地址
+	WEBHOOK_TYPE_GENERIC:     "", // 通用 Webhook 需要使用 WithServerAddress 指定地址，或 api_key 传入完整地址
 }
 
+// 各平台的消息格式，仅作为参考，请勿直接修改
+//
+//	需要基于模板构造消息时，使用 GetMessageTemplate 获取副本，或使用 NewWeiXinWorkText 等消息构造函数
 var DICT_WEBHOOK_TYPE_TO_MESSAGE_TEMPLATE = map[string]map[string]map[string]any{
 	WEBHOOK_TYPE_WEIXIN_WORK: {
 		MESSAGE_TYPE_TEXT:     {"msgtype": "text", "text": map[string]string{"content": ""}},
@@ -32,22 +58,43 @@ var DICT_WEBHOOK_TYPE_TO_MESSAGE_TEMPLATE = map[string]map[string]map[string]any
 	WEBHOOK_TYPE_DINGDING: {
 		MESSAGE_TYPE_TEXT:     {"msgtype": "text", "text": map[string]string{"content": ""}},
 		MESSAGE_TYPE_MARKDOWN: {"msgtype": "markdown", "markdown": map[string]string{"title": "新消息", "text": ""}},
-		// MESSAGE_TYPE_IMAGE:    {"msgtype": "markdown", "markdown": map[string]string{"title": "新消息", "text": "![]({{image_url}})"}}, // 钉钉机器人不支持 image 类型，改为使用 markdown 类型
+		MESSAGE_TYPE_IMAGE:    {"msgtype": "markdown", "markdown": map[string]string{"title": "新消息", "text": ""}}, // 钉钉机器人不支持 image 类型，改为使用 markdown 类型
 	},
 	WEBHOOK_TYPE_FEISHU: {
 		MESSAGE_TYPE_TEXT:     {"msg_type": "text", "content": map[string]string{"text": ""}},
-		MESSAGE_TYPE_MARKDOWN: {"msg_type": "text", "content": map[string]string{"text": ""}}, // 飞书机器人不支持 markdown 类型，改为使用 text 类型
-		// MESSAGE_TYPE_IMAGE:    {"msg_type": "image", "content": map[string]string{"image_key": ""}}, // 飞书机器人发送图片需要先上传至 飞书开放平台 获取 image_key
+		MESSAGE_TYPE_MARKDOWN: {"msg_type": "interactive", "card": map[string]any{"elements": []map[string]any{{"tag": "div", "text": map[string]string{"tag": "lark_md", "content": ""}}}}}, // 飞书机器人的 markdown 类型使用消息卡片发送
+		MESSAGE_TYPE_IMAGE:    {"msg_type": "image", "content": map[string]string{"image_key": ""}},                                                                                          // 飞书机器人发送图片需要先上传至 飞书开放平台 获取 image_key
 	},
 }
 
+// 飞书开放平台地址，用于上传图片获取 image_key
+var FEISHU_OPEN_API_ADDRESS = "https://open.feishu.cn/open-apis"
+
 type WebhookSender struct {
-	api_key         string
-	server_address  string
-	webhook_type    string
-	proxy_address   string
-	message_title   string
-	request_headers map[string]string
+	api_key                string
+	server_address         string
+	webhook_type           string
+	proxy_address          string
+	message_title          string
+	secret                 string
+	request_headers        map[string]string
+	image_uploader         func(image_bytes []byte) (string, error) // 图片上传函数，钉钉机器人返回图片链接，飞书机器人返回 image_key
+	feishu_app_id          string                                   // 飞书开放平台应用的 app_id，用于上传图片
+	feishu_app_secret      string                                   // 飞书开放平台应用的 app_secret，用于上传图片
+	feishu_open_api        string                                   // 飞书开放平台地址，为空时使用 FEISHU_OPEN_API_ADDRESS
+	rate_limit_count       int                                      // 限流时间窗口内允许的最大请求数，为 0 时不限流
+	rate_limit_period      time.Duration                            // 限流时间窗口
+	retry_policy           RetryPolicy                              // 重试策略
+	provider               Provider                                 // webhook 平台，为空时按 webhook 类型获取已注册的平台
+	mention                *Mention                                 // 默认@提醒，消息未指定 Mention 时使用
+	disable_markdown       bool                                     // 是否关闭 markdown 方言转换
+	disable_split          bool                                     // 是否关闭超长消息自动拆分
+	oversize_image         bool                                     // 超长消息是否渲染为图片发送
+	oversize_image_options []text_drawer.OptionFunc                 // 超长消息渲染为图片的参数
+	timeout                time.Duration                            // 单次请求超时时间，默认为 15 秒
+	template_registry      *message_template.Registry               // SendTemplate 使用的模板注册表，默认为 message_template.DefaultRegistry
+	before_send_hooks      []BeforeSendHook                         // 发送前钩子
+	after_send_hooks       []AfterSendHook                          // 发送后钩子
 }
 
 type OptionFunc func(*WebhookSender)
@@ -59,6 +106,7 @@ func initOptions(options ...OptionFunc) *WebhookSender {
 		webhook_type:   WEBHOOK_TYPE_WEIXIN_WORK,
 		proxy_address:  "",
 		message_title:  "",
+		timeout:        15 * time.Second,
 		request_headers: map[string]string{
 			"User-Agent":      "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/102.0.5005.63 Safari/537.36",
 			"Accept":          "application/json",
@@ -94,6 +142,43 @@ func WithWebhookType(s string) OptionFunc {
 	}
 }
 
+// 可指定 webhook 平台，同时将 webhook 类型设置为平台名称，用于未注册或需要单独配置的平台
+func WithProvider(provider Provider) OptionFunc {
+	return func(webhook_sender *WebhookSender) {
+		webhook_sender.provider = provider
+		webhook_sender.webhook_type = provider.Name()
+	}
+}
+
+// 可指定默认@提醒，对所有未指定 Mention 的消息生效
+func WithMention(mention Mention) OptionFunc {
+	return func(webhook_sender *WebhookSender) {
+		webhook_sender.mention = &mention
+	}
+}
+
+// markdown 消息默认按平台转换 markdown 方言，可关闭
+func WithMarkdownTranslate(b bool) OptionFunc {
+	return func(webhook_sender *WebhookSender) {
+		webhook_sender.disable_markdown = !b
+	}
+}
+
+// 超长消息默认按平台限制自动拆分为多条发送，可关闭
+func WithSplitMessage(b bool) OptionFunc {
+	return func(webhook_sender *WebhookSender) {
+		webhook_sender.disable_split = !b
+	}
+}
+
+// 超长消息渲染为图片发送，渲染失败时仍按拆分发送，options 为 text_drawer 的参数（需要指定字体文件）
+func WithOversizeToImage(options ...text_drawer.OptionFunc) OptionFunc {
+	return func(webhook_sender *WebhookSender) {
+		webhook_sender.oversize_image = true
+		webhook_sender.oversize_image_options = options
+	}
+}
+
 // 可指定代理地址，为空时不使用代理
 func WithProxyAddress(s string) OptionFunc {
 	return func(webhook_sender *WebhookSender) {
@@ -115,87 +200,591 @@ func WithMessageTitle(s string) OptionFunc {
 	}
 }
 
+// 可指定加签密钥，为空时不签名
+//
+//	钉钉机器人“加签”安全设置的密钥，以 SEC 开头
+//	飞书机器人“签名校验”安全设置的密钥
+func WithSecret(s string) OptionFunc {
+	return func(webhook_sender *WebhookSender) {
+		webhook_sender.secret = s
+	}
+}
+
+// 可指定图片上传函数
+//
+//	钉钉机器人不支持 image 类型，需要返回可公开访问的图片链接，以 markdown 图片的形式发送
+//	飞书机器人需要返回 image_key，不指定时使用 WithFeiShuApp 配置的应用上传图片
+func WithImageUploader(f func(image_bytes []byte) (string, error)) OptionFunc {
+	return func(webhook_sender *WebhookSender) {
+		webhook_sender.image_uploader = f
+	}
+}
+
+// 飞书机器人发送图片需要先使用开放平台应用上传图片获取 image_key
+func WithFeiShuApp(app_id string, app_secret string) OptionFunc {
+	return func(webhook_sender *WebhookSender) {
+		webhook_sender.feishu_app_id = app_id
+		webhook_sender.feishu_app_secret = app_secret
+	}
+}
+
+// 可指定飞书开放平台地址，例如 Lark 的 https://open.larksuite.com/open-apis，默认为 FEISHU_OPEN_API_ADDRESS
+func WithFeiShuOpenAPIAddress(s string) OptionFunc {
+	return func(webhook_sender *WebhookSender) {
+		webhook_sender.feishu_open_api = strings.TrimRight(s, "/")
+	}
+}
+
+// 可指定限流，duration 时间内最多发送 count 条消息，相同机器人的 WebhookSender 共享限流
+//
+//	企微机器人、钉钉机器人均为每分钟 20 条
+func WithRateLimit(count int, duration time.Duration) OptionFunc {
+	return func(webhook_sender *WebhookSender) {
+		webhook_sender.rate_limit_count = count
+		webhook_sender.rate_limit_period = duration
+	}
+}
+
+// 可指定重试策略，平台限流、服务端错误或建立连接失败时按指数退避重试，max_retries 为 0 时不重试
+func WithRetry(max_retries int, base_delay time.Duration, max_delay time.Duration) OptionFunc {
+	return func(webhook_sender *WebhookSender) {
+		webhook_sender.retry_policy.MaxRetries = max_retries
+		webhook_sender.retry_policy.BaseDelay = base_delay
+		webhook_sender.retry_policy.MaxDelay = max_delay
+	}
+}
+
+// 可指定重试所有网络错误，包括请求超时等平台可能已收到消息的情况，需要与 WithRetry 同时使用
+//
+//	默认只重试建立连接失败的请求，避免重复推送
+func WithRetryNetworkErrors() OptionFunc {
+	return func(webhook_sender *WebhookSender) {
+		webhook_sender.retry_policy.RetryNetworkErrors = true
+	}
+}
+
+// 可指定单次请求超时时间，默认为 15 秒，重试时每次请求单独计时
+func WithTimeout(d time.Duration) OptionFunc {
+	return func(webhook_sender *WebhookSender) {
+		webhook_sender.timeout = d
+	}
+}
+
+// 可指定 SendTemplate 使用的模板注册表
+func WithTemplateRegistry(registry *message_template.Registry) OptionFunc {
+	return func(webhook_sender *WebhookSender) {
+		webhook_sender.template_registry = registry
+	}
+}
+
 func New(api_key string, options ...OptionFunc) *WebhookSender {
 	webhook_sender := initOptions(options...)
 	webhook_sender.api_key = api_key
+	// 未指定平台时，按 webhook 类型获取已注册的平台，未注册时使用企微机器人
+	if webhook_sender.provider == nil {
+		provider, ok := GetProvider(webhook_sender.webhook_type)
+		if !ok {
+			provider, _ = GetProvider(WEBHOOK_TYPE_WEIXIN_WORK)
+		}
+		webhook_sender.provider = provider
+	}
 	// 服务端地址为空时，使用 webhook 类型的默认地址
 	if webhook_sender.server_address == "" {
-		server_address, ok := DICT_WEBHOOK_TYPE_TO_SERVER_ADDRESS[webhook_sender.webhook_type]
-		if ok {
-			webhook_sender.server_address = server_address
-		} else {
-			webhook_sender.server_address = DICT_WEBHOOK_TYPE_TO_SERVER_ADDRESS[WEBHOOK_TYPE_WEIXIN_WORK]
-		}
+		webhook_sender.server_address = webhook_sender.provider.ServerAddress()
 	}
 
 	return webhook_sender
 }
 
+// 推送消息，开启限流时等待令牌，失败时按重试策略重试
 func (webhook_sender *WebhookSender) SendMessage(content map[string]any) (err error) {
+	return webhook_sender.SendMessageContext(context.Background(), content)
+}
+
+// 推送消息，ctx 取消或超时时停止等待令牌、重试和请求，返回 ctx.Err()
+//
+//	发送前后调用 WithBeforeSend、WithAfterSend 添加的钩子，被拦截时返回包装了 ErrSendVetoed 的错误
+func (webhook_sender *WebhookSender) SendMessageContext(ctx context.Context, content map[string]any) (err error) {
+	if len(webhook_sender.before_send_hooks) == 0 && len(webhook_sender.after_send_hooks) == 0 {
+		_, err = webhook_sender.sendMessageWithRetry(ctx, content)
+		return
+	}
+	event := &SendEvent{
+		WebhookType:   webhook_sender.webhook_type,
+		ServerAddress: webhook_sender.server_address,
+		Payload:       content,
+	}
+	start_time := time.Now()
+	defer func() {
+		event.Duration = time.Since(start_time)
+		event.Err = err
+		switch {
+		case IsVetoed(err):
+			event.Status = SEND_STATUS_VETOED
+		case err != nil && !IsWarning(err):
+			event.Status = SEND_STATUS_FAILURE
+		default:
+			event.Status = SEND_STATUS_SUCCESS
+		}
+		webhook_sender.runAfterSendHooks(ctx, event)
+	}()
+	if err = webhook_sender.runBeforeSendHooks(ctx, event); err != nil {
+		return
+	}
+	event.Attempts, err = webhook_sender.sendMessageWithRetry(ctx, event.Payload)
+	return
+}
+
+// 开启限流时等待令牌，失败时按重试策略重试，返回请求次数
+func (webhook_sender *WebhookSender) sendMessageWithRetry(ctx context.Context, content map[string]any) (attempts int, err error) {
+	var rate_limiter *RateLimiter
+	if webhook_sender.rate_limit_count > 0 && webhook_sender.rate_limit_period > 0 {
+		rate_limiter = getRateLimiter(
+			webhook_sender.server_address+webhook_sender.api_key,
+			webhook_sender.rate_limit_count,
+			webhook_sender.rate_limit_period,
+		)
+	}
+	for attempt := 0; ; attempt++ {
+		if rate_limiter != nil {
+			if err = rate_limiter.WaitContext(ctx); err != nil {
+				return
+			}
+		}
+		attempts++
+		err = webhook_sender.sendMessageOnce(ctx, content)
+		if ctx.Err() != nil {
+			return attempts, ctx.Err()
+		}
+		if attempt >= webhook_sender.retry_policy.MaxRetries || !webhook_sender.retry_policy.IsRetryable(err) {
+			return
+		}
+		timer := time.NewTimer(webhook_sender.retry_policy.Delay(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return attempts, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (webhook_sender *WebhookSender) sendMessageOnce(ctx context.Context, content map[string]any) (err error) {
+	request_url := webhook_sender.provider.RequestURL(webhook_sender.server_address, webhook_sender.api_key)
+	if signer, ok := webhook_sender.provider.(SignProvider); ok && webhook_sender.secret != "" {
+		request_url, content = signer.Sign(request_url, content, webhook_sender.secret)
+	}
 	request_data, _ := json.Marshal(content)
-	_, _, _, err = request.DoRequest(
-		fmt.Sprintf("%s%s", webhook_sender.server_address, webhook_sender.api_key),
+	ctx, cancel := webhook_sender.withTimeout(ctx)
+	defer cancel()
+	// request.DoRequest 会丢弃网络错误的类型，使用 DoRequestUndercourse 保留 *url.Error 用于判断是否重试
+	response, err := request.DoRequestUndercourse(
+		request_url,
 		request.WithMethod(http.MethodPost),
 		request.WithHeader(webhook_sender.request_headers),
 		request.WithData(request_data),
 		request.WithProxy(webhook_sender.proxy_address),
+		request.WithContext(ctx),
+		request.WithTimeout(timeoutSeconds(webhook_sender.timeout)),
 	)
 	if err != nil {
 		return
 	}
+	defer response.Body.Close()
+	response_body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return
+	}
+	err = webhook_sender.provider.ParseResponse(response.StatusCode, response_body)
+	return
+}
+
+// 单次请求的 ctx，指定 WithTimeout 时增加超时
+func (webhook_sender *WebhookSender) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if webhook_sender.timeout > 0 {
+		return context.WithTimeout(ctx, webhook_sender.timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// request.WithTimeout 的单位为秒，向上取整；精确的超时由 ctx 控制
+func timeoutSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int((d + time.Second - 1) / time.Second)
+}
+
+// 推送通用消息，由 webhook 平台转换为对应的请求体
+//
+//	消息类型不支持@提醒时仍会发送，发送成功后返回 *MentionWarning，可使用 IsWarning 判断
+//	markdown 类型的内容按平台转换 markdown 方言
+//	内容超出平台限制时自动拆分为多条发送，或使用 WithOversizeToImage 渲染为图片发送
+func (webhook_sender *WebhookSender) Send(message *Message) (err error) {
+	return webhook_sender.SendContext(context.Background(), message)
+}
+
+// 推送通用消息，ctx 取消或超时时停止发送，拆分发送时剩余部分不再发送
+func (webhook_sender *WebhookSender) SendContext(ctx context.Context, message *Message) (err error) {
+	if message.Mention == nil && webhook_sender.mention != nil {
+		message_copy := *message
+		message_copy.Mention = webhook_sender.mention
+		message = &message_copy
+	}
+	if message.MessageType == MESSAGE_TYPE_MARKDOWN && !webhook_sender.disable_markdown {
+		message_copy := *message
+		message_copy.Content = RenderMarkdown(webhook_sender.webhook_type, message.Content)
+		message = &message_copy
+	}
+	limit := getContentLimit(webhook_sender.webhook_type, message.MessageType)
+	if !webhook_sender.disable_split && limit > 0 && len(message.Content)+mentionReserved(message.Mention) > limit {
+		if webhook_sender.oversize_image {
+			rgba, render_err := text_drawer.New(webhook_sender.oversize_image_options...).TextToImage(strings.Split(message.Content, "\n"))
+			if render_err == nil {
+				return webhook_sender.SendMessageImageContext(ctx, rgba)
+			}
+		}
+		return webhook_sender.sendSplitMessage(ctx, message, limit)
+	}
+	return webhook_sender.sendOne(ctx, message)
+}
+
+func (webhook_sender *WebhookSender) sendOne(ctx context.Context, message *Message) (err error) {
+	payload, err := webhook_sender.provider.BuildPayload(message)
+	var warning *MentionWarning
+	if err != nil && !errors.As(err, &warning) {
+		return
+	}
+	if err = webhook_sender.SendMessageContext(ctx, payload); err != nil {
+		return
+	}
+	if warning != nil {
+		return warning
+	}
+	return
+}
+
+// 钉钉机器人加签，返回毫秒时间戳和 Base64 编码的签名（未进行 URL 编码）
+func SignDingDing(secret string, now time.Time) (timestamp string, sign string) {
+	timestamp = strconv.FormatInt(now.UnixMilli(), 10)
+	sign = hash.HMACSHA256EncodeToBase64(timestamp+"\n"+secret, secret)
+	return
+}
+
+// 飞书机器人签名校验，返回秒级时间戳和 Base64 编码的签名
+//
+//	以 timestamp + "\n" + secret 作为密钥，对空字符串计算 HMAC-SHA256
+func SignFeiShu(secret string, now time.Time) (timestamp string, sign string) {
+	timestamp = strconv.FormatInt(now.Unix(), 10)
+	sign = hash.HMACSHA256EncodeToBase64("", timestamp+"\n"+secret)
 	return
 }
 
 // 推送Text类型消息
 func (webhook_sender *WebhookSender) SendMessageText(content string) (err error) {
-	map_content := DICT_WEBHOOK_TYPE_TO_MESSAGE_TEMPLATE[webhook_sender.webhook_type][MESSAGE_TYPE_TEXT]
-	var temp_content = map[string]string{}
-	switch webhook_sender.webhook_type {
-	case WEBHOOK_TYPE_WEIXIN_WORK:
-	case WEBHOOK_TYPE_DINGDING:
-		temp_content = map_content["text"].(map[string]string)
-		temp_content["content"] = content
-		map_content["text"] = temp_content
-	case WEBHOOK_TYPE_FEISHU:
-		temp_content = map_content["content"].(map[string]string)
-		temp_content["text"] = content
-		map_content["content"] = temp_content
-	}
-	err = webhook_sender.SendMessage(map_content)
+	err = webhook_sender.Send(&Message{
+		MessageType: MESSAGE_TYPE_TEXT,
+		Title:       webhook_sender.message_title,
+		Content:     content,
+	})
 	return
 }
 
 // 推送Markdown类型消息
 //
-//	飞书机器人不支持Markdown格式降级为text类型
+//	content 为通用 markdown，颜色使用 <font color="red">文本</font> 表示，发送前按平台转换 markdown 方言
+//	飞书机器人以消息卡片的 lark_md 元素发送，指定消息标题时显示为卡片标题
 //	钉钉机器人的 Markdown 类型支持指定消息标题，不指定时默认使用“新消息”作为标题
 func (webhook_sender *WebhookSender) SendMessageMarkdown(content string) (err error) {
-	map_content := DICT_WEBHOOK_TYPE_TO_MESSAGE_TEMPLATE[webhook_sender.webhook_type][MESSAGE_TYPE_MARKDOWN]
-	var temp_content = map[string]string{}
-	switch webhook_sender.webhook_type {
-	case WEBHOOK_TYPE_WEIXIN_WORK:
-		temp_content = map_content["markdown"].(map[string]string)
-		temp_content["content"] = content
-		map_content["markdown"] = temp_content
-	case WEBHOOK_TYPE_DINGDING:
-		temp_content = map_content["markdown"].(map[string]string)
-		temp_content["text"] = content
-		if webhook_sender.message_title != "" {
-			temp_content["title"] = webhook_sender.message_title
-		}
-		map_content["markdown"] = temp_content
-	case WEBHOOK_TYPE_FEISHU:
-		temp_content = map_content["content"].(map[string]string)
-		temp_content["text"] = content
-		map_content["content"] = temp_content
+	err = webhook_sender.Send(&Message{
+		MessageType: MESSAGE_TYPE_MARKDOWN,
+		Title:       webhook_sender.message_title,
+		Content:     content,
+	})
+	return
+}
+
+// 渲染模板后推送消息，模板定义了 title 时作为消息标题，否则使用 WithMessageTitle 指定的标题
+func (webhook_sender *WebhookSender) SendTemplate(message_type string, name string, data any) (err error) {
+	registry := webhook_sender.template_registry
+	if registry == nil {
+		registry = message_template.DefaultRegistry
+	}
+	title, content, err := registry.RenderMessage(name, data)
+	if err != nil {
+		return
+	}
+	if title == "" {
+		title = webhook_sender.message_title
+	}
+	return webhook_sender.Send(&Message{
+		MessageType: message_type,
+		Title:       title,
+		Content:     content,
+	})
+}
+
+// markdown 消息的标题显示为消息头部的平台，Notify 不在正文中重复标题
+var DICT_WEBHOOK_TYPE_TO_MARKDOWN_TITLE_DISPLAYED = map[string]bool{
+	WEBHOOK_TYPE_FEISHU: true, // 消息卡片标题
+	WEBHOOK_TYPE_TEAMS:  true, // MessageCard 标题
+}
+
+// 实现 notify.Channel 接口，以 Markdown 类型发送
+//
+//	平台不显示 markdown 消息标题时，标题加粗显示在正文开头
+//	消息已送达但@提醒未生效时不返回 *MentionWarning，避免被记录为渠道发送失败
+func (webhook_sender *WebhookSender) Notify(title string, content string) error {
+	if title != "" && !DICT_WEBHOOK_TYPE_TO_MARKDOWN_TITLE_DISPLAYED[webhook_sender.webhook_type] {
+		content = fmt.Sprintf("**%s**\n%s", title, content)
+	}
+	err := webhook_sender.Send(&Message{
+		MessageType: MESSAGE_TYPE_MARKDOWN,
+		Title:       title,
+		Content:     content,
+	})
+	if IsWarning(err) {
+		return nil
+	}
+	return err
+}
+
+// 推送Image类型消息
+//
+//	企微机器人直接发送图片的 base64 和 md5
+//	钉钉机器人不支持 image 类型，上传图片后以 markdown 图片链接的形式发送
+//	飞书机器人上传图片获取 image_key 后发送
+func (webhook_sender *WebhookSender) SendMessageImage(rgba image.Image) (err error) {
+	return webhook_sender.SendMessageImageContext(context.Background(), rgba)
+}
+
+// 推送Image类型消息，ctx 取消或超时时停止上传和发送
+func (webhook_sender *WebhookSender) SendMessageImageContext(ctx context.Context, rgba image.Image) (err error) {
+	return webhook_sender.SendMessageImageBytesContext(ctx, text_drawer.ImageToByte(rgba))
+}
+
+// 推送Image类型消息，image_bytes 为 jpg 或 png 格式的图片内容
+//
+//	指定 WithImageUploader 时先上传图片，企微机器人不需要上传
+func (webhook_sender *WebhookSender) SendMessageImageBytes(image_bytes []byte) (err error) {
+	return webhook_sender.SendMessageImageBytesContext(context.Background(), image_bytes)
+}
+
+// 推送Image类型消息，ctx 取消或超时时停止上传和发送，WithImageUploader 指定的上传函数不受 ctx 控制
+func (webhook_sender *WebhookSender) SendMessageImageBytesContext(ctx context.Context, image_bytes []byte) (err error) {
+	message := &Message{
+		MessageType: MESSAGE_TYPE_IMAGE,
+		Title:       webhook_sender.message_title,
+		Image:       image_bytes,
+	}
+	if webhook_sender.image_uploader != nil && webhook_sender.webhook_type != WEBHOOK_TYPE_WEIXIN_WORK {
+		message.ImageURL, err = webhook_sender.image_uploader(image_bytes)
+	} else if webhook_sender.webhook_type == WEBHOOK_TYPE_FEISHU && webhook_sender.feishu_app_id != "" {
+		message.ImageURL, err = webhook_sender.UploadImageToFeiShuContext(ctx, image_bytes)
+	}
+	if err != nil {
+		return
+	}
+	err = webhook_sender.SendContext(ctx, message)
+	return
+}
+
+// 上传文件至企微机器人，返回 media_id，有效期 3 天
+//
+//	上传地址由服务端地址推导，将 /send 替换为 /upload_media，media_type 为 file 或 voice
+func (webhook_sender *WebhookSender) UploadMedia(file_name string, file_bytes []byte, media_type string) (media_id string, err error) {
+	return webhook_sender.UploadMediaContext(context.Background(), file_name, file_bytes, media_type)
+}
+
+// 上传文件至企微机器人，ctx 取消或超时时中断上传
+func (webhook_sender *WebhookSender) UploadMediaContext(ctx context.Context, file_name string, file_bytes []byte, media_type string) (media_id string, err error) {
+	if webhook_sender.webhook_type != WEBHOOK_TYPE_WEIXIN_WORK {
+		return "", fmt.Errorf("%s不支持上传文件", webhook_sender.webhook_type)
+	}
+	if media_type == "" {
+		media_type = WEIXIN_WORK_MEDIA_TYPE_FILE
+	}
+	server_address := webhook_sender.server_address
+	if !strings.Contains(server_address, "/send") {
+		server_address = DICT_WEBHOOK_TYPE_TO_SERVER_ADDRESS[WEBHOOK_TYPE_WEIXIN_WORK]
+	}
+	upload_url := strings.Replace(server_address, "/send", "/upload_media", 1) + webhook_sender.api_key + "&type=" + media_type
+
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Disposition": {fmt.Sprintf(`form-data; name="media"; filename="%s"; filelength=%d`, file_name, len(file_bytes))},
+		"Content-Type":        {"application/octet-stream"},
+	})
+	if err != nil {
+		return
+	}
+	part.Write(file_bytes)
+	writer.Close()
+
+	request_headers := map[string]string{}
+	for k, v := range webhook_sender.request_headers {
+		request_headers[k] = v
+	}
+	request_headers["Content-Type"] = writer.FormDataContentType()
+	ctx, cancel := webhook_sender.withTimeout(ctx)
+	defer cancel()
+	status_code, response_body, _, err := request.DoRequest(
+		upload_url,
+		request.WithMethod(http.MethodPost),
+		request.WithHeader(request_headers),
+		request.WithData(body.Bytes()),
+		request.WithProxy(webhook_sender.proxy_address),
+		request.WithContext(ctx),
+		request.WithTimeout(timeoutSeconds(webhook_sender.timeout)),
+	)
+	if err != nil {
+		return
+	}
+	if err = webhook_sender.provider.ParseResponse(status_code, response_body); err != nil {
+		return
+	}
+	upload_result := struct {
+		MediaID string `json:"media_id"`
+	}{}
+	if err = json.Unmarshal(response_body, &upload_result); err != nil {
+		return
+	}
+	media_id = upload_result.MediaID
+	return
+}
+
+// 推送文件消息，先上传文件获取 media_id，仅企微机器人支持
+func (webhook_sender *WebhookSender) SendMessageFile(file_name string, file_bytes []byte) (err error) {
+	return webhook_sender.SendMessageFileContext(context.Background(), file_name, file_bytes)
+}
+
+// 推送文件消息，ctx 取消或超时时停止上传和发送
+func (webhook_sender *WebhookSender) SendMessageFileContext(ctx context.Context, file_name string, file_bytes []byte) (err error) {
+	media_id, err := webhook_sender.UploadMediaContext(ctx, file_name, file_bytes, WEIXIN_WORK_MEDIA_TYPE_FILE)
+	if err != nil {
+		return
+	}
+	err = webhook_sender.SendMessageContext(ctx, NewWeiXinWorkFile(media_id).ToMap())
+	return
+}
+
+// 获取飞书应用的 tenant_access_token，用于调用开放平台接口
+func GetFeiShuTenantAccessToken(app_id string, app_secret string, request_headers map[string]string, proxy_address string) (tenant_access_token string, err error) {
+	return GetFeiShuTenantAccessTokenContext(context.Background(), app_id, app_secret, request_headers, proxy_address)
+}
+
+// 获取飞书应用的 tenant_access_token，ctx 取消或超时时中断请求
+func GetFeiShuTenantAccessTokenContext(ctx context.Context, app_id string, app_secret string, request_headers map[string]string, proxy_address string) (tenant_access_token string, err error) {
+	return getFeiShuTenantAccessToken(ctx, FEISHU_OPEN_API_ADDRESS, app_id, app_secret, request_headers, proxy_address)
+}
+
+func getFeiShuTenantAccessToken(ctx context.Context, open_api_address string, app_id string, app_secret string, request_headers map[string]string, proxy_address string) (tenant_access_token string, err error) {
+	token_data, _ := json.Marshal(map[string]string{
+		"app_id":     app_id,
+		"app_secret": app_secret,
+	})
+	_, response_body, _, err := request.DoRequest(
+		open_api_address+"/auth/v3/tenant_access_token/internal",
+		request.WithMethod(http.MethodPost),
+		request.WithHeader(request_headers),
+		request.WithData(token_data),
+		request.WithProxy(proxy_address),
+		request.WithContext(ctx),
+	)
+	if err != nil {
+		return
+	}
+	token_result := struct {
+		Code              int    `json:"code"`
+		Msg               string `json:"msg"`
+		TenantAccessToken string `json:"tenant_access_token"`
+	}{}
+	if err = json.Unmarshal(response_body, &token_result); err != nil {
+		return
+	}
+	if token_result.Code != 0 {
+		return "", fmt.Errorf("获取飞书 tenant_access_token 失败: %d %s", token_result.Code, token_result.Msg)
+	}
+	return token_result.TenantAccessToken, nil
+}
+
+// 使用 WithFeiShuApp 配置的应用上传图片至飞书开放平台，返回 image_key
+func (webhook_sender *WebhookSender) UploadImageToFeiShu(image_bytes []byte) (image_key string, err error) {
+	return webhook_sender.UploadImageToFeiShuContext(context.Background(), image_bytes)
+}
+
+// 上传图片至飞书开放平台，ctx 取消或超时时中断获取 token 和上传，WithTimeout 限制整个上传过程
+func (webhook_sender *WebhookSender) UploadImageToFeiShuContext(ctx context.Context, image_bytes []byte) (image_key string, err error) {
+	if webhook_sender.feishu_app_id == "" || webhook_sender.feishu_app_secret == "" {
+		return "", fmt.Errorf("飞书机器人发送图片需要使用 WithFeiShuApp 指定应用的 app_id 和 app_secret")
+	}
+	ctx, cancel := webhook_sender.withTimeout(ctx)
+	defer cancel()
+	open_api_address := webhook_sender.feishu_open_api
+	if open_api_address == "" {
+		open_api_address = FEISHU_OPEN_API_ADDRESS
+	}
+	tenant_access_token, err := getFeiShuTenantAccessToken(
+		ctx,
+		open_api_address,
+		webhook_sender.feishu_app_id,
+		webhook_sender.feishu_app_secret,
+		webhook_sender.request_headers,
+		webhook_sender.proxy_address,
+	)
+	if err != nil {
+		return
+	}
+
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	writer.WriteField("image_type", "message")
+	part, err := writer.CreateFormFile("image", "image.jpg")
+	if err != nil {
+		return
+	}
+	part.Write(image_bytes)
+	writer.Close()
+
+	request_headers := map[string]string{}
+	for k, v := range webhook_sender.request_headers {
+		request_headers[k] = v
+	}
+	request_headers["Content-Type"] = writer.FormDataContentType()
+	request_headers["Authorization"] = "Bearer " + tenant_access_token
+	_, response_body, _, err := request.DoRequest(
+		open_api_address+"/im/v1/images",
+		request.WithMethod(http.MethodPost),
+		request.WithHeader(request_headers),
+		request.WithData(body.Bytes()),
+		request.WithProxy(webhook_sender.proxy_address),
+		request.WithContext(ctx),
+		request.WithTimeout(timeoutSeconds(webhook_sender.timeout)),
+	)
+	if err != nil {
+		return
+	}
+	upload_result := struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+		Data struct {
+			ImageKey string `json:"image_key"`
+		} `json:"data"`
+	}{}
+	if err = json.Unmarshal(response_body, &upload_result); err != nil {
+		return
+	}
+	if upload_result.Code != 0 {
+		return "", fmt.Errorf("上传飞书图片失败: %d %s", upload_result.Code, upload_result.Msg)
 	}
-	err = webhook_sender.SendMessage(map_content)
+	image_key = upload_result.Data.ImageKey
 	return
 }
 
 func SendToWeiXinWork(api_key string, content map[string]any, proxy_address string) (err error) {
 
-	request_url := "https://qyapi.weixin.qq.com/cgi-bin/webhook/send?key=" + api_key
+	request_url := DICT_WEBHOOK_TYPE_TO_SERVER_ADDRESS[WEBHOOK_TYPE_WEIXIN_WORK] + api_key
 
 	request_data, _ := json.Marshal(content)
 
@@ -208,7 +797,7 @@ func SendToWeiXinWork(api_key string, content map[string]any, proxy_address stri
 		"Connection":      "close",
 	}
 
-	_, _, _, err = request.DoRequest(
+	status_code, response_body, _, err := request.DoRequest(
 		request_url,
 		request.WithMethod(http.MethodPost),
 		request.WithHeader(request_headers),
@@ -220,12 +809,13 @@ func SendToWeiXinWork(api_key string, content map[string]any, proxy_address stri
 		return
 	}
 
+	err = ParseResponse(WEBHOOK_TYPE_WEIXIN_WORK, status_code, response_body)
 	return
 }
 
 func SendToDingDing(api_key string, content map[string]any, proxy_address string) (err error) {
 
-	request_url := "https://oapi.dingtalk.com/robot/send?access_token=" + api_key
+	request_url := DICT_WEBHOOK_TYPE_TO_SERVER_ADDRESS[WEBHOOK_TYPE_DINGDING] + api_key
 
 	request_data, _ := json.Marshal(content)
 
@@ -238,7 +828,7 @@ func SendToDingDing(api_key string, content map[string]any, proxy_address string
 		"Connection":      "close",
 	}
 
-	_, _, _, err = request.DoRequest(
+	status_code, response_body, _, err := request.DoRequest(
 		request_url,
 		request.WithMethod(http.MethodPost),
 		request.WithHeader(request_headers),
@@ -250,12 +840,13 @@ func SendToDingDing(api_key string, content map[string]any, proxy_address string
 		return
 	}
 
+	err = ParseResponse(WEBHOOK_TYPE_DINGDING, status_code, response_body)
 	return
 }
 
 func SendToFeiShu(api_key string, content map[string]any, proxy_address string) (err error) {
 
-	request_url := "https://open.feishu.cn/open-apis/bot/v2/hook/" + api_key
+	request_url := DICT_WEBHOOK_TYPE_TO_SERVER_ADDRESS[WEBHOOK_TYPE_FEISHU] + api_key
 
 	request_data, _ := json.Marshal(content)
 
@@ -268,7 +859,7 @@ func SendToFeiShu(api_key string, content map[string]any, proxy_address string)
 		"Connection":      "close",
 	}
 
-	_, _, _, err = request.DoRequest(
+	status_code, response_body, _, err := request.DoRequest(
 		request_url,
 		request.WithMethod(http.MethodPost),
 		request.WithHeader(request_headers),
@@ -280,5 +871,6 @@ func SendToFeiShu(api_key string, content map[string]any, proxy_address string)
 		return
 	}
 
+	err = ParseResponse(WEBHOOK_TYPE_FEISHU, status_code, response_body)
 	return
 }
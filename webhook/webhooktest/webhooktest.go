@@ -0,0 +1,461 @@
+// 模拟企微、钉钉、飞书机器人的 webhook 服务端，用于离线测试
+//
+//	server := webhooktest.NewServer(webhooktest.WithKey("your_api_key", ""))
+//	defer server.Close()
+//	webhook_sender := webhook.New("your_api_key", webhook.WithServerAddress(server.WeiXinWorkAddress()))
+package webhooktest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SimoLin/go-utils/hash"
+	"github.com/SimoLin/go-utils/webhook"
+)
+
+const (
+	PATH_WEIXIN_WORK_SEND         = "/cgi-bin/webhook/send"
+	PATH_WEIXIN_WORK_UPLOAD_MEDIA = "/cgi-bin/webhook/upload_media"
+	PATH_DINGDING_SEND            = "/robot/send"
+	PATH_DINGDING_SEND_BY_SESSION = "/robot/sendBySession"
+	PATH_FEISHU_HOOK              = "/open-apis/bot/v2/hook/"
+	PATH_FEISHU_TENANT_TOKEN      = "/open-apis/auth/v3/tenant_access_token/internal"
+	PATH_FEISHU_IMAGES            = "/open-apis/im/v1/images"
+	PATH_FEISHU_MESSAGES          = "/open-apis/im/v1/messages/"
+)
+
+// 签名时间戳允许的误差，与平台一致为 1 小时
+var SIGN_TIMESTAMP_TOLERANCE = time.Hour
+
+// 服务端收到的请求
+type Request struct {
+	WebhookType string
+	Path        string
+	Key         string
+	Query       url.Values
+	Header      http.Header
+	Body        []byte
+	Payload     map[string]any // JSON 请求体，multipart 上传请求为空
+}
+
+// 模拟服务端
+type Server struct {
+	*httptest.Server
+	mutex         sync.Mutex
+	keys          map[string]string // api_key -> secret，为空时接受任意 api_key
+	requests      []Request
+	failure_code  int
+	failure_times int
+	media_count   int
+}
+
+type OptionFunc func(*Server)
+
+func initOptions(options ...OptionFunc) *Server {
+	server := &Server{
+		keys:     map[string]string{},
+		requests: []Request{},
+	}
+	for _, option_func := range options {
+		option_func(server)
+	}
+	return server
+}
+
+// 注册有效的 api_key，secret 不为空时校验钉钉、飞书的签名
+func WithKey(api_key string, secret string) OptionFunc {
+	return func(server *Server) {
+		server.keys[api_key] = secret
+	}
+}
+
+func NewServer(options ...OptionFunc) *Server {
+	server := initOptions(options...)
+	mux := http.NewServeMux()
+	mux.HandleFunc(PATH_WEIXIN_WORK_SEND, server.handleWeiXinWork)
+	mux.HandleFunc(PATH_WEIXIN_WORK_UPLOAD_MEDIA, server.handleWeiXinWorkUploadMedia)
+	mux.HandleFunc(PATH_DINGDING_SEND, server.handleDingDing)
+	mux.HandleFunc(PATH_FEISHU_HOOK, server.handleFeiShu)
+	mux.HandleFunc(PATH_FEISHU_TENANT_TOKEN, server.handleFeiShuTenantToken)
+	mux.HandleFunc(PATH_FEISHU_IMAGES, server.handleFeiShuImages)
+	mux.HandleFunc(PATH_DINGDING_SEND_BY_SESSION, server.handleDingDingSession)
+	mux.HandleFunc(PATH_FEISHU_MESSAGES, server.handleFeiShuReply)
+	server.Server = httptest.NewServer(mux)
+	return server
+}
+
+// 企微机器人地址，用于 webhook.WithServerAddress
+func (server *Server) WeiXinWorkAddress() string {
+	return server.URL + PATH_WEIXIN_WORK_SEND + "?key="
+}
+
+// 钉钉机器人地址，用于 webhook.WithServerAddress
+func (server *Server) DingDingAddress() string {
+	return server.URL + PATH_DINGDING_SEND + "?access_token="
+}
+
+// 飞书机器人地址，用于 webhook.WithServerAddress
+func (server *Server) FeiShuAddress() string {
+	return server.URL + PATH_FEISHU_HOOK
+}
+
+// 飞书开放平台地址，用于替换 webhook.FEISHU_OPEN_API_ADDRESS
+func (server *Server) FeiShuOpenAPIAddress() string {
+	return server.URL + "/open-apis"
+}
+
+// 钉钉 outgoing 机器人回调中的 sessionWebhook 地址
+func (server *Server) DingDingSessionWebhook(session string) string {
+	return server.URL + PATH_DINGDING_SEND_BY_SESSION + "?session=" + url.QueryEscape(session)
+}
+
+// 按机器人类型获取地址，不支持的类型返回空字符串
+func (server *Server) Address(webhook_type string) string {
+	switch webhook_type {
+	case webhook.WEBHOOK_TYPE_WEIXIN_WORK:
+		return server.WeiXinWorkAddress()
+	case webhook.WEBHOOK_TYPE_DINGDING:
+		return server.DingDingAddress()
+	case webhook.WEBHOOK_TYPE_FEISHU:
+		return server.FeiShuAddress()
+	}
+	return ""
+}
+
+// 接下来的 times 次推送请求返回平台错误码 code，例如企微限流 45009
+func (server *Server) FailNext(code int, times int) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.failure_code = code
+	server.failure_times = times
+}
+
+// 获取收到的所有请求
+func (server *Server) Requests() []Request {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return append([]Request{}, server.requests...)
+}
+
+// 获取最后一次收到的请求，没有请求时返回 false
+func (server *Server) LastRequest() (request Request, ok bool) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	if len(server.requests) == 0 {
+		return
+	}
+	return server.requests[len(server.requests)-1], true
+}
+
+// 获取收到的所有推送消息体
+func (server *Server) Payloads() (payloads []map[string]any) {
+	for _, request := range server.Requests() {
+		if request.Payload != nil {
+			payloads = append(payloads, request.Payload)
+		}
+	}
+	return
+}
+
+// 清空已记录的请求
+func (server *Server) Reset() {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.requests = []Request{}
+}
+
+func (server *Server) record(webhook_type string, key string, r *http.Request) (request Request) {
+	body, _ := io.ReadAll(r.Body)
+	request = Request{
+		WebhookType: webhook_type,
+		Path:        r.URL.Path,
+		Key:         key,
+		Query:       r.URL.Query(),
+		Header:      r.Header.Clone(),
+		Body:        body,
+	}
+	if media_type, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); media_type != "multipart/form-data" {
+		payload := map[string]any{}
+		if json.Unmarshal(body, &payload) == nil {
+			request.Payload = payload
+		}
+	}
+	server.mutex.Lock()
+	server.requests = append(server.requests, request)
+	server.mutex.Unlock()
+	return
+}
+
+// 校验 api_key，返回对应的 secret
+func (server *Server) checkKey(key string) (secret string, ok bool) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	if len(server.keys) == 0 {
+		return "", key != ""
+	}
+	secret, ok = server.keys[key]
+	return
+}
+
+// 消耗一次 FailNext 设置的错误
+func (server *Server) nextFailure() (code int) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	if server.failure_times <= 0 {
+		return 0
+	}
+	server.failure_times--
+	return server.failure_code
+}
+
+// 校验签名时间戳是否在允许的误差内，unit 为时间戳单位
+func checkTimestamp(timestamp string, unit time.Duration) bool {
+	i, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	diff := time.Since(time.Unix(0, i*int64(unit)))
+	return diff < SIGN_TIMESTAMP_TOLERANCE && diff > -SIGN_TIMESTAMP_TOLERANCE
+}
+
+func writeJSON(w http.ResponseWriter, status_code int, data map[string]any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status_code)
+	json.NewEncoder(w).Encode(data)
+}
+
+// 企微消息内容位于 payload[msgtype]["content"]
+func weiXinWorkContentLength(payload map[string]any) (length int, limit int) {
+	msgtype, _ := payload["msgtype"].(string)
+	message_type := map[string]string{"text": webhook.MESSAGE_TYPE_TEXT, "markdown": webhook.MESSAGE_TYPE_MARKDOWN}[msgtype]
+	if message_type == "" {
+		return
+	}
+	body, _ := payload[msgtype].(map[string]any)
+	content, _ := body["content"].(string)
+	return len(content), webhook.DICT_WEBHOOK_TYPE_TO_CONTENT_LIMIT[webhook.WEBHOOK_TYPE_WEIXIN_WORK][message_type]
+}
+
+func (server *Server) handleWeiXinWork(w http.ResponseWriter, r *http.Request) {
+	key := r.URL.Query().Get("key")
+	request := server.record(webhook.WEBHOOK_TYPE_WEIXIN_WORK, key, r)
+	response := func(code int, msg string) {
+		writeJSON(w, http.StatusOK, map[string]any{"errcode": code, "errmsg": msg})
+	}
+	if _, ok := server.checkKey(key); !ok {
+		response(93000, "invalid webhook url")
+		return
+	}
+	if code := server.nextFailure(); code != 0 {
+		response(code, "mock failure")
+		return
+	}
+	if request.Payload == nil {
+		response(40035, "invalid json")
+		return
+	}
+	switch msgtype, _ := request.Payload["msgtype"].(string); msgtype {
+	case "text", "markdown", "image", "news", "file", "template_card":
+	default:
+		response(40008, "invalid message type")
+		return
+	}
+	if length, limit := weiXinWorkContentLength(request.Payload); limit > 0 && length > limit {
+		response(40058, fmt.Sprintf("content exceed max length %d", limit))
+		return
+	}
+	response(0, "ok")
+}
+
+func (server *Server) handleWeiXinWorkUploadMedia(w http.ResponseWriter, r *http.Request) {
+	key := r.URL.Query().Get("key")
+	server.record(webhook.WEBHOOK_TYPE_WEIXIN_WORK, key, r)
+	if _, ok := server.checkKey(key); !ok {
+		writeJSON(w, http.StatusOK, map[string]any{"errcode": 93000, "errmsg": "invalid webhook url"})
+		return
+	}
+	server.mutex.Lock()
+	server.media_count++
+	media_id := fmt.Sprintf("media_id_%d", server.media_count)
+	server.mutex.Unlock()
+	writeJSON(w, http.StatusOK, map[string]any{
+		"errcode":    0,
+		"errmsg":     "ok",
+		"type":       r.URL.Query().Get("type"),
+		"media_id":   media_id,
+		"created_at": strconv.FormatInt(time.Now().Unix(), 10),
+	})
+}
+
+func (server *Server) handleDingDing(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	key := query.Get("access_token")
+	request := server.record(webhook.WEBHOOK_TYPE_DINGDING, key, r)
+	response := func(code int, msg string) {
+		writeJSON(w, http.StatusOK, map[string]any{"errcode": code, "errmsg": msg})
+	}
+	secret, ok := server.checkKey(key)
+	if !ok {
+		response(300001, "token is not exist")
+		return
+	}
+	if secret != "" {
+		timestamp := query.Get("timestamp")
+		if !checkTimestamp(timestamp, time.Millisecond) {
+			response(310000, "timestamp is invalid")
+			return
+		}
+		if query.Get("sign") != hash.HMACSHA256EncodeToBase64(timestamp+"\n"+secret, secret) {
+			response(310000, "sign not match")
+			return
+		}
+	}
+	if code := server.nextFailure(); code != 0 {
+		response(code, "mock failure")
+		return
+	}
+	if request.Payload == nil {
+		response(40035, "缺少参数 json")
+		return
+	}
+	switch msgtype, _ := request.Payload["msgtype"].(string); msgtype {
+	case "text", "markdown", "link", "actionCard", "feedCard":
+	default:
+		response(40035, "缺少参数 msgtype")
+		return
+	}
+	response(0, "ok")
+}
+
+func (server *Server) handleFeiShu(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, PATH_FEISHU_HOOK)
+	request := server.record(webhook.WEBHOOK_TYPE_FEISHU, key, r)
+	response := func(code int, msg string) {
+		writeJSON(w, http.StatusOK, map[string]any{"code": code, "msg": msg, "data": map[string]any{}})
+	}
+	secret, ok := server.checkKey(key)
+	if !ok {
+		response(19001, "param invalid: incoming webhook access token invalid")
+		return
+	}
+	if request.Payload == nil {
+		response(9499, "Bad Request")
+		return
+	}
+	if secret != "" {
+		timestamp, _ := request.Payload["timestamp"].(string)
+		sign, _ := request.Payload["sign"].(string)
+		if !checkTimestamp(timestamp, time.Second) || sign != hash.HMACSHA256EncodeToBase64("", timestamp+"\n"+secret) {
+			response(19021, "sign match fail or timestamp is not within one hour from current time")
+			return
+		}
+	}
+	if code := server.nextFailure(); code != 0 {
+		response(code, "mock failure")
+		return
+	}
+	switch msg_type, _ := request.Payload["msg_type"].(string); msg_type {
+	case "text", "post", "image", "share_chat", "interactive":
+	default:
+		response(19002, "params error, msg_type need")
+		return
+	}
+	response(0, "success")
+}
+
+func (server *Server) handleFeiShuTenantToken(w http.ResponseWriter, r *http.Request) {
+	request := server.record(webhook.WEBHOOK_TYPE_FEISHU, "", r)
+	app_id, _ := request.Payload["app_id"].(string)
+	app_secret, _ := request.Payload["app_secret"].(string)
+	if app_id == "" || app_secret == "" {
+		writeJSON(w, http.StatusOK, map[string]any{"code": 10003, "msg": "invalid param"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"code":                0,
+		"msg":                 "ok",
+		"tenant_access_token": "t-" + hash.MD5Encode(app_id+app_secret),
+		"expire":              7200,
+	})
+}
+
+func (server *Server) handleFeiShuImages(w http.ResponseWriter, r *http.Request) {
+	request := server.record(webhook.WEBHOOK_TYPE_FEISHU, "", r)
+	_, files, _ := ParseMultipart(request)
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer t-") {
+		writeJSON(w, http.StatusOK, map[string]any{"code": 99991663, "msg": "Invalid access token for authorization"})
+		return
+	}
+	if len(files["image"]) == 0 {
+		writeJSON(w, http.StatusOK, map[string]any{"code": 234001, "msg": "Invalid request param"})
+		return
+	}
+	server.mutex.Lock()
+	server.media_count++
+	image_key := fmt.Sprintf("img_v2_%d", server.media_count)
+	server.mutex.Unlock()
+	writeJSON(w, http.StatusOK, map[string]any{"code": 0, "msg": "success", "data": map[string]any{"image_key": image_key}})
+}
+
+// 钉钉 sessionWebhook 回复，Key 为 session
+func (server *Server) handleDingDingSession(w http.ResponseWriter, r *http.Request) {
+	request := server.record(webhook.WEBHOOK_TYPE_DINGDING, r.URL.Query().Get("session"), r)
+	if request.Key == "" {
+		writeJSON(w, http.StatusOK, map[string]any{"errcode": 300001, "errmsg": "session is not exist"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"errcode": 0, "errmsg": "ok"})
+}
+
+// 飞书回复消息 /open-apis/im/v1/messages/{message_id}/reply，Key 为 message_id
+func (server *Server) handleFeiShuReply(w http.ResponseWriter, r *http.Request) {
+	message_id, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, PATH_FEISHU_MESSAGES), "/reply")
+	request := server.record(webhook.WEBHOOK_TYPE_FEISHU, message_id, r)
+	if !ok || message_id == "" {
+		writeJSON(w, http.StatusNotFound, map[string]any{"code": 230001, "msg": "invalid message_id"})
+		return
+	}
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer t-") {
+		writeJSON(w, http.StatusOK, map[string]any{"code": 99991663, "msg": "Invalid access token for authorization"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"code": 0,
+		"msg":  "success",
+		"data": map[string]any{"message_id": "om_reply_" + message_id, "msg_type": request.Payload["msg_type"]},
+	})
+}
+
+// 解析 multipart 请求体，返回表单字段和文件内容，用于断言上传请求
+func ParseMultipart(request Request) (fields map[string]string, files map[string][]byte, err error) {
+	_, params, err := mime.ParseMediaType(request.Header.Get("Content-Type"))
+	if err != nil {
+		return
+	}
+	reader := multipart.NewReader(bytes.NewReader(request.Body), params["boundary"])
+	fields, files = map[string]string{}, map[string][]byte{}
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			break
+		}
+		data, _ := io.ReadAll(part)
+		if part.FileName() != "" {
+			files[part.FormName()] = data
+		} else {
+			fields[part.FormName()] = string(data)
+		}
+	}
+	return
+}